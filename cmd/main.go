@@ -1,15 +1,25 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/CarbonRook/go-querynessus/querynessus"
+	"github.com/CarbonRook/go-querynessus/querynessus/cvss"
 )
 
 var TENABLE_ACCESS_KEY = "TENABLE_ACCESS_KEY"
@@ -17,6 +27,18 @@ var TENABLE_SECRET_KEY = "TENABLE_SECRET_KEY"
 
 const chars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
+// stringList is a flag that may be given more than once.
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ", ")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
 func random(length int) (string, error) {
 	bytes := make([]byte, length)
 
@@ -39,16 +61,32 @@ func main() {
 
 		fmt.Fprintf(os.Stderr, "\nRequired environment vars:\n%s: Tenable API access key\n%s: Tenable API secret key\n", TENABLE_ACCESS_KEY, TENABLE_SECRET_KEY)
 
-		fmt.Fprintf(os.Stderr, "\nEXAMPLES\n\nGet plugin information by name using jq:\njq '.data.plugin_details | .[] | select(.name | contains(\"QUERY\"))' plugins.json\n")
+		fmt.Fprintf(os.Stderr, "\nEXAMPLES\n\nFind plugins by name in a plugins file:\n%s -db plugins.json -query 'name ~ \"QUERY\"'\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nFind critical Windows plugins with a public exploit as CSV:\n%s -db plugins.json -output csv -query 'cvss3_base_score >= 9 and exploit_available and family ~ \"Windows\"'\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nSearch plugin names, synopses, descriptions and solutions by keyword:\n%s -db plugins.json -search 'openssl \"remote code execution\" -windows'\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nFind the plugins that detect CVEs, given as arguments or one or more per line on stdin:\n%s -db plugins.json -lookup-cve CVE-2021-44228 CVE-2021-45046\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nFind plugins for known exploited or likely to be exploited vulnerabilities:\n%s -db plugins.json -epss epss_scores-current.csv.gz -kev known_exploited_vulnerabilities.json -query 'enrichment.kev or enrichment.epss_score > 0.5'\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nList the findings of a scan export on known exploited vulnerabilities, with their plugins' details:\n%s -db plugins.json -kev known_exploited_vulnerabilities.json -findings scan.nessus -query 'enrichment.kev'\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nExport the high and critical findings of a scan as a PDF report by plugin:\n%s -export-results 42 -format pdf -export-chapters vuln_by_plugin -export-filter 'severity >= high'\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nWrite a Markdown changelog between two plugin snapshots:\n%s -db plugins.json -diff last-week.json > changes.md\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nShow when a plugin's VPR first went above 9:\n%s -db plugins.json -history 12345 -query 'vpr.score > 9'\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nRe-score critical plugins for internal-only assets holding sensitive data:\n%s -db plugins.json -rescore 'MAV:A/CR:H' -rescore-v2 'TD:M/CR:H' -query 'cvss3_base_score >= 9'\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nQuery fields:\n%s\n", strings.Join(querynessus.FilterFieldNames(), ", "))
 	}
-	outfileArg := flag.String("out", "nessus-plugins.json", "The file to output the JSON to")
+	outfileArg := flag.String("out", "nessus-plugins.json", "The file to output the JSON to (compressed if ending .gz or .zst), or a .bolt plugin database")
 	// Plugins
 	allPluginsFlag := flag.Bool("all-plugins", false, "Fetch all plugins")
 	pluginsSinceFlag := flag.String("plugins-since", "", "Fetch all plugins since YYYY-MM-DD")
 	singlePluginFlag := flag.Int("single-plugin", 0, "The plugin ID to fetch")
 	// Scan export
 	exportFlag := flag.Int("export-results", 0, "Export results from a given scan ID")
-	exportFormatFlag := flag.String("format", "nessus", "Export the results in a given format \"nessus\", \"db\", \"csv\"")
+	exportFormatFlag := flag.String("format", "nessus", "Export the results in a given format \"nessus\", \"db\", \"csv\", \"html\", \"pdf\"")
+	var exportFilterFlags stringList
+	flag.Var(&exportFilterFlags, "export-filter", "Only export findings matching a filter, e.g. 'severity >= high' or 'plugin_family = Web Servers' (repeatable)")
+	exportFilterAnyFlag := flag.Bool("export-filter-any", false, "Export findings matching any -export-filter instead of all of them")
+	exportChaptersFlag := flag.String("export-chapters", "vuln_hosts_summary,vuln_by_host", "Comma separated chapters of html and pdf exports: vuln_hosts_summary, vuln_by_host, vuln_by_plugin, compliance_exec, compliance, remediations, exec_report")
+	exportOutFlag := flag.String("export-out", "", "The file to download -export-results to (default SCANID-FILEID.FORMAT)")
+	exportTimeoutFlag := flag.Duration("export-timeout", time.Hour, "Give up on -export-results if it isn't downloaded within this time, e.g. 30m (0 for no limit)")
 	// Scans
 	allScansFlag := flag.Bool("list-scans", false, "Export all scans")
 	scansSinceFlag := flag.String("scans-since", "", "Fetch all scans since a given date, YYYY-MM-DD")
@@ -60,36 +98,128 @@ func main() {
 	allFoldersFlag := flag.Bool("list-folders", false, "List folders in your account")
 	// Update existing JSON database
 	updateFileFlag := flag.String("update-plugins", "", "Add the latest plugins to a previously generated plugins file")
+	backupsFlag := flag.Int("backups", 0, "Number of previous versions of the plugins file to keep when updating")
+	changelogFlag := flag.String("changelog", "", "Write the changes made by -update-plugins to this file, as JSON if it ends .json and Markdown otherwise")
+	// Query local plugin database
+	queryFlag := flag.String("query", "", "Print plugins from -db matching a filter expression, e.g. 'cvss3_base_score >= 9 and exploit_available', or only those matching it with -search, lookups, -findings, -history or -rescore")
+	dbFlag := flag.String("db", "nessus-plugins.json", "The plugins file or .bolt plugin database to query")
+	searchFlag := flag.String("search", "", "Print the plugins from -db best matching keywords and \"quoted phrases\", e.g. 'name:openssl -windows', optionally only those matching -query")
+	limitFlag := flag.Int("limit", 20, "Maximum number of -search or -rescore results (0 for all)")
+	lookupCVEFlag := flag.Bool("lookup-cve", false, "Print the plugins from -db that detect the CVEs given as arguments, or on stdin if there are none")
+	lookupXRefFlag := flag.Bool("lookup-xref", false, "Print the plugins from -db with the cross references, e.g. IAVA:2021-A-0001, given as arguments, or on stdin if there are none")
+	historyFlag := flag.Int("history", 0, "Print the recorded changes to a plugin ID in -db, or with -query when it first matched the query")
+	rescoreFlag := flag.String("rescore", "", "Re-score plugins in -db, optionally only those matching -query, with CVSS v3 environmental metrics, e.g. 'MAV:A/CR:H'")
+	rescoreV2Flag := flag.String("rescore-v2", "", "CVSS v2 environmental metrics for -rescore, used for plugins without a v3 vector, e.g. 'TD:M'")
+	rescoreV4Flag := flag.String("rescore-v4", "", "CVSS v4 environmental metrics for -rescore, used in preference to v3 for plugins with a v4 vector, e.g. 'MAV:A/CR:H'")
+	epssFlag := flag.String("epss", "", "EPSS scores CSV from FIRST, optionally gzipped, to add each plugin's highest EPSS score to -query, -search and lookups")
+	kevFlag := flag.String("kev", "", "CISA Known Exploited Vulnerabilities catalog JSON to add KEV membership and due dates to -query, -search and lookups")
+	findingsFlag := flag.String("findings", "", "Print the findings of a .nessus or CSV scan export, optionally compressed, with their plugins from -db, optionally only those whose plugin matches -query")
+	findingsScanFlag := flag.Int("findings-scan", 0, "Print the findings on each host of a scan ID, like -findings but fetched from the Tenable API")
+	diffFlag := flag.String("diff", "", "Print the changes to plugins between this older plugins file or .bolt database and -db")
+	outputFlag := flag.String("output", "table", "Output format for -query, -search and lookups \"table\", \"json\", \"csv\", or for -diff \"markdown\", \"json\"")
+	// HTTP client
+	baseURLFlag := flag.String("base-url", querynessus.DefaultTenableBaseURL, "Base URL of the Tenable.io or Nessus Manager API")
+	timeoutFlag := flag.Duration("timeout", 0, "Timeout for each request to the Tenable API, e.g. 30s (0 for no timeout)")
+	proxyFlag := flag.String("proxy", "", "Proxy URL to send Tenable API requests through")
+	caBundleFlag := flag.String("ca-bundle", "", "PEM file of additional CA certificates to trust")
+	rateLimitFlag := flag.Float64("rate-limit", 0, "Maximum requests per second to the Tenable API (0 for no limit)")
+	rateBurstFlag := flag.Int("rate-burst", 1, "Number of requests allowed to burst above -rate-limit")
+	workersFlag := flag.Int("workers", 1, "Number of plugin pages to fetch concurrently")
+	maxAttemptsFlag := flag.Int("max-attempts", querynessus.DefaultRetryPolicy.MaxAttempts, "Maximum attempts for each retryable request to the Tenable API")
 	flag.Parse()
 
-	permittedFormats := map[string]bool{"nessus": true, "db": true, "csv": true}
+	permittedFormats := map[string]bool{"nessus": true, "db": true, "csv": true, "html": true, "pdf": true}
 	_, ok := permittedFormats[*exportFormatFlag]
 	if !ok {
 		log.Fatalf("Invalid export format provided: %s", *exportFormatFlag)
 		return
 	}
+	if !permittedOutputFormats[*outputFlag] {
+		log.Fatalf("Invalid output format provided: %s", *outputFlag)
+		return
+	}
+
+	if *historyFlag > 0 {
+		PrintPluginHistory(*dbFlag, *historyFlag, *queryFlag, *outputFlag)
+		return
+	}
+	if *rescoreFlag != "" || *rescoreV2Flag != "" || *rescoreV4Flag != "" {
+		RescorePlugins(*dbFlag, cvss.Environment{V4: *rescoreV4Flag, V3: *rescoreFlag, V2: *rescoreV2Flag}, *queryFlag, *outputFlag, *limitFlag)
+		return
+	}
+	enricher := loadEnricher(*epssFlag, *kevFlag)
+	if *findingsFlag != "" {
+		PrintFindings(*findingsFlag, *dbFlag, *queryFlag, *outputFlag, enricher)
+		return
+	}
+	if *searchFlag != "" {
+		SearchPlugins(*dbFlag, *searchFlag, *queryFlag, *outputFlag, *limitFlag, enricher)
+		return
+	}
+	if *diffFlag != "" {
+		if *queryFlag != "" {
+			log.Fatalf("-query can't be used with -diff")
+			return
+		}
+		DiffPluginDatabases(*diffFlag, *dbFlag, *outputFlag)
+		return
+	}
+	if *lookupCVEFlag || *lookupXRefFlag {
+		LookupPlugins(*dbFlag, *lookupXRefFlag, flag.Args(), *queryFlag, *outputFlag, enricher)
+		return
+	}
+	if *queryFlag != "" && *findingsScanFlag == 0 {
+		QueryPlugins(*dbFlag, *queryFlag, *outputFlag, enricher)
+		return
+	}
+
+	retryPolicy := querynessus.DefaultRetryPolicy
+	retryPolicy.MaxAttempts = *maxAttemptsFlag
+	clientOpts := []querynessus.ClientOption{
+		querynessus.WithBaseURL(*baseURLFlag),
+		querynessus.WithTimeout(*timeoutFlag),
+		querynessus.WithRetryPolicy(retryPolicy),
+		querynessus.WithPageWorkers(*workersFlag),
+	}
+	if *rateLimitFlag > 0 {
+		clientOpts = append(clientOpts, querynessus.WithRateLimiter(querynessus.NewTokenBucketLimiter(*rateLimitFlag, *rateBurstFlag)))
+	}
+	if *proxyFlag != "" {
+		clientOpts = append(clientOpts, querynessus.WithProxy(*proxyFlag))
+	}
+	if *caBundleFlag != "" {
+		clientOpts = append(clientOpts, querynessus.WithCABundle(*caBundleFlag))
+	}
+	tac, err := querynessus.NewTenableApiClient(os.Getenv(TENABLE_ACCESS_KEY), os.Getenv(TENABLE_SECRET_KEY), clientOpts...)
+	if err != nil {
+		log.Fatalf("Failed to create Tenable API client: %s", err)
+		return
+	}
 
-	tac := querynessus.NewTenableApiClient(os.Getenv(TENABLE_ACCESS_KEY), os.Getenv(TENABLE_SECRET_KEY))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
 	if *allPluginsFlag || *pluginsSinceFlag != "" {
-		FetchAllPlugins(&tac, pluginsSinceFlag, outfileArg)
+		FetchAllPlugins(ctx, &tac, pluginsSinceFlag, outfileArg)
 	} else if *singlePluginFlag > 0 {
-		FetchSinglePlugin(&tac, singlePluginFlag)
+		FetchSinglePlugin(ctx, &tac, singlePluginFlag)
 	} else if *exportFlag != 0 {
-		ExportScan(&tac, exportFlag, exportFormatFlag)
+		ExportScan(ctx, &tac, exportFlag, exportFormatFlag, exportFilterFlags, *exportFilterAnyFlag, *exportChaptersFlag, *exportOutFlag, *exportTimeoutFlag)
 	} else if *allScansFlag || *scansSinceFlag != "" {
-		FetchAllScans(&tac, scansSinceFlag)
+		FetchAllScans(ctx, &tac, scansSinceFlag)
 	} else if *allFoldersFlag {
-		FetchAllFolders(&tac)
+		FetchAllFolders(ctx, &tac)
 	} else if *updateFileFlag != "" {
-		UpdatePluginRepository(&tac, updateFileFlag)
+		UpdatePluginRepository(ctx, &tac, updateFileFlag, *backupsFlag, *changelogFlag)
 	} else if *singleScanFlag > 0 {
-		FetchSingleScan(&tac, singleScanFlag)
+		FetchSingleScan(ctx, &tac, singleScanFlag)
+	} else if *findingsScanFlag > 0 {
+		PrintScanFindings(ctx, &tac, *findingsScanFlag, *dbFlag, *queryFlag, *outputFlag, enricher)
 	}
 }
 
-func FetchSinglePlugin(tac *querynessus.TenableApiClient, pluginId *int) {
-	result, err := tac.FetchSinglePluginDetails(*pluginId)
+func FetchSinglePlugin(ctx context.Context, tac *querynessus.TenableApiClient, pluginId *int) {
+	result, err := tac.FetchSinglePluginDetailsContext(ctx, *pluginId)
 	if err != nil {
 		log.Printf("Failed to fetch plugin id %d: %s\n", *pluginId, err)
 		os.Exit(1)
@@ -102,7 +232,7 @@ func FetchSinglePlugin(tac *querynessus.TenableApiClient, pluginId *int) {
 	fmt.Println(pluginDetailsJson)
 }
 
-func FetchAllPlugins(tac *querynessus.TenableApiClient, pluginsSinceFlag *string, outFilePath *string) {
+func FetchAllPlugins(ctx context.Context, tac *querynessus.TenableApiClient, pluginsSinceFlag *string, outFilePath *string) {
 	params := querynessus.RequestParams{
 		Size: 10000,
 		Page: 1,
@@ -112,31 +242,146 @@ func FetchAllPlugins(tac *querynessus.TenableApiClient, pluginsSinceFlag *string
 		params.LastUpdated = *pluginsSinceFlag
 	}
 
-	results, err := tac.FetchAllPlugins(&params)
+	pluginIterator := tac.IteratePlugins(params)
+	if isBoltDatabase(*outFilePath) {
+		bpr, err := querynessus.NewBoltPluginRepository(*outFilePath)
+		if err != nil {
+			log.Fatalf("Failed to open plugin database %s: %s\n", *outFilePath, err)
+			return
+		}
+		defer bpr.Close()
+		newCount, updatedCount, duplicateCount, err := upsertPlugins(ctx, bpr, pluginIterator)
+		if err != nil {
+			log.Fatalf("Failed to fetch plugins into %s: %s\n", *outFilePath, err)
+			return
+		}
+		log.Printf("Stored %d new plugins, updated %d existing plugins, ignored %d duplicate plugins in %s", newCount, updatedCount, duplicateCount, *outFilePath)
+		return
+	}
 
+	pluginCount := 0
+	err := querynessus.WriteFileAtomic(*outFilePath, 0644, func(w io.Writer) error {
+		compressed, err := querynessus.NewCompressingWriter(w, querynessus.CompressionFromFilename(*outFilePath))
+		if err != nil {
+			return err
+		}
+		writer := querynessus.NewPluginStreamWriter(compressed)
+		for pluginIterator.Next(ctx) {
+			plugin := pluginIterator.Plugin()
+			err := writer.Write(&plugin)
+			if err != nil {
+				compressed.Close()
+				return fmt.Errorf("failed to write plugin %d: %w", plugin.ID, err)
+			}
+		}
+		if err := pluginIterator.Err(); err != nil {
+			compressed.Close()
+			return fmt.Errorf("failed to fetch plugins: %w", err)
+		}
+		pluginCount = writer.Count()
+		err = writer.Close()
+		if err != nil {
+			compressed.Close()
+			return err
+		}
+		return compressed.Close()
+	})
 	if err != nil {
-		log.Println("Failed to fetch plugins")
-		os.Exit(1)
+		log.Fatalf("Failed to write plugins to %s: %s\n", *outFilePath, err)
+		return
 	}
+	log.Printf("Wrote %d plugins to %s", pluginCount, *outFilePath)
+}
 
-	combinedPage := querynessus.PluginListPage{
-		TotalCount: len(results),
-		Data: querynessus.PluginDetailsList{
-			PluginDetails: results,
-		},
-		Size: len(results),
+const pluginBatchSize = 1000
+
+func isBoltDatabase(filePath string) bool {
+	return strings.EqualFold(filepath.Ext(filePath), ".bolt")
+}
+
+func upsertPlugins(ctx context.Context, repo querynessus.IncrementalPluginRepository, pluginIterator *querynessus.PluginIterator) (newCount int, updatedCount int, duplicateCount int, err error) {
+	batch := make([]querynessus.PluginDetails, 0, pluginBatchSize)
+	flush := func() error {
+		batchNew, batchUpdated, batchDuplicate, err := repo.Upsert(batch...)
+		if err != nil {
+			return err
+		}
+		newCount += batchNew
+		updatedCount += batchUpdated
+		duplicateCount += batchDuplicate
+		batch = batch[:0]
+		return nil
+	}
+	for pluginIterator.Next(ctx) {
+		batch = append(batch, pluginIterator.Plugin())
+		if len(batch) == pluginBatchSize {
+			if err := flush(); err != nil {
+				return newCount, updatedCount, duplicateCount, err
+			}
+		}
 	}
+	if err := pluginIterator.Err(); err != nil {
+		return newCount, updatedCount, duplicateCount, err
+	}
+	err = flush()
+	return newCount, updatedCount, duplicateCount, err
+}
 
-	combinedPage.SaveToFile(*outFilePath)
+func UpdateBoltPluginRepository(ctx context.Context, tac *querynessus.TenableApiClient, filePath string, changelogPath string) {
+	bpr, err := querynessus.NewBoltPluginRepository(filePath)
+	if err != nil {
+		log.Fatalf("Failed to open plugin database %s: %s\n", filePath, err)
+		return
+	}
+	defer bpr.Close()
+	lastModifiedDate, err := bpr.LatestModifiedDate()
+	if err != nil {
+		log.Fatalf("Failed to get latest modified date for plugins: %s\n", err)
+		return
+	}
+	log.Printf("Fetching plugins since %s", lastModifiedDate.Format(time.RFC3339))
+	params := querynessus.RequestParams{
+		Size:        10000,
+		Page:        1,
+		LastUpdated: lastModifiedDate.Format("2006-01-02"),
+	}
+	var diff *querynessus.PluginDiff
+	pluginIterator := tac.IteratePlugins(params)
+	var repo querynessus.IncrementalPluginRepository = bpr
+	if changelogPath != "" {
+		diff = querynessus.NewPluginDiff()
+		repo = &diffingRepository{IncrementalPluginRepository: bpr, diff: diff}
+	}
+	newCount, updatedCount, duplicateCount, err := upsertPlugins(ctx, repo, pluginIterator)
+	if err != nil {
+		log.Fatalf("Failed to update plugins in %s: %s\n", filePath, err)
+		return
+	}
+	log.Printf("Merged %d new plugins, updated %d existing plugins, ignored %d duplicate plugins", newCount, updatedCount, duplicateCount)
+	if diff != nil {
+		diff.Sort()
+		writeChangelog(changelogPath, diff)
+	}
+	log.Println("Complete")
 }
 
-func UpdatePluginRepository(tac *querynessus.TenableApiClient, filePath *string) {
+func UpdatePluginRepository(ctx context.Context, tac *querynessus.TenableApiClient, filePath *string, backups int, changelogPath string) {
 	log.Printf("Updating file %s", *filePath)
-	jfpr, err := querynessus.NewJsonFilePluginRepository(*filePath)
+	if isBoltDatabase(*filePath) {
+		UpdateBoltPluginRepository(ctx, tac, *filePath, changelogPath)
+		return
+	}
+	jfpr, err := querynessus.NewJsonFilePluginRepository(*filePath, querynessus.WithBackups(backups))
 	if err != nil {
 		log.Fatalf("Failed to create Json repository from file %s: %s\n", *filePath, err)
 		os.Exit(1)
 	}
+	err = jfpr.Lock()
+	if err != nil {
+		log.Fatalf("Failed to lock %s: %s\n", *filePath, err)
+		os.Exit(1)
+	}
+	defer jfpr.Unlock()
 	pluginPage, err := jfpr.Load()
 	if err != nil {
 		log.Fatalf("Failed to load plugin page from file %s: %s\n", *filePath, err)
@@ -155,9 +400,9 @@ func UpdatePluginRepository(tac *querynessus.TenableApiClient, filePath *string)
 		LastUpdated: lastModifiedDate.Format("2006-01-02"),
 	}
 	log.Printf("Fetching plugins since %s", lastModifiedDate.Format(time.RFC3339))
-	results, err := tac.FetchAllPlugins(&params)
+	results, err := tac.FetchAllPluginsContext(ctx, &params)
 	if err != nil {
-		log.Println("Failed to fetch plugins")
+		log.Printf("Failed to fetch plugins: %s\n", err)
 		os.Exit(1)
 	}
 	newPluginsPage := querynessus.PluginListPage{
@@ -168,12 +413,22 @@ func UpdatePluginRepository(tac *querynessus.TenableApiClient, filePath *string)
 		Size: len(results),
 	}
 	log.Printf("Merging in %d new plugins\n", newPluginsPage.Size)
-	newCount, updatedCount, duplicateCount, err := pluginPage.Merge(&newPluginsPage)
-	if err != nil {
-		log.Fatalf("Failed to merge plugins: %s\n", err)
-		os.Exit(1)
+	if changelogPath != "" {
+		diff, err := pluginPage.MergeWithDiff(&newPluginsPage)
+		if err != nil {
+			log.Fatalf("Failed to merge plugins: %s\n", err)
+			os.Exit(1)
+		}
+		log.Printf("Merged %d new plugins, changed %d existing plugins", len(diff.Added), len(diff.Changed))
+		writeChangelog(changelogPath, diff)
+	} else {
+		newCount, updatedCount, duplicateCount, err := pluginPage.Merge(&newPluginsPage)
+		if err != nil {
+			log.Fatalf("Failed to merge plugins: %s\n", err)
+			os.Exit(1)
+		}
+		log.Printf("Merged %d new plugins, updated %d existing plugins, ignored %d duplicate plugins", newCount, updatedCount, duplicateCount)
 	}
-	log.Printf("Merged %d new plugins, updated %d existing plugins, ignored %d duplicate plugins", newCount, updatedCount, duplicateCount)
 	log.Printf("Saving new plugins to %s\n", *filePath)
 	err = jfpr.Save(pluginPage)
 	if err != nil {
@@ -183,9 +438,647 @@ func UpdatePluginRepository(tac *querynessus.TenableApiClient, filePath *string)
 	log.Println("Complete")
 }
 
-func FetchAllFolders(tac *querynessus.TenableApiClient) {
+// loadEnricher loads the -epss and -kev feeds, returning nil if neither was
+// given.
+func loadEnricher(epssPath string, kevPath string) *querynessus.Enricher {
+	if epssPath == "" && kevPath == "" {
+		return nil
+	}
+	enricher := &querynessus.Enricher{}
+	if epssPath != "" {
+		feed, err := querynessus.LoadEPSSFile(epssPath)
+		if err != nil {
+			log.Fatalf("Failed to load EPSS scores: %s\n", err)
+			return nil
+		}
+		log.Printf("Loaded %d EPSS scores from %s", feed.Len(), epssPath)
+		enricher.EPSS = feed
+	}
+	if kevPath != "" {
+		catalog, err := querynessus.LoadKEVFile(kevPath)
+		if err != nil {
+			log.Fatalf("Failed to load KEV catalog: %s\n", err)
+			return nil
+		}
+		log.Printf("Loaded %d known exploited vulnerabilities from %s", len(catalog.Vulnerabilities), kevPath)
+		enricher.KEV = catalog
+	}
+	return enricher
+}
+
+func QueryPlugins(dbPath string, expression string, format string, enricher *querynessus.Enricher) {
+	filter, err := querynessus.ParsePluginFilter(expression)
+	if err != nil {
+		log.Fatalf("Invalid query: %s\n", err)
+		return
+	}
+	writer, err := NewPluginWriter(os.Stdout, format, enricher != nil)
+	if err != nil {
+		log.Fatalf("Failed to create output: %s\n", err)
+		return
+	}
+	matchCount := 0
+	writeMatch := func(plugin *querynessus.PluginDetails) error {
+		if enricher != nil {
+			enricher.Enrich(plugin)
+		}
+		if !filter.Match(plugin) {
+			return nil
+		}
+		matchCount += 1
+		return writer.Write(plugin)
+	}
+	if isBoltDatabase(dbPath) {
+		bpr, err := querynessus.NewBoltPluginRepository(dbPath)
+		if err != nil {
+			log.Fatalf("Failed to open plugin database %s: %s\n", dbPath, err)
+			return
+		}
+		defer bpr.Close()
+		err = bpr.ForEach(func(plugin querynessus.PluginDetails) error {
+			return writeMatch(&plugin)
+		})
+		if err != nil {
+			log.Fatalf("Failed to query plugin database %s: %s\n", dbPath, err)
+			return
+		}
+	} else {
+		jfpr, err := querynessus.NewJsonFilePluginRepository(dbPath)
+		if err != nil {
+			log.Fatalf("Failed to create Json repository from file %s: %s\n", dbPath, err)
+			return
+		}
+		pluginPage, err := jfpr.Load()
+		if err != nil {
+			log.Fatalf("Failed to load plugin page from file %s: %s\n", dbPath, err)
+			return
+		}
+		for i := range pluginPage.Data.PluginDetails {
+			if err := writeMatch(&pluginPage.Data.PluginDetails[i]); err != nil {
+				log.Fatalf("Failed to write plugin %d: %s\n", pluginPage.Data.PluginDetails[i].ID, err)
+				return
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		log.Fatalf("Failed to write query results: %s\n", err)
+		return
+	}
+	log.Printf("Found %d matching plugins in %s", matchCount, dbPath)
+}
+
+// openBoltSearchIndex loads the search index kept alongside a bolt plugin
+// database and brings it up to date with the database.
+func openBoltSearchIndex(bpr *querynessus.BoltPluginRepository, dbPath string) (*querynessus.SearchIndex, error) {
+	indexPath := querynessus.SearchIndexFilename(dbPath)
+	index := querynessus.NewSearchIndex()
+	if _, err := os.Stat(indexPath); err == nil {
+		index, err = querynessus.LoadSearchIndex(indexPath)
+		if err != nil {
+			log.Printf("Rebuilding search index: %s", err)
+			index = querynessus.NewSearchIndex()
+		}
+	}
+	present := map[int]struct{}{}
+	err := bpr.ForEach(func(plugin querynessus.PluginDetails) error {
+		present[plugin.ID] = struct{}{}
+		index.Add(&plugin)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	index.Retain(present)
+	if index.Modified() {
+		log.Printf("Saving search index to %s", indexPath)
+		if err := index.SaveToFile(indexPath); err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+// SearchPlugins prints the plugins best matching query, keeping only those
+// matching the -query expression if it isn't empty.
+func SearchPlugins(dbPath string, query string, expression string, format string, limit int, enricher *querynessus.Enricher) {
+	filter := parseOptionalFilter(expression)
+	writer, err := NewPluginWriter(os.Stdout, format, enricher != nil)
+	if err != nil {
+		log.Fatalf("Failed to create output: %s\n", err)
+		return
+	}
+	opts := &querynessus.SearchOptions{Limit: limit}
+	if filter != nil {
+		// Filter all the results, then limit them.
+		opts.Limit = 0
+	}
+	var results []querynessus.SearchResult
+	if isBoltDatabase(dbPath) {
+		bpr, err := querynessus.NewBoltPluginRepository(dbPath)
+		if err != nil {
+			log.Fatalf("Failed to open plugin database %s: %s\n", dbPath, err)
+			return
+		}
+		defer bpr.Close()
+		index, err := openBoltSearchIndex(bpr, dbPath)
+		if err != nil {
+			log.Fatalf("Failed to index plugin database %s: %s\n", dbPath, err)
+			return
+		}
+		hits, err := index.Search(query, opts)
+		if err != nil {
+			log.Fatalf("Invalid search: %s\n", err)
+			return
+		}
+		for _, hit := range hits {
+			plugin, exists, err := bpr.Get(hit.ID)
+			if err != nil {
+				log.Fatalf("Failed to read plugin %d: %s\n", hit.ID, err)
+				return
+			}
+			if exists {
+				results = append(results, querynessus.SearchResult{Plugin: plugin, Score: hit.Score})
+			}
+		}
+	} else {
+		jfpr, err := querynessus.NewJsonFilePluginRepository(dbPath)
+		if err != nil {
+			log.Fatalf("Failed to create Json repository from file %s: %s\n", dbPath, err)
+			return
+		}
+		pluginPage, err := jfpr.Load()
+		if err != nil {
+			log.Fatalf("Failed to load plugin page from file %s: %s\n", dbPath, err)
+			return
+		}
+		results, err = pluginPage.Search(query, opts)
+		if err != nil {
+			log.Fatalf("Invalid search: %s\n", err)
+			return
+		}
+		if index := pluginPage.Data.SearchIndex(); index.Modified() {
+			indexPath := querynessus.SearchIndexFilename(dbPath)
+			log.Printf("Saving search index to %s", indexPath)
+			if err := index.SaveToFile(indexPath); err != nil {
+				log.Printf("Failed to save search index to %s: %s\n", indexPath, err)
+			}
+		}
+	}
+	matchCount := 0
+	for i := range results {
+		if limit > 0 && matchCount >= limit {
+			break
+		}
+		if enricher != nil {
+			enricher.Enrich(&results[i].Plugin)
+		}
+		if filter != nil && !filter.Match(&results[i].Plugin) {
+			continue
+		}
+		matchCount += 1
+		if err := writer.Write(&results[i].Plugin); err != nil {
+			log.Fatalf("Failed to write plugin %d: %s\n", results[i].Plugin.ID, err)
+			return
+		}
+	}
+	if err := writer.Close(); err != nil {
+		log.Fatalf("Failed to write search results: %s\n", err)
+		return
+	}
+	log.Printf("Found %d matching plugins in %s", matchCount, dbPath)
+}
+
+// parseOptionalFilter parses the -query expression given alongside another
+// command, returning nil if there isn't one.
+func parseOptionalFilter(expression string) *querynessus.PluginFilter {
+	if expression == "" {
+		return nil
+	}
+	filter, err := querynessus.ParsePluginFilter(expression)
+	if err != nil {
+		log.Fatalf("Invalid query: %s\n", err)
+		return nil
+	}
+	return filter
+}
+
+// readLookupValues splits stdin on whitespace and commas.
+func readLookupValues(r io.Reader) ([]string, error) {
+	var values []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		values = append(values, strings.FieldsFunc(scanner.Text(), func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})...)
+	}
+	return values, scanner.Err()
+}
+
+// LookupPlugins prints the plugins detecting each CVE or xref in values,
+// keeping only those matching the -query expression if it isn't empty.
+func LookupPlugins(dbPath string, byXRef bool, values []string, expression string, format string, enricher *querynessus.Enricher) {
+	filter := parseOptionalFilter(expression)
+	if len(values) == 0 {
+		var err error
+		values, err = readLookupValues(os.Stdin)
+		if err != nil {
+			log.Fatalf("Failed to read from stdin: %s\n", err)
+			return
+		}
+	}
+	if len(values) == 0 {
+		log.Fatalf("Nothing to look up, pass CVEs or xrefs as arguments or on stdin\n")
+		return
+	}
+
+	var lookup querynessus.PluginLookup
+	if isBoltDatabase(dbPath) {
+		bpr, err := querynessus.NewBoltPluginRepository(dbPath)
+		if err != nil {
+			log.Fatalf("Failed to open plugin database %s: %s\n", dbPath, err)
+			return
+		}
+		defer bpr.Close()
+		lookup = bpr
+	} else {
+		jfpr, err := querynessus.NewJsonFilePluginRepository(dbPath)
+		if err != nil {
+			log.Fatalf("Failed to create Json repository from file %s: %s\n", dbPath, err)
+			return
+		}
+		lookup = jfpr
+	}
+
+	var results map[string][]querynessus.PluginDetails
+	var err error
+	if byXRef {
+		results, err = lookup.LookupByXRef(values...)
+	} else {
+		results, err = lookup.LookupByCVE(values...)
+	}
+	if err != nil {
+		log.Fatalf("Failed to look up plugins in %s: %s\n", dbPath, err)
+		return
+	}
+	for _, value := range values {
+		if enricher != nil {
+			enricher.EnrichAll(results[value])
+		}
+		if filter != nil {
+			matches := []querynessus.PluginDetails{}
+			for i := range results[value] {
+				if filter.Match(&results[value][i]) {
+					matches = append(matches, results[value][i])
+				}
+			}
+			results[value] = matches
+		}
+		if len(results[value]) == 0 {
+			log.Printf("No plugins found for %s", value)
+		}
+	}
+	if err := WriteLookupResults(os.Stdout, format, values, results, enricher != nil); err != nil {
+		log.Fatalf("Failed to write lookup results: %s\n", err)
+		return
+	}
+}
+
+// diffingRepository records the changes made by each Upsert in diff.
+type diffingRepository struct {
+	querynessus.IncrementalPluginRepository
+	diff *querynessus.PluginDiff
+}
+
+func (dr *diffingRepository) Upsert(plugins ...querynessus.PluginDetails) (int, int, int, error) {
+	for i := range plugins {
+		existing, exists, err := dr.Get(plugins[i].ID)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if !exists {
+			dr.diff.Add(nil, &plugins[i])
+		} else {
+			dr.diff.Add(&existing, &plugins[i])
+		}
+	}
+	return dr.IncrementalPluginRepository.Upsert(plugins...)
+}
+
+func loadPluginDatabase(dbPath string) (*querynessus.PluginListPage, error) {
+	if isBoltDatabase(dbPath) {
+		bpr, err := querynessus.NewBoltPluginRepository(dbPath)
+		if err != nil {
+			return nil, err
+		}
+		defer bpr.Close()
+		return bpr.Load()
+	}
+	jfpr, err := querynessus.NewJsonFilePluginRepository(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	return jfpr.Load()
+}
+
+func writeDiff(w io.Writer, diff *querynessus.PluginDiff, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	case "markdown", "table":
+		return diff.WriteMarkdown(w)
+	}
+	return fmt.Errorf("unknown diff format %q", format)
+}
+
+func writeChangelog(changelogPath string, diff *querynessus.PluginDiff) {
+	format := "markdown"
+	if strings.EqualFold(filepath.Ext(changelogPath), ".json") {
+		format = "json"
+	}
+	err := querynessus.WriteFileAtomic(changelogPath, 0644, func(w io.Writer) error {
+		return writeDiff(w, diff, format)
+	})
+	if err != nil {
+		log.Printf("Failed to write changelog to %s: %s\n", changelogPath, err)
+		return
+	}
+	log.Printf("Wrote changelog to %s", changelogPath)
+}
+
+func DiffPluginDatabases(oldPath string, newPath string, format string) {
+	oldPlugins, err := loadPluginDatabase(oldPath)
+	if err != nil {
+		log.Fatalf("Failed to load plugins from %s: %s\n", oldPath, err)
+		return
+	}
+	newPlugins, err := loadPluginDatabase(newPath)
+	if err != nil {
+		log.Fatalf("Failed to load plugins from %s: %s\n", newPath, err)
+		return
+	}
+	diff := querynessus.DiffPlugins(oldPlugins, newPlugins)
+	log.Printf("%d added, %d removed, %d changed plugins between %s and %s", len(diff.Added), len(diff.Removed), len(diff.Changed), oldPath, newPath)
+	if err := writeDiff(os.Stdout, diff, format); err != nil {
+		log.Fatalf("Failed to write diff: %s\n", err)
+		return
+	}
+}
+
+func PrintPluginHistory(dbPath string, pluginId int, expression string, format string) {
+	var filter *querynessus.PluginFilter
+	if expression != "" {
+		var err error
+		filter, err = querynessus.ParsePluginFilter(expression)
+		if err != nil {
+			log.Fatalf("Invalid query: %s\n", err)
+			return
+		}
+	}
+
+	var history *querynessus.PluginHistory
+	var current querynessus.PluginDetails
+	var exists bool
+	if isBoltDatabase(dbPath) {
+		bpr, err := querynessus.NewBoltPluginRepository(dbPath)
+		if err != nil {
+			log.Fatalf("Failed to open plugin database %s: %s\n", dbPath, err)
+			return
+		}
+		defer bpr.Close()
+		current, exists, err = bpr.Get(pluginId)
+		if err != nil {
+			log.Fatalf("Failed to read plugin %d: %s\n", pluginId, err)
+			return
+		}
+		history, err = bpr.History(pluginId)
+		if err != nil {
+			log.Fatalf("Failed to read history for plugin %d: %s\n", pluginId, err)
+			return
+		}
+	} else {
+		jfpr, err := querynessus.NewJsonFilePluginRepository(dbPath)
+		if err != nil {
+			log.Fatalf("Failed to create Json repository from file %s: %s\n", dbPath, err)
+			return
+		}
+		pluginPage, err := jfpr.Load()
+		if err != nil {
+			log.Fatalf("Failed to load plugin page from file %s: %s\n", dbPath, err)
+			return
+		}
+		plugin, _, found := pluginPage.Data.PluginFromId(pluginId)
+		current, exists = *plugin, found
+		history, err = jfpr.History(pluginId)
+		if err != nil {
+			log.Fatalf("Failed to read history for plugin %d: %s\n", pluginId, err)
+			return
+		}
+	}
+	if !exists && len(history.Revisions) == 0 {
+		log.Fatalf("Plugin %d not found in %s\n", pluginId, dbPath)
+		return
+	}
+
+	if filter != nil {
+		var currentPlugin *querynessus.PluginDetails
+		if exists {
+			currentPlugin = &current
+		}
+		matchedAt, matched := history.FirstMatch(filter, currentPlugin)
+		switch {
+		case !matched:
+			fmt.Printf("Plugin %d has never matched %s\n", pluginId, filter)
+		case matchedAt.IsZero():
+			fmt.Printf("Plugin %d already matched %s when first recorded\n", pluginId, filter)
+		default:
+			fmt.Printf("Plugin %d first matched %s at %s\n", pluginId, filter, matchedAt.Format(time.RFC3339))
+		}
+		return
+	}
+	if err := WriteHistory(os.Stdout, format, history); err != nil {
+		log.Fatalf("Failed to write history: %s\n", err)
+		return
+	}
+	log.Printf("Found %d recorded changes to plugin %d", len(history.Revisions), pluginId)
+}
+
+func RescorePlugins(dbPath string, env cvss.Environment, expression string, format string, limit int) {
+	if err := env.Validate(); err != nil {
+		log.Fatalf("Invalid environmental metrics: %s\n", err)
+		return
+	}
+	filter := parseOptionalFilter(expression)
+	pluginPage, err := loadPluginDatabase(dbPath)
+	if err != nil {
+		log.Fatalf("Failed to load plugins from %s: %s\n", dbPath, err)
+		return
+	}
+	var scores []cvss.PluginScore
+	unscored := 0
+	for i := range pluginPage.Data.PluginDetails {
+		plugin := &pluginPage.Data.PluginDetails[i]
+		if filter != nil && !filter.Match(plugin) {
+			continue
+		}
+		score, err := cvss.RescorePlugin(plugin, env)
+		if err != nil {
+			if !errors.Is(err, cvss.ErrNoVector) {
+				log.Printf("Skipping plugin %d: %s", plugin.ID, err)
+			}
+			unscored += 1
+			continue
+		}
+		scores = append(scores, score)
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].EnvironmentalScore > scores[j].EnvironmentalScore
+	})
+	log.Printf("Re-scored %d plugins, %d had no usable CVSS vector", len(scores), unscored)
+	if limit > 0 && len(scores) > limit {
+		scores = scores[:limit]
+	}
+	if err := WriteScores(os.Stdout, format, scores); err != nil {
+		log.Fatalf("Failed to write scores: %s\n", err)
+		return
+	}
+}
+
+// findingPrinter joins findings with their plugins from -db and prints
+// those whose plugin matches -query.
+type findingPrinter struct {
+	joiner     *querynessus.FindingJoiner
+	repository querynessus.PluginRepository
+	filter     *querynessus.PluginFilter
+	enricher   *querynessus.Enricher
+	writer     *FindingWriter
+	count      int
+}
+
+func newFindingPrinter(dbPath string, expression string, format string, enricher *querynessus.Enricher) *findingPrinter {
+	printer := &findingPrinter{enricher: enricher}
+	if expression != "" {
+		filter, err := querynessus.ParsePluginFilter(expression)
+		if err != nil {
+			log.Fatalf("Invalid query: %s\n", err)
+			return nil
+		}
+		printer.filter = filter
+	}
+	if isBoltDatabase(dbPath) {
+		bpr, err := querynessus.NewBoltPluginRepository(dbPath)
+		if err != nil {
+			log.Fatalf("Failed to open plugin database %s: %s\n", dbPath, err)
+			return nil
+		}
+		printer.repository = bpr
+	} else {
+		jfpr, err := querynessus.NewJsonFilePluginRepository(dbPath)
+		if err != nil {
+			log.Fatalf("Failed to create Json repository from file %s: %s\n", dbPath, err)
+			return nil
+		}
+		printer.repository = jfpr
+	}
+	joiner, err := querynessus.NewFindingJoiner(printer.repository)
+	if err != nil {
+		log.Fatalf("Failed to load plugin database %s: %s\n", dbPath, err)
+		return nil
+	}
+	printer.joiner = joiner
+	writer, err := NewFindingWriter(os.Stdout, format, enricher != nil)
+	if err != nil {
+		log.Fatalf("Failed to create output: %s\n", err)
+		return nil
+	}
+	printer.writer = writer
+	return printer
+}
+
+func (printer *findingPrinter) Print(finding *querynessus.Finding) error {
+	if err := printer.joiner.Join(finding); err != nil {
+		return err
+	}
+	// Findings of the same plugin share its details, so each plugin is
+	// only enriched once.
+	if printer.enricher != nil && finding.Plugin != nil && finding.Plugin.Enrichment == nil {
+		printer.enricher.Enrich(finding.Plugin)
+	}
+	if printer.filter != nil && (finding.Plugin == nil || !printer.filter.Match(finding.Plugin)) {
+		return nil
+	}
+	printer.count += 1
+	return printer.writer.Write(finding)
+}
+
+func (printer *findingPrinter) Close() {
+	if err := printer.writer.Close(); err != nil {
+		log.Fatalf("Failed to write findings: %s\n", err)
+		return
+	}
+	if bpr, ok := printer.repository.(*querynessus.BoltPluginRepository); ok {
+		bpr.Close()
+	}
+}
+
+func PrintFindings(exportPath string, dbPath string, expression string, format string, enricher *querynessus.Enricher) {
+	file, err := os.Open(exportPath)
+	if err != nil {
+		log.Fatalf("Failed to open %s: %s\n", exportPath, err)
+		return
+	}
+	defer file.Close()
+	reader, err := querynessus.NewFindingReader(file)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %s\n", exportPath, err)
+		return
+	}
+	defer reader.Close()
+	printer := newFindingPrinter(dbPath, expression, format, enricher)
+	for reader.Next() {
+		if err := printer.Print(reader.Finding()); err != nil {
+			log.Fatalf("Failed to print finding of plugin %d on %s: %s\n", reader.Finding().PluginID, reader.Finding().Host, err)
+			return
+		}
+	}
+	if err := reader.Err(); err != nil {
+		log.Fatalf("Failed to read %s: %s\n", exportPath, err)
+		return
+	}
+	printer.Close()
+	log.Printf("Printed %d findings from %s", printer.count, exportPath)
+}
+
+func PrintScanFindings(ctx context.Context, tac *querynessus.TenableApiClient, scanId int, dbPath string, expression string, format string, enricher *querynessus.Enricher) {
+	scanDetails, err := tac.FetchScanDetailsContext(ctx, scanId)
+	if err != nil {
+		log.Fatalf("Failed to fetch scan id %d: %s\n", scanId, err)
+		return
+	}
+	printer := newFindingPrinter(dbPath, expression, format, enricher)
+	for i, host := range scanDetails.Hosts {
+		log.Printf("Fetching findings for host %s (%d of %d)", host.Hostname, i+1, len(scanDetails.Hosts))
+		hostDetails, err := tac.FetchScanHostDetailsContext(ctx, scanId, host.HostID)
+		if err != nil {
+			log.Fatalf("Failed to fetch host %d of scan %d: %s\n", host.HostID, scanId, err)
+			return
+		}
+		findings := querynessus.FindingsFromHostDetails(scanDetails.Info.Name, &scanDetails.Hosts[i], hostDetails)
+		for j := range findings {
+			if err := printer.Print(&findings[j]); err != nil {
+				log.Fatalf("Failed to print finding of plugin %d on %s: %s\n", findings[j].PluginID, host.Hostname, err)
+				return
+			}
+		}
+	}
+	printer.Close()
+	log.Printf("Printed %d findings from scan %d", printer.count, scanId)
+}
+
+func FetchAllFolders(ctx context.Context, tac *querynessus.TenableApiClient) {
 	log.Printf("Fetching folder list")
-	folderCollection, err := tac.ListFolders()
+	folderCollection, err := tac.ListFoldersContext(ctx)
 	if err != nil {
 		log.Fatal("Failed to fetch list of folders\n")
 	}
@@ -194,8 +1087,8 @@ func FetchAllFolders(tac *querynessus.TenableApiClient) {
 	}
 }
 
-func FetchSingleScan(tac *querynessus.TenableApiClient, scanId *int) {
-	result, err := tac.FetchScanDetails(*scanId)
+func FetchSingleScan(ctx context.Context, tac *querynessus.TenableApiClient, scanId *int) {
+	result, err := tac.FetchScanDetailsContext(ctx, *scanId)
 	if err != nil {
 		log.Printf("Failed to fetch scan id %d: %s\n", *scanId, err)
 		os.Exit(1)
@@ -208,7 +1101,7 @@ func FetchSingleScan(tac *querynessus.TenableApiClient, scanId *int) {
 	fmt.Println(string(scanDetailsJson))
 }
 
-func FetchAllScans(tac *querynessus.TenableApiClient, since *string) {
+func FetchAllScans(ctx context.Context, tac *querynessus.TenableApiClient, since *string) {
 	params := querynessus.ScanParams{}
 
 	if *since != "" {
@@ -220,7 +1113,7 @@ func FetchAllScans(tac *querynessus.TenableApiClient, since *string) {
 		params.EarliestStartDate = int(timestamp.Unix())
 	}
 
-	scanPage, err := tac.ListScans(&params)
+	scanPage, err := tac.ListScansContext(ctx, &params)
 	if err != nil {
 		log.Fatalf("Failed to get all scans: %s", err)
 		return
@@ -233,19 +1126,42 @@ func FetchAllScans(tac *querynessus.TenableApiClient, since *string) {
 	}
 }
 
-func ExportScan(tac *querynessus.TenableApiClient, scanId *int, format *string) {
-	params := querynessus.ExportScanParams{}
-	payload := querynessus.ExportScanPayload{
-		Format: *format,
+func ExportScan(ctx context.Context, tac *querynessus.TenableApiClient, scanId *int, format *string, filterExpressions []string, matchAny bool, chapters string, outFile string, timeout time.Duration) {
+	opts := querynessus.ExportOptions{
+		Payload: querynessus.ExportScanPayload{
+			Format: *format,
+		},
+		OutFile:  outFile,
+		Timeout:  timeout,
+		Progress: logExportProgress(),
+	}
+	if len(filterExpressions) > 0 {
+		opts.Payload.Filters = &querynessus.ExportFilters{MatchAny: matchAny}
+		for _, expression := range filterExpressions {
+			filter, err := querynessus.ParseExportFilter(expression)
+			if err != nil {
+				log.Fatalf("%s\n", err)
+				return
+			}
+			opts.Payload.Filters.Add(filter)
+		}
+	}
+	if *format == "html" || *format == "pdf" {
+		exportChapters, err := querynessus.ParseExportChapters(chapters)
+		if err != nil {
+			log.Fatalf("Invalid -export-chapters: %s\n", err)
+			return
+		}
+		opts.Payload.Chapters = exportChapters
 	}
 	if *format == "db" {
-		scanDetails, err := tac.FetchScanDetails(*scanId)
+		scanDetails, err := tac.FetchScanDetailsContext(ctx, *scanId)
 		if err != nil {
 			log.Printf("Failed to fetch scan id %d: %s\n", *scanId, err)
 			os.Exit(1)
 		}
 		log.Printf("Found history UUID for scan %d: %s", *scanId, scanDetails.History[0].UUID)
-		params.HistoryID = scanDetails.Info.UUID
+		opts.Params.HistoryID = scanDetails.Info.UUID
 
 		password, err := random(12)
 		if err != nil {
@@ -253,33 +1169,38 @@ func ExportScan(tac *querynessus.TenableApiClient, scanId *int, format *string)
 			return
 		}
 		log.Printf("Database password set: %s", password)
-		payload.Password = password
-		payload.AssetID = scanDetails.Hosts[0].AssetID
+		opts.Payload.Password = password
+		opts.Payload.AssetID = scanDetails.Hosts[0].AssetID
 	}
 	log.Printf("Submitting export task to Tenable for scan %d\n", *scanId)
-	fileId, _, err := tac.ExportScanResults(&params, *scanId, &payload)
+	result, err := tac.ExportScan(ctx, *scanId, &opts)
 	if err != nil {
-		log.Fatalf("Failed to start export of scan %d: %s\n", *scanId, err)
+		log.Fatalf("Failed to export scan %d: %s\n", *scanId, err)
 		return
 	}
-	for {
-		time.Sleep(time.Second * 3)
-		log.Printf("Checking status for scan %d and file %s\n", *scanId, fileId)
-		isReady, err := tac.ScanResultExportStatus(*scanId, fileId)
-		if err != nil {
-			log.Fatalf("Failed to get status for scan %d and file %s: %s\n", *scanId, fileId, err)
-			return
-		}
-		if isReady {
-			break
+	log.Printf("Successfully downloaded %s (%d bytes)\n", result.OutFile, result.Bytes)
+}
+
+// logExportProgress logs each status check of an export and its download
+// progress at most every few seconds.
+func logExportProgress() func(querynessus.ExportProgress) {
+	var lastLogged time.Time
+	return func(progress querynessus.ExportProgress) {
+		switch progress.Stage {
+		case querynessus.ExportRequested:
+			log.Printf("Export of scan %d started as file %s\n", progress.ScanID, progress.FileID)
+		case querynessus.ExportWaiting:
+			log.Printf("Export of scan %d is %s after %s\n", progress.ScanID, progress.Status, progress.Elapsed.Round(time.Second))
+		case querynessus.ExportDownloading:
+			if time.Since(lastLogged) < 5*time.Second {
+				return
+			}
+			lastLogged = time.Now()
+			if progress.TotalBytes > 0 {
+				log.Printf("Downloaded %d of %d bytes (%d%%)\n", progress.Bytes, progress.TotalBytes, progress.Bytes*100/progress.TotalBytes)
+			} else {
+				log.Printf("Downloaded %d bytes\n", progress.Bytes)
+			}
 		}
 	}
-	outFile := fmt.Sprintf("%d-%s.%s", *scanId, fileId, payload.Format)
-	err = tac.DownloadExportedScan(*scanId, fileId, outFile)
-	if err != nil {
-		log.Fatalf("Failed to write to %s: %s\n", outFile, err)
-		return
-	}
-	log.Fatalf("Successfully downloaded %s\n", outFile)
-
 }
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CarbonRook/go-querynessus/querynessus"
+	"github.com/CarbonRook/go-querynessus/querynessus/cvss"
+	"github.com/CarbonRook/go-querynessus/querynessus/nessusxml"
+)
+
+var permittedOutputFormats = map[string]bool{"table": true, "json": true, "csv": true, "markdown": true}
+
+var pluginTableHeader = []string{"ID", "Name", "Family", "Risk", "CVSSv3", "VPR", "CVEs"}
+
+// enrichmentTableHeader is added to tables of plugins enriched with -epss
+// or -kev.
+var enrichmentTableHeader = []string{"EPSS", "KEV", "KEV Due"}
+
+func pluginTableColumns(enriched bool) []string {
+	header := append([]string{}, pluginTableHeader...)
+	if enriched {
+		header = append(header, enrichmentTableHeader...)
+	}
+	return header
+}
+
+func pluginTableRow(plugin *querynessus.PluginDetails, enriched bool) []string {
+	row := []string{
+		strconv.Itoa(plugin.ID),
+		plugin.Name,
+		plugin.FamilyName,
+		plugin.Attributes.RiskFactor,
+		formatScore(plugin.Attributes.CVSSv3BaseScore),
+		formatScore(plugin.Attributes.VPR.Score),
+		strings.Join(plugin.Attributes.CVE, " "),
+	}
+	if enriched {
+		row = append(row, enrichmentRow(plugin.Enrichment)...)
+	}
+	return row
+}
+
+func enrichmentRow(enrichment *querynessus.PluginEnrichment) []string {
+	if enrichment == nil {
+		return []string{"", "", ""}
+	}
+	epss := ""
+	if enrichment.EPSSCVE != "" {
+		epss = strconv.FormatFloat(enrichment.EPSSScore, 'f', -1, 64)
+	}
+	kev := ""
+	if enrichment.KEV {
+		kev = "yes"
+	}
+	return []string{epss, kev, enrichment.KEVDueDate}
+}
+
+func formatScore(score float32) string {
+	if score == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(score), 'f', 1, 32)
+}
+
+// PluginWriter writes plugins to the terminal one at a time in the format
+// chosen with -output.
+type PluginWriter interface {
+	Write(plugin *querynessus.PluginDetails) error
+	Close() error
+}
+
+// NewPluginWriter writes plugins in format. Tables and CSV get EPSS and KEV
+// columns when enriched is true.
+func NewPluginWriter(w io.Writer, format string, enriched bool) (PluginWriter, error) {
+	switch format {
+	case "table":
+		return &tablePluginWriter{writer: tabwriter.NewWriter(w, 0, 4, 2, ' ', 0), enriched: enriched}, nil
+	case "csv":
+		return &csvPluginWriter{writer: csv.NewWriter(w), enriched: enriched}, nil
+	case "json":
+		return &jsonPluginWriter{writer: w}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+type tablePluginWriter struct {
+	writer        *tabwriter.Writer
+	enriched      bool
+	headerWritten bool
+}
+
+func (tpw *tablePluginWriter) writeRow(row []string) error {
+	for i, cell := range row {
+		// Tabs and newlines would break the column layout.
+		row[i] = strings.Join(strings.Fields(cell), " ")
+	}
+	_, err := fmt.Fprintln(tpw.writer, strings.Join(row, "\t"))
+	return err
+}
+
+func (tpw *tablePluginWriter) Write(plugin *querynessus.PluginDetails) error {
+	if !tpw.headerWritten {
+		tpw.headerWritten = true
+		if err := tpw.writeRow(pluginTableColumns(tpw.enriched)); err != nil {
+			return err
+		}
+	}
+	return tpw.writeRow(pluginTableRow(plugin, tpw.enriched))
+}
+
+func (tpw *tablePluginWriter) Close() error {
+	return tpw.writer.Flush()
+}
+
+type csvPluginWriter struct {
+	writer        *csv.Writer
+	enriched      bool
+	headerWritten bool
+}
+
+func (cpw *csvPluginWriter) Write(plugin *querynessus.PluginDetails) error {
+	if !cpw.headerWritten {
+		cpw.headerWritten = true
+		if err := cpw.writer.Write(pluginTableColumns(cpw.enriched)); err != nil {
+			return err
+		}
+	}
+	return cpw.writer.Write(pluginTableRow(plugin, cpw.enriched))
+}
+
+func (cpw *csvPluginWriter) Close() error {
+	if !cpw.headerWritten {
+		cpw.headerWritten = true
+		if err := cpw.writer.Write(pluginTableColumns(cpw.enriched)); err != nil {
+			return err
+		}
+	}
+	cpw.writer.Flush()
+	return cpw.writer.Error()
+}
+
+type jsonPluginWriter struct {
+	writer io.Writer
+	count  int
+}
+
+func (jpw *jsonPluginWriter) Write(plugin *querynessus.PluginDetails) error {
+	return jpw.writeValue(plugin)
+}
+
+// writeValue writes v as the next element of the JSON array.
+func (jpw *jsonPluginWriter) writeValue(v interface{}) error {
+	valueJson, err := json.MarshalIndent(v, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	separator := "[\n  "
+	if jpw.count > 0 {
+		separator = ",\n  "
+	}
+	jpw.count += 1
+	if _, err := io.WriteString(jpw.writer, separator); err != nil {
+		return err
+	}
+	_, err = jpw.writer.Write(valueJson)
+	return err
+}
+
+func (jpw *jsonPluginWriter) Close() error {
+	closing := "\n]\n"
+	if jpw.count == 0 {
+		closing = "[]\n"
+	}
+	_, err := io.WriteString(jpw.writer, closing)
+	return err
+}
+
+var findingTableHeader = []string{"Host", "Port", "Plugin ID", "Name", "Risk", "CVSSv3", "VPR", "CVEs"}
+
+func findingTableRow(finding *querynessus.Finding, enriched bool) []string {
+	port := ""
+	if finding.Protocol != "" {
+		port = fmt.Sprintf("%d/%s", finding.Port, finding.Protocol)
+	}
+	cvss3, vpr, cves := "", "", finding.CVE
+	if finding.Plugin != nil {
+		cvss3 = formatScore(finding.Plugin.Attributes.CVSSv3BaseScore)
+		vpr = formatScore(finding.Plugin.Attributes.VPR.Score)
+		cves = finding.Plugin.Attributes.CVE
+	}
+	row := []string{
+		finding.Host,
+		port,
+		strconv.Itoa(finding.PluginID),
+		finding.PluginName,
+		nessusxml.SeverityRiskFactor(finding.Severity),
+		cvss3,
+		vpr,
+		strings.Join(cves, " "),
+	}
+	if enriched {
+		var enrichment *querynessus.PluginEnrichment
+		if finding.Plugin != nil {
+			enrichment = finding.Plugin.Enrichment
+		}
+		row = append(row, enrichmentRow(enrichment)...)
+	}
+	return row
+}
+
+// FindingWriter writes findings to the terminal one at a time in the format
+// chosen with -output, so large exports aren't held in memory.
+type FindingWriter struct {
+	table    *tablePluginWriter
+	csv      *csvPluginWriter
+	json     *jsonPluginWriter
+	enriched bool
+}
+
+// NewFindingWriter writes findings in format. Tables and CSV get EPSS and
+// KEV columns when enriched is true.
+func NewFindingWriter(w io.Writer, format string, enriched bool) (*FindingWriter, error) {
+	fw := &FindingWriter{enriched: enriched}
+	switch format {
+	case "table":
+		fw.table = &tablePluginWriter{writer: tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)}
+	case "csv":
+		fw.csv = &csvPluginWriter{writer: csv.NewWriter(w)}
+	case "json":
+		fw.json = &jsonPluginWriter{writer: w}
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+	return fw, nil
+}
+
+func (fw *FindingWriter) header() []string {
+	header := append([]string{}, findingTableHeader...)
+	if fw.enriched {
+		header = append(header, enrichmentTableHeader...)
+	}
+	return header
+}
+
+func (fw *FindingWriter) Write(finding *querynessus.Finding) error {
+	switch {
+	case fw.json != nil:
+		return fw.json.writeValue(finding)
+	case fw.table != nil:
+		if !fw.table.headerWritten {
+			fw.table.headerWritten = true
+			if err := fw.table.writeRow(fw.header()); err != nil {
+				return err
+			}
+		}
+		return fw.table.writeRow(findingTableRow(finding, fw.enriched))
+	}
+	if !fw.csv.headerWritten {
+		fw.csv.headerWritten = true
+		if err := fw.csv.writer.Write(fw.header()); err != nil {
+			return err
+		}
+	}
+	return fw.csv.writer.Write(findingTableRow(finding, fw.enriched))
+}
+
+func (fw *FindingWriter) Close() error {
+	switch {
+	case fw.json != nil:
+		return fw.json.Close()
+	case fw.table != nil:
+		return fw.table.Close()
+	}
+	if !fw.csv.headerWritten {
+		fw.csv.headerWritten = true
+		if err := fw.csv.writer.Write(fw.header()); err != nil {
+			return err
+		}
+	}
+	fw.csv.writer.Flush()
+	return fw.csv.writer.Error()
+}
+
+var lookupTableHeader = []string{"Query", "ID", "Name", "Family", "CVSSv2", "CVSSv3"}
+
+type lookupPlugin struct {
+	ID              int     `json:"id"`
+	Name            string  `json:"name"`
+	FamilyName      string  `json:"family_name"`
+	CVSSv2BaseScore float32 `json:"cvss_base_score,omitempty"`
+	CVSSv3BaseScore float32 `json:"cvss3_base_score,omitempty"`
+
+	Enrichment *querynessus.PluginEnrichment `json:"enrichment,omitempty"`
+}
+
+type lookupResult struct {
+	Query   string         `json:"query"`
+	Plugins []lookupPlugin `json:"plugins"`
+}
+
+// WriteLookupResults prints the plugins found for each query, in the order
+// the queries were given, with EPSS and KEV columns when enriched is true.
+func WriteLookupResults(w io.Writer, format string, queries []string, results map[string][]querynessus.PluginDetails, enriched bool) error {
+	lookupResults := make([]lookupResult, 0, len(queries))
+	for _, query := range queries {
+		result := lookupResult{Query: query, Plugins: []lookupPlugin{}}
+		for _, plugin := range results[query] {
+			result.Plugins = append(result.Plugins, lookupPlugin{
+				ID:              plugin.ID,
+				Name:            plugin.Name,
+				FamilyName:      plugin.FamilyName,
+				CVSSv2BaseScore: plugin.Attributes.CVSSv2BaseScore,
+				CVSSv3BaseScore: plugin.Attributes.CVSSv3BaseScore,
+				Enrichment:      plugin.Enrichment,
+			})
+		}
+		lookupResults = append(lookupResults, result)
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(lookupResults)
+	}
+
+	var rows [][]string
+	for _, result := range lookupResults {
+		for _, plugin := range result.Plugins {
+			row := []string{
+				result.Query,
+				strconv.Itoa(plugin.ID),
+				plugin.Name,
+				plugin.FamilyName,
+				formatScore(plugin.CVSSv2BaseScore),
+				formatScore(plugin.CVSSv3BaseScore),
+			}
+			if enriched {
+				row = append(row, enrichmentRow(plugin.Enrichment)...)
+			}
+			rows = append(rows, row)
+		}
+	}
+	header := lookupTableHeader
+	if enriched {
+		header = append(append([]string{}, header...), enrichmentTableHeader...)
+	}
+	return writeRows(w, format, header, rows)
+}
+
+var historyTableHeader = []string{"Observed", "Field", "Old", "New"}
+
+func formatHistoryValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return fmt.Sprint(value)
+}
+
+// WriteHistory prints one row per changed field of every revision.
+func WriteHistory(w io.Writer, format string, history *querynessus.PluginHistory) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(history)
+	}
+
+	var rows [][]string
+	for _, revision := range history.Revisions {
+		observed := revision.ObservedAt.Format(time.RFC3339)
+		if len(revision.Changes) == 0 {
+			rows = append(rows, []string{observed, "(untracked fields)", "", ""})
+			continue
+		}
+		for _, change := range revision.Changes {
+			oldValue, newValue := formatHistoryValue(change.Old), formatHistoryValue(change.New)
+			if change.Added != nil || change.Removed != nil {
+				oldValue, newValue = strings.Join(change.Removed, " "), strings.Join(change.Added, " ")
+			}
+			rows = append(rows, []string{observed, change.Field, oldValue, newValue})
+		}
+	}
+	return writeRows(w, format, historyTableHeader, rows)
+}
+
+var scoreTableHeader = []string{"ID", "Name", "CVSS", "Base", "Temporal", "Environmental", "Severity", "Vector"}
+
+func WriteScores(w io.Writer, format string, scores []cvss.PluginScore) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if scores == nil {
+			scores = []cvss.PluginScore{}
+		}
+		return encoder.Encode(scores)
+	}
+
+	rows := make([][]string, 0, len(scores))
+	for _, score := range scores {
+		rows = append(rows, []string{
+			strconv.Itoa(score.ID),
+			score.Name,
+			score.Version,
+			strconv.FormatFloat(score.BaseScore, 'f', 1, 64),
+			strconv.FormatFloat(score.TemporalScore, 'f', 1, 64),
+			strconv.FormatFloat(score.EnvironmentalScore, 'f', 1, 64),
+			score.Severity,
+			score.Vector,
+		})
+	}
+	return writeRows(w, format, scoreTableHeader, rows)
+}
+
+// writeRows prints rows under header as an aligned table or as CSV.
+func writeRows(w io.Writer, format string, header []string, rows [][]string) error {
+	switch format {
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write(header)
+		writer.WriteAll(rows)
+		return writer.Error()
+	case "table":
+		writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.Join(header, "\t"))
+		for _, row := range rows {
+			for i, cell := range row {
+				row[i] = strings.Join(strings.Fields(cell), " ")
+			}
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		return writer.Flush()
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
@@ -2,4 +2,9 @@ module github.com/CarbonRook/go-querynessus
 
 go 1.17
 
-require github.com/google/go-querystring v1.1.0 // indirect
+require (
+	github.com/google/go-querystring v1.1.0
+	github.com/klauspost/compress v1.15.15
+	go.etcd.io/bbolt v1.3.9
+	golang.org/x/sys v0.4.0
+)
@@ -0,0 +1,88 @@
+package querynessus
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic passes write a temporary file next to filename, syncs it
+// to disk and renames it over filename, so readers see either the old or the
+// new contents and never a partial write.
+func WriteFileAtomic(filename string, perm os.FileMode, write func(io.Writer) error) (err error) {
+	dir := filepath.Dir(filename)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(filename)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = write(tmp); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), filename); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func backupName(filename string, generation int) string {
+	return fmt.Sprintf("%s.%d", filename, generation)
+}
+
+// rotateBackups shifts filename.1 .. filename.N-1 up one generation and
+// makes the current filename the new filename.1.
+func rotateBackups(filename string, count int) error {
+	if count < 1 {
+		return nil
+	}
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+	for generation := count - 1; generation >= 1; generation-- {
+		err := os.Rename(backupName(filename, generation), backupName(filename, generation+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	newest := backupName(filename, 1)
+	os.Remove(newest)
+	// A hard link keeps filename in place until the new version is renamed
+	// over it. Fall back to copying on filesystems without links.
+	if err := os.Link(filename, newest); err == nil {
+		return nil
+	}
+	return copyFile(filename, newest)
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(dst, info.Mode().Perm(), func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
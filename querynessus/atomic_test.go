@@ -0,0 +1,69 @@
+package querynessus
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dirEntries lists the names of the files in dir.
+func dirEntries(t *testing.T, dir string) []string {
+	t.Helper()
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "plugins.json")
+	err := WriteFileAtomic(filename, 0600, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(filename); string(data) != "new" {
+		t.Errorf("file contains %q, want new", data)
+	}
+	if info, err := os.Stat(filename); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("file has mode %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+	if names := dirEntries(t, dir); len(names) != 1 {
+		t.Errorf("directory contains %v, want only plugins.json", names)
+	}
+}
+
+func TestWriteFileAtomicFailureLeavesFileUntouched(t *testing.T) {
+	errWrite := errors.New("write failed")
+	for _, name := range []string{"plugins.json", "plugins.json.gz", "plugins.json.zst"} {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := writeCompressedFileAtomic(filename, 0644, func(w io.Writer) error {
+			io.WriteString(w, "partial")
+			return errWrite
+		})
+		if !errors.Is(err, errWrite) {
+			t.Errorf("%s: write returned %v, want errWrite", name, err)
+		}
+		if data, _ := ioutil.ReadFile(filename); string(data) != "old" {
+			t.Errorf("%s: file contains %q after a failed write, want old", name, data)
+		}
+		if names := dirEntries(t, dir); len(names) != 1 || names[0] != name {
+			t.Errorf("%s: directory contains %v after a failed write, want no temporary files", name, names)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package querynessus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltPluginsBucket   = []byte("plugins")
+	boltMetaBucket      = []byte("meta")
+	boltCVEIndexBucket  = []byte("cve_index")
+	boltXRefIndexBucket = []byte("xref_index")
+	boltHistoryBucket   = []byte("history")
+	boltParamsKey       = []byte("params")
+	boltLookupIndexKey  = []byte("lookup_index")
+)
+
+// boltLookupIndexVersion is stored under boltLookupIndexKey once the CVE and
+// xref indexes have been built. Bump it to rebuild them on open.
+const boltLookupIndexVersion = "1"
+
+// BoltPluginRepository stores one record per plugin in an embedded bbolt
+// database, so updates only rewrite the plugins that changed and single
+// plugins can be read without loading the whole catalogue.
+type BoltPluginRepository struct {
+	filename string
+	db       *bolt.DB
+}
+
+func NewBoltPluginRepository(filename string) (*BoltPluginRepository, error) {
+	db, err := bolt.Open(filename, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin database %s: %w", filename, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltPluginsBucket, boltMetaBucket, boltCVEIndexBucket, boltXRefIndexBucket, boltHistoryBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		if string(tx.Bucket(boltMetaBucket).Get(boltLookupIndexKey)) != boltLookupIndexVersion {
+			return rebuildBoltLookupIndexes(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise plugin database %s: %w", filename, err)
+	}
+	return &BoltPluginRepository{
+		filename: filename,
+		db:       db,
+	}, nil
+}
+
+func (bpr *BoltPluginRepository) Close() error {
+	return bpr.db.Close()
+}
+
+func (bpr *BoltPluginRepository) ModTime() (time.Time, error) {
+	info, err := os.Stat(bpr.filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+func boltPluginKey(id int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+func (bpr *BoltPluginRepository) Load() (*PluginListPage, error) {
+	pluginPage := &PluginListPage{}
+	err := bpr.db.View(func(tx *bolt.Tx) error {
+		if params := tx.Bucket(boltMetaBucket).Get(boltParamsKey); params != nil {
+			if err := json.Unmarshal(params, &pluginPage.Params); err != nil {
+				return err
+			}
+		}
+		plugins := tx.Bucket(boltPluginsBucket)
+		pluginPage.Data.PluginDetails = make([]PluginDetails, 0, plugins.Stats().KeyN)
+		return plugins.ForEach(func(_, value []byte) error {
+			var plugin PluginDetails
+			if err := json.Unmarshal(value, &plugin); err != nil {
+				return err
+			}
+			pluginPage.Data.PluginDetails = append(pluginPage.Data.PluginDetails, plugin)
+			return nil
+		})
+	})
+	if err != nil {
+		return &PluginListPage{}, err
+	}
+	pluginPage.Size = len(pluginPage.Data.PluginDetails)
+	pluginPage.TotalCount = pluginPage.Size
+	return pluginPage, nil
+}
+
+// Save replaces the contents of the database with plugins, only writing
+// plugins that differ from the stored copy.
+func (bpr *BoltPluginRepository) Save(plugins *PluginListPage) error {
+	return bpr.db.Update(func(tx *bolt.Tx) error {
+		params, err := json.Marshal(plugins.Params)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltMetaBucket).Put(boltParamsKey, params); err != nil {
+			return err
+		}
+		keep := make(map[int]bool, len(plugins.Data.PluginDetails))
+		for _, plugin := range plugins.Data.PluginDetails {
+			keep[plugin.ID] = true
+			if _, err := upsertBoltPlugin(tx, plugin); err != nil {
+				return err
+			}
+		}
+		bucket := tx.Bucket(boltPluginsBucket)
+		var stale [][]byte
+		err = bucket.ForEach(func(key, _ []byte) error {
+			if !keep[int(binary.BigEndian.Uint64(key))] {
+				stale = append(stale, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range stale {
+			if err := deleteBoltPlugin(tx, int(binary.BigEndian.Uint64(key))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type upsertResult int
+
+const (
+	upsertNew upsertResult = iota
+	upsertUpdated
+	upsertDuplicate
+)
+
+func upsertBoltPlugin(tx *bolt.Tx, plugin PluginDetails) (upsertResult, error) {
+	bucket := tx.Bucket(boltPluginsBucket)
+	key := boltPluginKey(plugin.ID)
+	result := upsertNew
+	if existing := bucket.Get(key); existing != nil {
+		var existingPlugin PluginDetails
+		if err := json.Unmarshal(existing, &existingPlugin); err != nil {
+			return result, fmt.Errorf("failed to decode stored plugin %d: %w", plugin.ID, err)
+		}
+		if !pluginChanged(&existingPlugin, &plugin) {
+			return upsertDuplicate, nil
+		}
+		if err := unindexBoltPlugin(tx, &existingPlugin); err != nil {
+			return result, err
+		}
+		if revision := newPluginRevision(&existingPlugin, &plugin, time.Now()); len(revision.Changes) > 0 {
+			if err := recordBoltRevision(tx, revision); err != nil {
+				return result, err
+			}
+		}
+		result = upsertUpdated
+	}
+	value, err := json.Marshal(plugin)
+	if err != nil {
+		return result, err
+	}
+	if err := bucket.Put(key, value); err != nil {
+		return result, err
+	}
+	return result, indexBoltPlugin(tx, &plugin)
+}
+
+func deleteBoltPlugin(tx *bolt.Tx, id int) error {
+	bucket := tx.Bucket(boltPluginsBucket)
+	key := boltPluginKey(id)
+	existing := bucket.Get(key)
+	if existing == nil {
+		return nil
+	}
+	var existingPlugin PluginDetails
+	if err := json.Unmarshal(existing, &existingPlugin); err != nil {
+		return fmt.Errorf("failed to decode stored plugin %d: %w", id, err)
+	}
+	if err := unindexBoltPlugin(tx, &existingPlugin); err != nil {
+		return err
+	}
+	return bucket.Delete(key)
+}
+
+// boltLookupKey is the index key for a plugin with a CVE or xref: the
+// normalised value, a zero byte and the plugin's key, so every plugin for a
+// value can be found with a prefix scan.
+func boltLookupKey(value string, id int) []byte {
+	return append(append([]byte(value), 0), boltPluginKey(id)...)
+}
+
+func boltLookupKeys(plugin *PluginDetails) map[string][][]byte {
+	keys := map[string][][]byte{}
+	for _, cve := range plugin.Attributes.CVE {
+		if cve = normaliseCVE(cve); cve != "" {
+			keys[string(boltCVEIndexBucket)] = append(keys[string(boltCVEIndexBucket)], boltLookupKey(cve, plugin.ID))
+		}
+	}
+	for _, xref := range pluginXRefs(plugin) {
+		keys[string(boltXRefIndexBucket)] = append(keys[string(boltXRefIndexBucket)], boltLookupKey(xref, plugin.ID))
+	}
+	return keys
+}
+
+func indexBoltPlugin(tx *bolt.Tx, plugin *PluginDetails) error {
+	for bucketName, keys := range boltLookupKeys(plugin) {
+		bucket := tx.Bucket([]byte(bucketName))
+		for _, key := range keys {
+			if err := bucket.Put(key, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func unindexBoltPlugin(tx *bolt.Tx, plugin *PluginDetails) error {
+	for bucketName, keys := range boltLookupKeys(plugin) {
+		bucket := tx.Bucket([]byte(bucketName))
+		for _, key := range keys {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rebuildBoltLookupIndexes indexes every stored plugin, for databases
+// created before the indexes existed.
+func rebuildBoltLookupIndexes(tx *bolt.Tx) error {
+	for _, bucketName := range [][]byte{boltCVEIndexBucket, boltXRefIndexBucket} {
+		if err := tx.DeleteBucket(bucketName); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucket(bucketName); err != nil {
+			return err
+		}
+	}
+	err := tx.Bucket(boltPluginsBucket).ForEach(func(_, value []byte) error {
+		var plugin PluginDetails
+		if err := json.Unmarshal(value, &plugin); err != nil {
+			return err
+		}
+		return indexBoltPlugin(tx, &plugin)
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(boltMetaBucket).Put(boltLookupIndexKey, []byte(boltLookupIndexVersion))
+}
+
+// lookupBolt returns the plugins indexed under each value in bucketName.
+func (bpr *BoltPluginRepository) lookupBolt(bucketName []byte, normalise func(string) string, values []string) (map[string][]PluginDetails, error) {
+	results := make(map[string][]PluginDetails, len(values))
+	err := bpr.db.View(func(tx *bolt.Tx) error {
+		plugins := tx.Bucket(boltPluginsBucket)
+		cursor := tx.Bucket(bucketName).Cursor()
+		for _, value := range values {
+			matches := []PluginDetails{}
+			prefix := append([]byte(normalise(value)), 0)
+			for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+				stored := plugins.Get(key[len(prefix):])
+				if stored == nil {
+					continue
+				}
+				var plugin PluginDetails
+				if err := json.Unmarshal(stored, &plugin); err != nil {
+					return err
+				}
+				matches = append(matches, plugin)
+			}
+			results[value] = matches
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (bpr *BoltPluginRepository) LookupByCVE(cves ...string) (map[string][]PluginDetails, error) {
+	return bpr.lookupBolt(boltCVEIndexBucket, normaliseCVE, cves)
+}
+
+func (bpr *BoltPluginRepository) LookupByXRef(xrefs ...string) (map[string][]PluginDetails, error) {
+	return bpr.lookupBolt(boltXRefIndexBucket, normaliseXRef, xrefs)
+}
+
+// Upsert adds or replaces plugins in a single transaction, with the same
+// counts as PluginListPage.Merge.
+func (bpr *BoltPluginRepository) Upsert(plugins ...PluginDetails) (newCount int, updatedCount int, duplicateCount int, err error) {
+	err = bpr.db.Update(func(tx *bolt.Tx) error {
+		for _, plugin := range plugins {
+			result, err := upsertBoltPlugin(tx, plugin)
+			if err != nil {
+				return err
+			}
+			switch result {
+			case upsertNew:
+				newCount += 1
+			case upsertUpdated:
+				updatedCount += 1
+			case upsertDuplicate:
+				duplicateCount += 1
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return newCount, updatedCount, duplicateCount, nil
+}
+
+func (bpr *BoltPluginRepository) Get(id int) (PluginDetails, bool, error) {
+	var plugin PluginDetails
+	found := false
+	err := bpr.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltPluginsBucket).Get(boltPluginKey(id))
+		if value == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(value, &plugin)
+	})
+	if err != nil {
+		return PluginDetails{}, false, err
+	}
+	return plugin, found, nil
+}
+
+func (bpr *BoltPluginRepository) Delete(ids ...int) error {
+	return bpr.db.Update(func(tx *bolt.Tx) error {
+		for _, id := range ids {
+			if err := deleteBoltPlugin(tx, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (bpr *BoltPluginRepository) Count() (int, error) {
+	count := 0
+	err := bpr.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(boltPluginsBucket).Stats().KeyN
+		return nil
+	})
+	return count, err
+}
+
+// ForEach calls fn for every stored plugin in ID order without loading the
+// whole database. Returning an error from fn stops the iteration and is
+// returned from ForEach.
+func (bpr *BoltPluginRepository) ForEach(fn func(PluginDetails) error) error {
+	return bpr.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltPluginsBucket).ForEach(func(_, value []byte) error {
+			var plugin PluginDetails
+			if err := json.Unmarshal(value, &plugin); err != nil {
+				return err
+			}
+			return fn(plugin)
+		})
+	})
+}
+
+func (bpr *BoltPluginRepository) LatestModifiedDate() (time.Time, error) {
+	lastModifiedTime := time.Time{}
+	err := bpr.ForEach(func(plugin PluginDetails) error {
+		pluginLastModifiedTime, err := time.Parse(time.RFC3339, plugin.Attributes.PluginModificationDate)
+		if err != nil {
+			return err
+		}
+		if lastModifiedTime.IsZero() || pluginLastModifiedTime.After(lastModifiedTime) {
+			lastModifiedTime = pluginLastModifiedTime
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return lastModifiedTime, nil
+}
+
+// recordBoltRevision stores a revision under the plugin's key followed by a
+// sequence number, so a plugin's history can be read with a prefix scan.
+func recordBoltRevision(tx *bolt.Tx, revision PluginRevision) error {
+	bucket := tx.Bucket(boltHistoryBucket)
+	sequence, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(revision)
+	if err != nil {
+		return err
+	}
+	key := append(boltPluginKey(revision.ID), boltPluginKey(int(sequence))...)
+	return bucket.Put(key, value)
+}
+
+func (bpr *BoltPluginRepository) History(id int) (*PluginHistory, error) {
+	history := &PluginHistory{ID: id, Revisions: []PluginRevision{}}
+	err := bpr.db.View(func(tx *bolt.Tx) error {
+		prefix := boltPluginKey(id)
+		cursor := tx.Bucket(boltHistoryBucket).Cursor()
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			var revision PluginRevision
+			if err := json.Unmarshal(value, &revision); err != nil {
+				return err
+			}
+			history.Revisions = append(history.Revisions, revision)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	history.sort()
+	return history, nil
+}
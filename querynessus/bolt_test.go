@@ -0,0 +1,181 @@
+package querynessus
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestBoltRepository(t *testing.T) *BoltPluginRepository {
+	t.Helper()
+	repo, err := NewBoltPluginRepository(filepath.Join(t.TempDir(), "plugins.bolt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+// boltIndexKeyCount is the number of entries in one of the lookup index
+// buckets.
+func boltIndexKeyCount(t *testing.T, repo *BoltPluginRepository, bucketName []byte) int {
+	t.Helper()
+	count := 0
+	err := repo.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(bucketName).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func assertBoltLookup(t *testing.T, lookup func(...string) (map[string][]PluginDetails, error), value string, want ...int) {
+	t.Helper()
+	results, err := lookup(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := pluginIDs(results[value]); !reflect.DeepEqual(ids, append([]int{}, want...)) {
+		t.Errorf("lookup of %s found %v, want %v", value, ids, want)
+	}
+}
+
+func TestBoltUpsertCounts(t *testing.T) {
+	repo := newTestBoltRepository(t)
+	plugins := indexTestPlugins().PluginDetails
+
+	for _, test := range []struct {
+		name                        string
+		plugins                     []PluginDetails
+		wantNew, wantUpd, wantDupes int
+	}{
+		{"first", plugins, 2, 0, 0},
+		{"again", plugins, 0, 0, 2},
+		{"mixed", []PluginDetails{
+			{ID: 1, Name: "Log4Shell (renamed)", FamilyName: "Misc."},
+			plugins[1],
+			{ID: 3, Name: "EternalBlue"},
+		}, 1, 1, 1},
+		{"empty", nil, 0, 0, 0},
+	} {
+		newCount, updatedCount, duplicateCount, err := repo.Upsert(test.plugins...)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if newCount != test.wantNew || updatedCount != test.wantUpd || duplicateCount != test.wantDupes {
+			t.Errorf("%s: Upsert returned %d, %d, %d, want %d, %d, %d", test.name,
+				newCount, updatedCount, duplicateCount, test.wantNew, test.wantUpd, test.wantDupes)
+		}
+	}
+	if count, err := repo.Count(); err != nil || count != 3 {
+		t.Errorf("Count returned %d, %v, want 3", count, err)
+	}
+}
+
+func TestBoltUpsertMaintainsLookupIndexes(t *testing.T) {
+	repo := newTestBoltRepository(t)
+	plugin := PluginDetails{ID: 1, Name: "Log4Shell"}
+	plugin.Attributes.CVE = []string{"CVE-2021-44228", "CVE-2021-45046"}
+	plugin.Attributes.XRef = []string{"IAVA:2021-A-0573", "CISA-KNOWN-EXPLOITED:2021/12/24"}
+	if _, _, _, err := repo.Upsert(plugin, indexTestPlugins().PluginDetails[1]); err != nil {
+		t.Fatal(err)
+	}
+	assertBoltLookup(t, repo.LookupByCVE, "cve-2021-45046", 1)
+	assertBoltLookup(t, repo.LookupByXRef, "iava : 2021-a-0573", 1)
+	assertBoltLookup(t, repo.LookupByCVE, "CVE-2022-3602", 2)
+
+	// The plugin loses a CVE and an xref.
+	plugin.Attributes.CVE = []string{"CVE-2021-44228"}
+	plugin.Attributes.XRef = []string{"IAVA:2021-A-0573"}
+	if _, updatedCount, _, err := repo.Upsert(plugin); err != nil || updatedCount != 1 {
+		t.Fatalf("Upsert returned %d updated, %v, want 1", updatedCount, err)
+	}
+	assertBoltLookup(t, repo.LookupByCVE, "CVE-2021-45046")
+	assertBoltLookup(t, repo.LookupByXRef, "CISA-KNOWN-EXPLOITED:2021/12/24")
+	assertBoltLookup(t, repo.LookupByCVE, "CVE-2021-44228", 1)
+	assertBoltLookup(t, repo.LookupByXRef, "IAVA:2021-A-0573", 1)
+	if count := boltIndexKeyCount(t, repo, boltCVEIndexBucket); count != 2 {
+		t.Errorf("CVE index has %d entries, want 2", count)
+	}
+	if count := boltIndexKeyCount(t, repo, boltXRefIndexBucket); count != 1 {
+		t.Errorf("xref index has %d entries, want 1", count)
+	}
+
+	if err := repo.Delete(1, 2, 99); err != nil {
+		t.Fatal(err)
+	}
+	assertBoltLookup(t, repo.LookupByCVE, "CVE-2021-44228")
+	for _, bucketName := range [][]byte{boltCVEIndexBucket, boltXRefIndexBucket} {
+		if count := boltIndexKeyCount(t, repo, bucketName); count != 0 {
+			t.Errorf("%s has %d entries after deleting every plugin", bucketName, count)
+		}
+	}
+}
+
+func TestBoltLookupIndexesSurviveReopening(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "plugins.bolt")
+	repo, err := NewBoltPluginRepository(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := repo.Upsert(indexTestPlugins().PluginDetails...); err != nil {
+		t.Fatal(err)
+	}
+	repo.Close()
+
+	repo, err = NewBoltPluginRepository(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	assertBoltLookup(t, repo.LookupByCVE, "CVE-2021-44228", 1)
+	assertBoltLookup(t, repo.LookupByXRef, "IAVA:2021-A-0573", 1)
+}
+
+func TestBoltGet(t *testing.T) {
+	repo := newTestBoltRepository(t)
+	if _, _, _, err := repo.Upsert(indexTestPlugins().PluginDetails...); err != nil {
+		t.Fatal(err)
+	}
+
+	plugin, found, err := repo.Get(2)
+	if err != nil || !found || plugin.Name != "OpenSSL" {
+		t.Errorf("Get(2) returned %q, %v, %v, want OpenSSL", plugin.Name, found, err)
+	}
+	plugin, found, err = repo.Get(99)
+	if err != nil || found || !reflect.DeepEqual(plugin, PluginDetails{}) {
+		t.Errorf("Get of a missing plugin returned %+v, %v, %v", plugin, found, err)
+	}
+}
+
+func TestBoltForEach(t *testing.T) {
+	repo := newTestBoltRepository(t)
+	// Plugin keys sort numerically rather than as text.
+	if _, _, _, err := repo.Upsert(PluginDetails{ID: 300}, PluginDetails{ID: 20}, PluginDetails{ID: 1000}); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int
+	err := repo.ForEach(func(plugin PluginDetails) error {
+		ids = append(ids, plugin.ID)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(ids, []int{20, 300, 1000}) {
+		t.Errorf("ForEach visited %v, %v, want [20 300 1000]", ids, err)
+	}
+
+	errStop := errors.New("stop")
+	visited := 0
+	err = repo.ForEach(func(plugin PluginDetails) error {
+		visited += 1
+		return errStop
+	})
+	if !errors.Is(err, errStop) || visited != 1 {
+		t.Errorf("ForEach returned %v after %d plugins, want errStop after 1", err, visited)
+	}
+}
@@ -0,0 +1,123 @@
+package querynessus
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZstd
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// CompressionFromFilename picks the compression for a file being written
+// from its extension, e.g. plugins.json.gz or plugins.json.zst.
+func CompressionFromFilename(filename string) Compression {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".gz", ".gzip":
+		return CompressionGzip
+	case ".zst", ".zstd":
+		return CompressionZstd
+	}
+	return CompressionNone
+}
+
+// NewDecompressingReader detects gzip or zstd data from its magic bytes and
+// returns a reader of the decompressed stream. Uncompressed data is passed
+// through unchanged. Closing the reader does not close r.
+func NewDecompressingReader(r io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return gzip.NewReader(buffered)
+	case bytes.HasPrefix(header, zstdMagic):
+		decoder, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return ioutil.NopCloser(buffered), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// NewCompressingWriter compresses everything written to it into w. Close
+// must be called to flush the compressed stream; it does not close w.
+func NewCompressingWriter(w io.Writer, compression Compression) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	}
+	return nopWriteCloser{w}, nil
+}
+
+type decompressedFile struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (df decompressedFile) Close() error {
+	err := df.ReadCloser.Close()
+	if closeErr := df.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func openDecompressed(filename string) (io.ReadCloser, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewDecompressingReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return decompressedFile{ReadCloser: reader, file: file}, nil
+}
+
+// writeCompressedFileAtomic is WriteFileAtomic with the compression implied
+// by filename's extension.
+func writeCompressedFileAtomic(filename string, perm os.FileMode, write func(io.Writer) error) error {
+	return WriteFileAtomic(filename, perm, func(w io.Writer) error {
+		compressed, err := NewCompressingWriter(w, CompressionFromFilename(filename))
+		if err != nil {
+			return err
+		}
+		if err := write(compressed); err != nil {
+			compressed.Close()
+			return err
+		}
+		return compressed.Close()
+	})
+}
@@ -0,0 +1,118 @@
+package querynessus
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte(`{"id":19506,"name":"Nessus Scan Information"}`), 100)
+	for _, test := range []struct {
+		name        string
+		compression Compression
+		magic       []byte
+	}{
+		{"none", CompressionNone, []byte(`{"id"`)},
+		{"gzip", CompressionGzip, gzipMagic},
+		{"zstd", CompressionZstd, zstdMagic},
+	} {
+		var compressed bytes.Buffer
+		writer, err := NewCompressingWriter(&compressed, test.compression)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if _, err := writer.Write(payload); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !bytes.HasPrefix(compressed.Bytes(), test.magic) {
+			t.Errorf("%s: output starts % x, want % x", test.name, compressed.Bytes()[:4], test.magic)
+		}
+
+		reader, err := NewDecompressingReader(&compressed)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		decompressed, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !bytes.Equal(decompressed, payload) {
+			t.Errorf("%s: round trip returned %d bytes, want the %d written", test.name, len(decompressed), len(payload))
+		}
+	}
+}
+
+func TestNewDecompressingReaderShortInput(t *testing.T) {
+	for _, input := range []string{"", "{", "[]"} {
+		reader, err := NewDecompressingReader(bytes.NewReader([]byte(input)))
+		if err != nil {
+			t.Fatalf("%q: %v", input, err)
+		}
+		if data, err := ioutil.ReadAll(reader); err != nil || string(data) != input {
+			t.Errorf("%q: read %q, %v", input, data, err)
+		}
+	}
+}
+
+func TestCompressionFromFilename(t *testing.T) {
+	for filename, want := range map[string]Compression{
+		"plugins.json":      CompressionNone,
+		"plugins.json.gz":   CompressionGzip,
+		"plugins.json.GZIP": CompressionGzip,
+		"plugins.json.zst":  CompressionZstd,
+		"plugins.json.zstd": CompressionZstd,
+		"plugins.gz.json":   CompressionNone,
+	} {
+		if got := CompressionFromFilename(filename); got != want {
+			t.Errorf("CompressionFromFilename(%q) = %d, want %d", filename, got, want)
+		}
+	}
+}
+
+// Files are written compressed according to their extension but read
+// according to their contents, so a renamed file still loads.
+func TestOpenDecompressedDetectsContentNotExtension(t *testing.T) {
+	dir := t.TempDir()
+	for _, test := range []struct{ written, renamed string }{
+		{"plain.json", "plain.json.gz"},
+		{"plain.json", "plain.json.zst"},
+		{"gzipped.json.gz", "gzipped.json"},
+		{"gzipped.json.gz", "gzipped.json.zst"},
+		{"zstd.json.zst", "zstd.json"},
+		{"zstd.json.zst", "zstd.json.gz"},
+	} {
+		written := filepath.Join(dir, test.written)
+		err := writeCompressedFileAtomic(written, 0644, func(w io.Writer) error {
+			_, err := io.WriteString(w, `{"size":1}`)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(written)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renamed := filepath.Join(dir, "copy-of-"+test.renamed)
+		if err := ioutil.WriteFile(renamed, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		file, err := openDecompressed(renamed)
+		if err != nil {
+			t.Fatalf("%s renamed %s: %v", test.written, test.renamed, err)
+		}
+		contents, err := ioutil.ReadAll(file)
+		file.Close()
+		if err != nil || string(contents) != `{"size":1}` {
+			t.Errorf("%s renamed %s read %q, %v", test.written, test.renamed, contents, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Package cvss parses CVSS v2, v3 and v4 vector strings and calculates
+// their base, temporal (threat for v4) and environmental scores as defined
+// by FIRST, so plugins can be re-scored with environmental modifiers for
+// the assets they were found on.
+package cvss
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	ErrInvalidVector = errors.New("invalid CVSS vector")
+	// ErrNoVector is returned when re-scoring a plugin without a vector for
+	// the requested CVSS version.
+	ErrNoVector = errors.New("no CVSS vector")
+)
+
+// metric describes one metric of a vector: its abbreviation, the values it
+// accepts with their weights and whether it must be present.
+type metric struct {
+	name       string
+	values     map[string]float64
+	required   bool
+	notDefined string
+}
+
+// metricSet is the metrics of one CVSS version in canonical order.
+type metricSet []metric
+
+func (metrics metricSet) lookup(name string) (metric, bool) {
+	for _, m := range metrics {
+		if m.name == name {
+			return m, true
+		}
+	}
+	return metric{}, false
+}
+
+// parseMetrics splits a vector like AV:N/AC:L into metric values, checking
+// each against metrics. Only metrics accepted by allowed may appear.
+func parseMetrics(vector string, metrics metricSet, allowed func(metric) bool) (map[string]string, error) {
+	values := map[string]string{}
+	if vector == "" {
+		return values, nil
+	}
+	for _, part := range strings.Split(vector, "/") {
+		colon := strings.IndexByte(part, ':')
+		if colon < 0 {
+			return nil, fmt.Errorf("%w: %q is not a metric:value pair", ErrInvalidVector, part)
+		}
+		name, value := part[:colon], part[colon+1:]
+		m, ok := metrics.lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown metric %s", ErrInvalidVector, name)
+		}
+		if !allowed(m) {
+			return nil, fmt.Errorf("%w: base metric %s can't be modified", ErrInvalidVector, name)
+		}
+		if _, ok := m.values[value]; !ok {
+			return nil, fmt.Errorf("%w: %s is not a valid value for %s", ErrInvalidVector, value, name)
+		}
+		if _, duplicate := values[name]; duplicate {
+			return nil, fmt.Errorf("%w: %s is given more than once", ErrInvalidVector, name)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+func checkRequired(values map[string]string, metrics metricSet) error {
+	for _, m := range metrics {
+		if _, ok := values[m.name]; m.required && !ok {
+			return fmt.Errorf("%w: missing base metric %s", ErrInvalidVector, m.name)
+		}
+	}
+	return nil
+}
+
+// formatMetrics writes values in canonical order, leaving out metrics that
+// aren't defined.
+func formatMetrics(values map[string]string, metrics metricSet) string {
+	var parts []string
+	for _, m := range metrics {
+		value, ok := values[m.name]
+		if !ok || (!m.required && value == m.notDefined) {
+			continue
+		}
+		parts = append(parts, m.name+":"+value)
+	}
+	return strings.Join(parts, "/")
+}
+
+// Severity is the qualitative rating of a CVSS v3 or v4 score: None, Low,
+// Medium, High or Critical.
+func Severity(score float64) string {
+	switch {
+	case score == 0:
+		return "None"
+	case score < 4:
+		return "Low"
+	case score < 7:
+		return "Medium"
+	case score < 9:
+		return "High"
+	}
+	return "Critical"
+}
+
+// SeverityV2 is the qualitative rating NVD uses for CVSS v2 scores: Low,
+// Medium or High.
+func SeverityV2(score float64) string {
+	switch {
+	case score < 4:
+		return "Low"
+	case score < 7:
+		return "Medium"
+	}
+	return "High"
+}
+
+func roundToOneDecimal(value float64) float64 {
+	return math.Round(value*10) / 10
+}
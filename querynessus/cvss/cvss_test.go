@@ -0,0 +1,136 @@
+package cvss
+
+import "testing"
+
+// Reference scores from the examples in the FIRST specifications and the
+// FIRST calculators. Environmental cases that set modified base metrics
+// are checked against the base score of the vector they describe.
+func TestV2Scores(t *testing.T) {
+	for _, test := range []struct {
+		vector                        string
+		base, temporal, environmental float64
+	}{
+		// CVE-2002-0392, CVE-2003-0818 and CVE-2003-0062 from the v2 guide.
+		{"AV:N/AC:L/Au:N/C:N/I:N/A:C", 7.8, 7.8, 7.8},
+		{"AV:N/AC:L/Au:N/C:N/I:N/A:C/E:F/RL:OF/RC:C", 7.8, 6.4, 6.4},
+		{"AV:N/AC:L/Au:N/C:N/I:N/A:C/E:F/RL:OF/RC:C/CDP:H/TD:H/CR:M/IR:M/AR:H", 7.8, 6.4, 9.2},
+		{"AV:N/AC:L/Au:N/C:C/I:C/A:C/E:F/RL:OF/RC:C/CDP:H/TD:H/CR:M/IR:M/AR:L", 10.0, 8.3, 9.0},
+		{"AV:L/AC:H/Au:N/C:C/I:C/A:C/E:POC/RL:OF/RC:C/CDP:H/TD:H/CR:M/IR:M/AR:M", 6.2, 4.9, 7.5},
+		{"(AV:N/AC:M/Au:N/C:P/I:P/A:P)", 6.8, 6.8, 6.8},
+		{"CVSS2#AV:N/AC:L/Au:S/C:N/I:P/A:N/TD:N", 4.0, 4.0, 0},
+	} {
+		v, err := ParseV2(test.vector)
+		if err != nil {
+			t.Errorf("ParseV2(%q): %s", test.vector, err)
+			continue
+		}
+		if base, temporal, environmental := v.BaseScore(), v.TemporalScore(), v.EnvironmentalScore(); base != test.base || temporal != test.temporal || environmental != test.environmental {
+			t.Errorf("%s scored %.1f/%.1f/%.1f, want %.1f/%.1f/%.1f", test.vector, base, temporal, environmental, test.base, test.temporal, test.environmental)
+		}
+	}
+}
+
+func TestV3Scores(t *testing.T) {
+	for _, test := range []struct {
+		vector                        string
+		base, temporal, environmental float64
+	}{
+		// CVE-2013-1937 and CVE-2014-0160 from the v3.0 examples.
+		{"CVSS:3.0/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N", 6.1, 6.1, 6.1},
+		{"CVSS:3.0/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:N/A:N/E:H/RL:O/RC:C", 7.5, 7.2, 7.2},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", 9.8, 9.8, 9.8},
+		{"CVSS:3.1/AV:N/AC:L/PR:L/UI:N/S:C/C:L/I:L/A:N", 6.4, 6.4, 6.4},
+		{"CVSS:3.1/AV:L/AC:L/PR:H/UI:N/S:U/C:H/I:H/A:H", 6.7, 6.7, 6.7},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:N", 0, 0, 0},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H/E:P/RL:O/RC:C", 9.8, 8.8, 8.8},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H/MAV:L/MPR:H", 9.8, 9.8, 6.7},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H/CR:L/IR:L/AR:L", 9.8, 9.8, 8.0},
+		{"AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", 9.8, 9.8, 9.8},
+		// The modified impact for a changed scope differs between 3.0 and
+		// 3.1.
+		{"CVSS:3.0/AV:A/AC:L/PR:H/UI:N/S:U/C:H/I:H/A:H/MS:C", 6.8, 6.8, 8.4},
+		{"CVSS:3.1/AV:A/AC:L/PR:H/UI:N/S:U/C:H/I:H/A:H/MS:C", 6.8, 6.8, 8.5},
+	} {
+		v, err := ParseV3(test.vector)
+		if err != nil {
+			t.Errorf("ParseV3(%q): %s", test.vector, err)
+			continue
+		}
+		if base, temporal, environmental := v.BaseScore(), v.TemporalScore(), v.EnvironmentalScore(); base != test.base || temporal != test.temporal || environmental != test.environmental {
+			t.Errorf("%s scored %.1f/%.1f/%.1f, want %.1f/%.1f/%.1f", test.vector, base, temporal, environmental, test.base, test.temporal, test.environmental)
+		}
+	}
+}
+
+func TestV4Scores(t *testing.T) {
+	for _, test := range []struct {
+		vector                      string
+		base, threat, environmental float64
+	}{
+		{"CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N", 9.3, 9.3, 9.3},
+		{"CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:N/VA:N/SC:N/SI:N/SA:N", 8.7, 8.7, 8.7},
+		{"CVSS:4.0/AV:L/AC:L/AT:N/PR:L/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N", 8.5, 8.5, 8.5},
+		{"CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:A/VC:N/VI:N/VA:N/SC:L/SI:L/SA:N", 5.1, 5.1, 5.1},
+		{"CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:N/VI:N/VA:N/SC:N/SI:N/SA:N", 0, 0, 0},
+		{"CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N/E:U", 9.3, 8.1, 8.1},
+		{"CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N/E:A", 9.3, 9.3, 9.3},
+		{"CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N/MAV:N/CR:H", 9.3, 9.3, 9.3},
+		{"CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N/MVI:N/MVA:N", 9.3, 9.3, 8.7},
+		{"CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N/MAV:L/MPR:L", 9.3, 9.3, 8.5},
+		{"AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N/S:P/U:Red", 9.3, 9.3, 9.3},
+	} {
+		v, err := ParseV4(test.vector)
+		if err != nil {
+			t.Errorf("ParseV4(%q): %s", test.vector, err)
+			continue
+		}
+		if base, threat, environmental := v.BaseScore(), v.ThreatScore(), v.EnvironmentalScore(); base != test.base || threat != test.threat || environmental != test.environmental {
+			t.Errorf("%s scored %.1f/%.1f/%.1f, want %.1f/%.1f/%.1f", test.vector, base, threat, environmental, test.base, test.threat, test.environmental)
+		}
+	}
+}
+
+func TestParseRejectsInvalidVectors(t *testing.T) {
+	for _, vector := range []string{
+		"AV:N/AC:L/Au:N/C:P/I:P",
+		"AV:N/AC:L/Au:N/C:P/I:P/A:P/E:X",
+	} {
+		if _, err := ParseV2(vector); err == nil {
+			t.Errorf("ParseV2(%q) succeeded", vector)
+		}
+	}
+	for _, vector := range []string{
+		"CVSS:3.2/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H",
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H",
+		"CVSS:3.1/AV:N/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H",
+	} {
+		if _, err := ParseV3(vector); err == nil {
+			t.Errorf("ParseV3(%q) succeeded", vector)
+		}
+	}
+	for _, vector := range []string{
+		"CVSS:3.1/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N",
+		"CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H",
+	} {
+		if _, err := ParseV4(vector); err == nil {
+			t.Errorf("ParseV4(%q) succeeded", vector)
+		}
+	}
+}
+
+func TestWithMetricsKeepsBaseMetrics(t *testing.T) {
+	v, err := ParseV3("CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.WithMetrics("AV:L"); err == nil {
+		t.Error("WithMetrics changed a base metric")
+	}
+	modified, err := v.WithMetrics("MAV:L/MPR:H")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modified.EnvironmentalScore() != 6.7 || v.EnvironmentalScore() != 9.8 {
+		t.Errorf("environmental scores %.1f and %.1f, want 6.7 and the original 9.8", modified.EnvironmentalScore(), v.EnvironmentalScore())
+	}
+}
@@ -0,0 +1,153 @@
+package cvss
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/CarbonRook/go-querynessus/querynessus"
+)
+
+// joinVectors appends a temporal vector to a base vector, skipping either
+// when empty.
+func joinVectors(base string, temporal string) string {
+	base, temporal = strings.TrimSpace(base), strings.TrimSpace(temporal)
+	switch {
+	case temporal == "":
+		return base
+	case base == "":
+		return temporal
+	}
+	return base + "/" + temporal
+}
+
+// PluginV4 parses a plugin's CVSS v4 base and threat vectors.
+func PluginV4(plugin *querynessus.PluginDetails) (*V4, error) {
+	attributes := &plugin.Attributes
+	if strings.TrimSpace(attributes.CVSSv4Vector.VectorString) == "" {
+		return nil, fmt.Errorf("plugin %d: %w v4", plugin.ID, ErrNoVector)
+	}
+	threat := strings.TrimPrefix(strings.TrimSpace(attributes.CVSSv4ThreatVector.VectorString), "CVSS:4.0/")
+	vector, err := ParseV4(joinVectors(attributes.CVSSv4Vector.VectorString, threat))
+	if err != nil {
+		return nil, fmt.Errorf("plugin %d: %w", plugin.ID, err)
+	}
+	return vector, nil
+}
+
+// PluginV3 parses a plugin's CVSS v3 base and temporal vectors.
+func PluginV3(plugin *querynessus.PluginDetails) (*V3, error) {
+	attributes := &plugin.Attributes
+	if strings.TrimSpace(attributes.CVSSv3Vector.VectorString) == "" {
+		return nil, fmt.Errorf("plugin %d: %w v3", plugin.ID, ErrNoVector)
+	}
+	vector, err := ParseV3(joinVectors(attributes.CVSSv3Vector.VectorString, attributes.CVSSv3TemporalVector.VectorString))
+	if err != nil {
+		return nil, fmt.Errorf("plugin %d: %w", plugin.ID, err)
+	}
+	return vector, nil
+}
+
+// PluginV2 parses a plugin's CVSS v2 base and temporal vectors.
+func PluginV2(plugin *querynessus.PluginDetails) (*V2, error) {
+	attributes := &plugin.Attributes
+	if strings.TrimSpace(attributes.CVSSv2Vector.VectorString) == "" {
+		return nil, fmt.Errorf("plugin %d: %w v2", plugin.ID, ErrNoVector)
+	}
+	temporal := strings.TrimPrefix(strings.TrimSpace(attributes.CVSSv2TemporalVector.VectorString), "CVSS2#")
+	vector, err := ParseV2(joinVectors(attributes.CVSSv2Vector.VectorString, temporal))
+	if err != nil {
+		return nil, fmt.Errorf("plugin %d: %w", plugin.ID, err)
+	}
+	return vector, nil
+}
+
+// Environment holds the environmental metrics to apply when re-scoring,
+// e.g. V3 "MAV:A/CR:H" for an internal-only asset holding sensitive data.
+// Temporal metrics may be given too and override the plugin's own.
+type Environment struct {
+	V4 string
+	V3 string
+	V2 string
+}
+
+// Validate checks the metrics in env without needing a plugin to apply
+// them to.
+func (env Environment) Validate() error {
+	if _, err := (&V4{}).WithMetrics(env.V4); err != nil {
+		return fmt.Errorf("v4 environment: %w", err)
+	}
+	if _, err := (&V3{Version: "3.1"}).WithMetrics(env.V3); err != nil {
+		return fmt.Errorf("v3 environment: %w", err)
+	}
+	if _, err := (&V2{}).WithMetrics(env.V2); err != nil {
+		return fmt.Errorf("v2 environment: %w", err)
+	}
+	return nil
+}
+
+// PluginScore is a plugin's score under an Environment, taken from the
+// newest CVSS version the plugin has a vector for. For v4 the temporal
+// score is the threat score.
+type PluginScore struct {
+	ID                 int     `json:"id"`
+	Name               string  `json:"name"`
+	Version            string  `json:"version"`
+	Vector             string  `json:"vector"`
+	BaseScore          float64 `json:"base_score"`
+	TemporalScore      float64 `json:"temporal_score"`
+	EnvironmentalScore float64 `json:"environmental_score"`
+	Severity           string  `json:"severity"`
+}
+
+// RescorePlugin scores plugin with the environmental metrics in env.
+func RescorePlugin(plugin *querynessus.PluginDetails, env Environment) (PluginScore, error) {
+	score := PluginScore{ID: plugin.ID, Name: plugin.Name}
+	if v4, err := PluginV4(plugin); err == nil {
+		v4, err = v4.WithMetrics(env.V4)
+		if err != nil {
+			return score, fmt.Errorf("v4 environment: %w", err)
+		}
+		score.Version = "4.0"
+		score.Vector = v4.String()
+		score.BaseScore = v4.BaseScore()
+		score.TemporalScore = v4.ThreatScore()
+		score.EnvironmentalScore = v4.EnvironmentalScore()
+		score.Severity = Severity(score.EnvironmentalScore)
+		return score, nil
+	} else if !errors.Is(err, ErrNoVector) {
+		return score, err
+	}
+
+	if v3, err := PluginV3(plugin); err == nil {
+		v3, err = v3.WithMetrics(env.V3)
+		if err != nil {
+			return score, fmt.Errorf("v3 environment: %w", err)
+		}
+		score.Version = v3.Version
+		score.Vector = v3.String()
+		score.BaseScore = v3.BaseScore()
+		score.TemporalScore = v3.TemporalScore()
+		score.EnvironmentalScore = v3.EnvironmentalScore()
+		score.Severity = Severity(score.EnvironmentalScore)
+		return score, nil
+	} else if !errors.Is(err, ErrNoVector) {
+		return score, err
+	}
+
+	v2, err := PluginV2(plugin)
+	if err != nil {
+		return score, err
+	}
+	v2, err = v2.WithMetrics(env.V2)
+	if err != nil {
+		return score, fmt.Errorf("v2 environment: %w", err)
+	}
+	score.Version = "2.0"
+	score.Vector = v2.String()
+	score.BaseScore = v2.BaseScore()
+	score.TemporalScore = v2.TemporalScore()
+	score.EnvironmentalScore = v2.EnvironmentalScore()
+	score.Severity = SeverityV2(score.EnvironmentalScore)
+	return score, nil
+}
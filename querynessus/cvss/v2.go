@@ -0,0 +1,133 @@
+package cvss
+
+import (
+	"math"
+	"strings"
+)
+
+var (
+	v2Impact      = map[string]float64{"N": 0, "P": 0.275, "C": 0.660}
+	v2Requirement = map[string]float64{"ND": 1, "L": 0.5, "M": 1, "H": 1.51}
+)
+
+var v2Metrics = metricSet{
+	{name: "AV", values: map[string]float64{"L": 0.395, "A": 0.646, "N": 1}, required: true},
+	{name: "AC", values: map[string]float64{"H": 0.35, "M": 0.61, "L": 0.71}, required: true},
+	{name: "Au", values: map[string]float64{"M": 0.45, "S": 0.56, "N": 0.704}, required: true},
+	{name: "C", values: v2Impact, required: true},
+	{name: "I", values: v2Impact, required: true},
+	{name: "A", values: v2Impact, required: true},
+	{name: "E", values: map[string]float64{"ND": 1, "U": 0.85, "POC": 0.9, "F": 0.95, "H": 1}, notDefined: "ND"},
+	{name: "RL", values: map[string]float64{"ND": 1, "OF": 0.87, "TF": 0.9, "W": 0.95, "U": 1}, notDefined: "ND"},
+	{name: "RC", values: map[string]float64{"ND": 1, "UC": 0.9, "UR": 0.95, "C": 1}, notDefined: "ND"},
+	{name: "CDP", values: map[string]float64{"ND": 0, "N": 0, "L": 0.1, "LM": 0.3, "MH": 0.4, "H": 0.5}, notDefined: "ND"},
+	{name: "TD", values: map[string]float64{"ND": 1, "N": 0, "L": 0.25, "M": 0.75, "H": 1}, notDefined: "ND"},
+	{name: "CR", values: v2Requirement, notDefined: "ND"},
+	{name: "IR", values: v2Requirement, notDefined: "ND"},
+	{name: "AR", values: v2Requirement, notDefined: "ND"},
+}
+
+// V2 is a parsed CVSS v2 vector.
+type V2 struct {
+	metrics map[string]string
+}
+
+// ParseV2 parses a vector such as AV:N/AC:L/Au:N/C:P/I:P/A:P. The CVSS2#
+// prefix Tenable uses and the parentheses NVD uses are accepted.
+// Temporal and environmental metrics are optional.
+func ParseV2(vector string) (*V2, error) {
+	vector = strings.TrimSpace(vector)
+	vector = strings.TrimPrefix(vector, "CVSS2#")
+	if strings.HasPrefix(vector, "(") && strings.HasSuffix(vector, ")") {
+		vector = vector[1 : len(vector)-1]
+	}
+	metrics, err := parseMetrics(vector, v2Metrics, func(metric) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRequired(metrics, v2Metrics); err != nil {
+		return nil, err
+	}
+	return &V2{metrics: metrics}, nil
+}
+
+// WithMetrics returns a copy of the vector with the temporal and
+// environmental metrics in modifiers, e.g. "CDP:L/TD:M/CR:H", added or
+// replaced. Base metrics can't be modified.
+func (v *V2) WithMetrics(modifiers string) (*V2, error) {
+	values, err := parseMetrics(strings.TrimSpace(modifiers), v2Metrics, func(m metric) bool {
+		return !m.required
+	})
+	if err != nil {
+		return nil, err
+	}
+	modified := &V2{metrics: make(map[string]string, len(v.metrics)+len(values))}
+	for name, value := range v.metrics {
+		modified.metrics[name] = value
+	}
+	for name, value := range values {
+		modified.metrics[name] = value
+	}
+	return modified, nil
+}
+
+// Metric returns the value of a metric, or "ND" for a temporal or
+// environmental metric that isn't set.
+func (v *V2) Metric(name string) string {
+	if value, ok := v.metrics[name]; ok {
+		return value
+	}
+	return "ND"
+}
+
+func (v *V2) String() string {
+	return formatMetrics(v.metrics, v2Metrics)
+}
+
+func (v *V2) weight(name string) float64 {
+	m, _ := v2Metrics.lookup(name)
+	return m.values[v.Metric(name)]
+}
+
+func (v *V2) baseScore(impact float64) float64 {
+	exploitability := v.ExploitabilitySubScore()
+	fImpact := 0.0
+	if impact != 0 {
+		fImpact = 1.176
+	}
+	return roundToOneDecimal((0.6*impact + 0.4*exploitability - 1.5) * fImpact)
+}
+
+func (v *V2) ImpactSubScore() float64 {
+	return 10.41 * (1 - (1-v.weight("C"))*(1-v.weight("I"))*(1-v.weight("A")))
+}
+
+func (v *V2) ExploitabilitySubScore() float64 {
+	return 20 * v.weight("AV") * v.weight("AC") * v.weight("Au")
+}
+
+func (v *V2) BaseScore() float64 {
+	return v.baseScore(v.ImpactSubScore())
+}
+
+func (v *V2) temporal(base float64) float64 {
+	return roundToOneDecimal(base * v.weight("E") * v.weight("RL") * v.weight("RC"))
+}
+
+// TemporalScore equals the base score when no temporal metrics are set.
+func (v *V2) TemporalScore() float64 {
+	return v.temporal(v.BaseScore())
+}
+
+// EnvironmentalScore adjusts the temporal score for collateral damage
+// potential, target distribution and security requirements. With no
+// environmental metrics set it equals the temporal score.
+func (v *V2) EnvironmentalScore() float64 {
+	adjustedImpact := math.Min(10, 10.41*(1-
+		(1-v.weight("C")*v.weight("CR"))*
+			(1-v.weight("I")*v.weight("IR"))*
+			(1-v.weight("A")*v.weight("AR"))))
+	adjustedTemporal := v.temporal(v.baseScore(adjustedImpact))
+	score := (adjustedTemporal + (10-adjustedTemporal)*v.weight("CDP")) * v.weight("TD")
+	return roundToOneDecimal(score)
+}
@@ -0,0 +1,263 @@
+package cvss
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type metricGroup int
+
+const (
+	baseMetric metricGroup = iota
+	temporalMetric
+	environmentalMetric
+)
+
+var (
+	v3AttackVector     = map[string]float64{"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2}
+	v3AttackComplexity = map[string]float64{"L": 0.77, "H": 0.44}
+	// Privileges required weights for an unchanged scope. PR:L and PR:H
+	// weigh more when the scope changes, see v3PrivilegesRequiredWeight.
+	v3PrivilegesRequired = map[string]float64{"N": 0.85, "L": 0.62, "H": 0.27}
+	v3UserInteraction    = map[string]float64{"N": 0.85, "R": 0.62}
+	v3Scope              = map[string]float64{"U": 0, "C": 0}
+	v3Impact             = map[string]float64{"H": 0.56, "L": 0.22, "N": 0}
+	v3Requirement        = map[string]float64{"X": 1, "H": 1.5, "M": 1, "L": 0.5}
+)
+
+func withNotDefined(values map[string]float64) map[string]float64 {
+	withX := map[string]float64{"X": 0}
+	for value, weight := range values {
+		withX[value] = weight
+	}
+	return withX
+}
+
+var v3Metrics = metricSet{
+	{name: "AV", values: v3AttackVector, required: true},
+	{name: "AC", values: v3AttackComplexity, required: true},
+	{name: "PR", values: v3PrivilegesRequired, required: true},
+	{name: "UI", values: v3UserInteraction, required: true},
+	{name: "S", values: v3Scope, required: true},
+	{name: "C", values: v3Impact, required: true},
+	{name: "I", values: v3Impact, required: true},
+	{name: "A", values: v3Impact, required: true},
+	{name: "E", values: map[string]float64{"X": 1, "H": 1, "F": 0.97, "P": 0.94, "U": 0.91}, notDefined: "X"},
+	{name: "RL", values: map[string]float64{"X": 1, "U": 1, "W": 0.97, "T": 0.96, "O": 0.95}, notDefined: "X"},
+	{name: "RC", values: map[string]float64{"X": 1, "C": 1, "R": 0.96, "U": 0.92}, notDefined: "X"},
+	{name: "CR", values: v3Requirement, notDefined: "X"},
+	{name: "IR", values: v3Requirement, notDefined: "X"},
+	{name: "AR", values: v3Requirement, notDefined: "X"},
+	{name: "MAV", values: withNotDefined(v3AttackVector), notDefined: "X"},
+	{name: "MAC", values: withNotDefined(v3AttackComplexity), notDefined: "X"},
+	{name: "MPR", values: withNotDefined(v3PrivilegesRequired), notDefined: "X"},
+	{name: "MUI", values: withNotDefined(v3UserInteraction), notDefined: "X"},
+	{name: "MS", values: withNotDefined(v3Scope), notDefined: "X"},
+	{name: "MC", values: withNotDefined(v3Impact), notDefined: "X"},
+	{name: "MI", values: withNotDefined(v3Impact), notDefined: "X"},
+	{name: "MA", values: withNotDefined(v3Impact), notDefined: "X"},
+}
+
+func v3MetricGroup(m metric) metricGroup {
+	switch m.name {
+	case "E", "RL", "RC":
+		return temporalMetric
+	}
+	if m.required {
+		return baseMetric
+	}
+	return environmentalMetric
+}
+
+// V3 is a parsed CVSS v3.0 or v3.1 vector.
+type V3 struct {
+	// Version is "3.0" or "3.1". It changes the environmental impact
+	// formula for a changed scope.
+	Version string
+	metrics map[string]string
+}
+
+// ParseV3 parses a vector such as CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H.
+// Vectors without the CVSS:3.x prefix, as Tenable sometimes stores them,
+// are treated as version 3.1. Temporal and environmental metrics are
+// optional.
+func ParseV3(vector string) (*V3, error) {
+	vector = strings.TrimSpace(vector)
+	version := "3.1"
+	if strings.HasPrefix(vector, "CVSS:") {
+		slash := strings.IndexByte(vector, '/')
+		if slash < 0 {
+			return nil, fmt.Errorf("%w: %q has no metrics", ErrInvalidVector, vector)
+		}
+		version = strings.TrimPrefix(vector[:slash], "CVSS:")
+		vector = vector[slash+1:]
+	}
+	if version != "3.0" && version != "3.1" {
+		return nil, fmt.Errorf("%w: unsupported version %s", ErrInvalidVector, version)
+	}
+	metrics, err := parseMetrics(vector, v3Metrics, func(metric) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRequired(metrics, v3Metrics); err != nil {
+		return nil, err
+	}
+	return &V3{Version: version, metrics: metrics}, nil
+}
+
+// WithMetrics returns a copy of the vector with the temporal and
+// environmental metrics in modifiers, e.g. "E:F/MAV:L/CR:H", added or
+// replaced. Base metrics can't be modified.
+func (v *V3) WithMetrics(modifiers string) (*V3, error) {
+	values, err := parseMetrics(strings.TrimSpace(modifiers), v3Metrics, func(m metric) bool {
+		return v3MetricGroup(m) != baseMetric
+	})
+	if err != nil {
+		return nil, err
+	}
+	modified := &V3{Version: v.Version, metrics: make(map[string]string, len(v.metrics)+len(values))}
+	for name, value := range v.metrics {
+		modified.metrics[name] = value
+	}
+	for name, value := range values {
+		modified.metrics[name] = value
+	}
+	return modified, nil
+}
+
+// Metric returns the value of a metric, or "X" for a temporal or
+// environmental metric that isn't set.
+func (v *V3) Metric(name string) string {
+	if value, ok := v.metrics[name]; ok {
+		return value
+	}
+	return "X"
+}
+
+func (v *V3) String() string {
+	return "CVSS:" + v.Version + "/" + formatMetrics(v.metrics, v3Metrics)
+}
+
+func (v *V3) weight(name string) float64 {
+	m, _ := v3Metrics.lookup(name)
+	return m.values[v.Metric(name)]
+}
+
+// modified returns the value of the modified version of a base metric,
+// falling back to the base metric when it isn't set.
+func (v *V3) modified(name string) string {
+	if value := v.Metric("M" + name); value != "X" {
+		return value
+	}
+	return v.Metric(name)
+}
+
+func v3PrivilegesRequiredWeight(value string, scopeChanged bool) float64 {
+	if scopeChanged {
+		switch value {
+		case "L":
+			return 0.68
+		case "H":
+			return 0.5
+		}
+	}
+	return v3PrivilegesRequired[value]
+}
+
+// roundUp is the CVSS v3 Roundup function: the smallest number with one
+// decimal place that is equal to or higher than value. It rounds via
+// integers as v3.1 specifies, so floating point error such as
+// 5 * 0.92 = 4.6000000000000005 doesn't round up to 4.7.
+func roundUp(value float64) float64 {
+	scaled := int64(math.Round(value * 100000))
+	if scaled%10000 == 0 {
+		return float64(scaled) / 100000
+	}
+	return float64(scaled/10000+1) / 10
+}
+
+func (v *V3) scopeChanged() bool {
+	return v.Metric("S") == "C"
+}
+
+// ImpactSubScore is the base impact sub score, which can be negative for a
+// changed scope with little impact.
+func (v *V3) ImpactSubScore() float64 {
+	iss := 1 - (1-v.weight("C"))*(1-v.weight("I"))*(1-v.weight("A"))
+	if v.scopeChanged() {
+		return 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	return 6.42 * iss
+}
+
+func (v *V3) ExploitabilitySubScore() float64 {
+	return 8.22 * v.weight("AV") * v.weight("AC") *
+		v3PrivilegesRequiredWeight(v.Metric("PR"), v.scopeChanged()) *
+		v.weight("UI")
+}
+
+func (v *V3) BaseScore() float64 {
+	impact := v.ImpactSubScore()
+	if impact <= 0 {
+		return 0
+	}
+	exploitability := v.ExploitabilitySubScore()
+	if v.scopeChanged() {
+		return roundUp(math.Min(1.08*(impact+exploitability), 10))
+	}
+	return roundUp(math.Min(impact+exploitability, 10))
+}
+
+func (v *V3) temporalMultiplier() float64 {
+	return v.weight("E") * v.weight("RL") * v.weight("RC")
+}
+
+// TemporalScore is the base score adjusted for exploit maturity,
+// remediation level and report confidence. It equals the base score when no
+// temporal metrics are set.
+func (v *V3) TemporalScore() float64 {
+	return roundUp(v.BaseScore() * v.temporalMultiplier())
+}
+
+// EnvironmentalScore is the temporal score recalculated with the security
+// requirements and modified base metrics. It equals the temporal score
+// when no environmental metrics are set.
+func (v *V3) EnvironmentalScore() float64 {
+	impactWeight := func(name string) float64 {
+		return v3Impact[v.modified(name)]
+	}
+	requirement := func(name string) float64 {
+		return v3Requirement[v.Metric(name)]
+	}
+	scopeChanged := v.modified("S") == "C"
+
+	miss := math.Min(1-
+		(1-requirement("CR")*impactWeight("C"))*
+			(1-requirement("IR")*impactWeight("I"))*
+			(1-requirement("AR")*impactWeight("A")), 0.915)
+	var impact float64
+	switch {
+	case !scopeChanged:
+		impact = 6.42 * miss
+	case v.Version == "3.0":
+		impact = 7.52*(miss-0.029) - 3.25*math.Pow(miss-0.02, 15)
+	default:
+		impact = 7.52*(miss-0.029) - 3.25*math.Pow(miss*0.9731-0.02, 13)
+	}
+	if impact <= 0 {
+		return 0
+	}
+	exploitability := 8.22 *
+		v3AttackVector[v.modified("AV")] *
+		v3AttackComplexity[v.modified("AC")] *
+		v3PrivilegesRequiredWeight(v.modified("PR"), scopeChanged) *
+		v3UserInteraction[v.modified("UI")]
+	var score float64
+	if scopeChanged {
+		score = roundUp(math.Min(1.08*(impact+exploitability), 10))
+	} else {
+		score = roundUp(math.Min(impact+exploitability, 10))
+	}
+	return roundUp(score * v.temporalMultiplier())
+}
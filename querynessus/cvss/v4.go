@@ -0,0 +1,396 @@
+package cvss
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// CVSS v4.0 scores aren't calculated from weights but looked up by macro
+// vector and then interpolated by how far the vector is from the most
+// severe vectors of its macro vector. The values of each metric are ranked
+// by severity instead, 0 being the most severe.
+var (
+	v4Impact            = map[string]float64{"H": 0, "L": 1, "N": 2}
+	v4SubsequentImpact  = map[string]float64{"S": 0, "H": 1, "L": 2, "N": 3}
+	v4Requirement       = map[string]float64{"X": 0, "H": 0, "M": 1, "L": 2}
+	v4AttackVector      = map[string]float64{"N": 0, "A": 1, "L": 2, "P": 3}
+	v4AttackComplexity  = map[string]float64{"L": 0, "H": 1}
+	v4AttackRequirement = map[string]float64{"N": 0, "P": 1}
+	v4Privileges        = map[string]float64{"N": 0, "L": 1, "H": 2}
+	v4UserInteraction   = map[string]float64{"N": 0, "P": 1, "A": 2}
+)
+
+var v4Metrics = metricSet{
+	{name: "AV", values: v4AttackVector, required: true},
+	{name: "AC", values: v4AttackComplexity, required: true},
+	{name: "AT", values: v4AttackRequirement, required: true},
+	{name: "PR", values: v4Privileges, required: true},
+	{name: "UI", values: v4UserInteraction, required: true},
+	{name: "VC", values: v4Impact, required: true},
+	{name: "VI", values: v4Impact, required: true},
+	{name: "VA", values: v4Impact, required: true},
+	{name: "SC", values: v4Impact, required: true},
+	{name: "SI", values: v4Impact, required: true},
+	{name: "SA", values: v4Impact, required: true},
+	{name: "E", values: map[string]float64{"X": 0, "A": 0, "P": 1, "U": 2}, notDefined: "X"},
+	{name: "CR", values: v4Requirement, notDefined: "X"},
+	{name: "IR", values: v4Requirement, notDefined: "X"},
+	{name: "AR", values: v4Requirement, notDefined: "X"},
+	{name: "MAV", values: withNotDefined(v4AttackVector), notDefined: "X"},
+	{name: "MAC", values: withNotDefined(v4AttackComplexity), notDefined: "X"},
+	{name: "MAT", values: withNotDefined(v4AttackRequirement), notDefined: "X"},
+	{name: "MPR", values: withNotDefined(v4Privileges), notDefined: "X"},
+	{name: "MUI", values: withNotDefined(v4UserInteraction), notDefined: "X"},
+	{name: "MVC", values: withNotDefined(v4Impact), notDefined: "X"},
+	{name: "MVI", values: withNotDefined(v4Impact), notDefined: "X"},
+	{name: "MVA", values: withNotDefined(v4Impact), notDefined: "X"},
+	{name: "MSC", values: withNotDefined(v4Impact), notDefined: "X"},
+	{name: "MSI", values: withNotDefined(v4SubsequentImpact), notDefined: "X"},
+	{name: "MSA", values: withNotDefined(v4SubsequentImpact), notDefined: "X"},
+	// Supplemental metrics describe the vulnerability further but don't
+	// change its score.
+	{name: "S", values: map[string]float64{"X": 0, "N": 0, "P": 0}, notDefined: "X"},
+	{name: "AU", values: map[string]float64{"X": 0, "N": 0, "Y": 0}, notDefined: "X"},
+	{name: "R", values: map[string]float64{"X": 0, "A": 0, "U": 0, "I": 0}, notDefined: "X"},
+	{name: "V", values: map[string]float64{"X": 0, "D": 0, "C": 0}, notDefined: "X"},
+	{name: "RE", values: map[string]float64{"X": 0, "L": 0, "M": 0, "H": 0}, notDefined: "X"},
+	{name: "U", values: map[string]float64{"X": 0, "Clear": 0, "Green": 0, "Amber": 0, "Red": 0}, notDefined: "X"},
+}
+
+func v4MetricGroup(m metric) metricGroup {
+	switch m.name {
+	case "E":
+		return temporalMetric
+	}
+	if m.required {
+		return baseMetric
+	}
+	return environmentalMetric
+}
+
+// The most severe vectors of each level of the EQ1, EQ2, EQ3 with EQ6 and
+// EQ4 equivalence sets, from tables 24 to 30 of the specification. EQ5 is
+// only exploit maturity so its distance is always zero.
+var (
+	v4EQ1MaxVectors = [][]string{
+		{"AV:N/PR:N/UI:N"},
+		{"AV:A/PR:N/UI:N", "AV:N/PR:L/UI:N", "AV:N/PR:N/UI:P"},
+		{"AV:P/PR:N/UI:N", "AV:A/PR:L/UI:P"},
+	}
+	v4EQ2MaxVectors = [][]string{
+		{"AC:L/AT:N"},
+		{"AC:L/AT:P", "AC:H/AT:N"},
+	}
+	v4EQ3EQ6MaxVectors = [][][]string{
+		{
+			{"VC:H/VI:H/VA:H/CR:H/IR:H/AR:H"},
+			{"VC:H/VI:H/VA:L/CR:M/IR:M/AR:H", "VC:H/VI:H/VA:H/CR:M/IR:M/AR:M"},
+		},
+		{
+			{"VC:L/VI:H/VA:H/CR:H/IR:H/AR:H", "VC:H/VI:L/VA:H/CR:H/IR:H/AR:H"},
+			{
+				"VC:H/VI:L/VA:H/CR:M/IR:H/AR:M", "VC:H/VI:L/VA:L/CR:M/IR:H/AR:H",
+				"VC:L/VI:H/VA:H/CR:H/IR:M/AR:M", "VC:L/VI:H/VA:L/CR:H/IR:M/AR:H",
+				"VC:L/VI:L/VA:H/CR:H/IR:H/AR:M",
+			},
+		},
+		{
+			nil,
+			{"VC:L/VI:L/VA:L/CR:H/IR:H/AR:H"},
+		},
+	}
+	v4EQ4MaxVectors = [][]string{
+		{"SC:H/SI:S/SA:S"},
+		{"SC:H/SI:H/SA:H"},
+		{"SC:L/SI:L/SA:L"},
+	}
+)
+
+// The maximal severity distance within each level of the equivalence sets,
+// plus one.
+var (
+	v4EQ1MaxSeverity    = []float64{1, 4, 5}
+	v4EQ2MaxSeverity    = []float64{1, 2}
+	v4EQ3EQ6MaxSeverity = [][]float64{{7, 6}, {8, 8}, {0, 10}}
+	v4EQ4MaxSeverity    = []float64{6, 5, 4}
+	v4EQ5MaxSeverity    = []float64{1, 1, 1}
+)
+
+// V4 is a parsed CVSS v4.0 vector.
+type V4 struct {
+	metrics map[string]string
+}
+
+// ParseV4 parses a vector such as
+// CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N. Vectors
+// without the CVSS:4.0 prefix are accepted. Threat, environmental and
+// supplemental metrics are optional.
+func ParseV4(vector string) (*V4, error) {
+	vector = strings.TrimSpace(vector)
+	if strings.HasPrefix(vector, "CVSS:") {
+		slash := strings.IndexByte(vector, '/')
+		if slash < 0 {
+			return nil, fmt.Errorf("%w: %q has no metrics", ErrInvalidVector, vector)
+		}
+		if version := strings.TrimPrefix(vector[:slash], "CVSS:"); version != "4.0" {
+			return nil, fmt.Errorf("%w: unsupported version %s", ErrInvalidVector, version)
+		}
+		vector = vector[slash+1:]
+	}
+	metrics, err := parseMetrics(vector, v4Metrics, func(metric) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRequired(metrics, v4Metrics); err != nil {
+		return nil, err
+	}
+	return &V4{metrics: metrics}, nil
+}
+
+// WithMetrics returns a copy of the vector with the threat, environmental
+// and supplemental metrics in modifiers, e.g. "E:P/MAV:A/CR:H", added or
+// replaced. Base metrics can't be modified.
+func (v *V4) WithMetrics(modifiers string) (*V4, error) {
+	values, err := parseMetrics(strings.TrimSpace(modifiers), v4Metrics, func(m metric) bool {
+		return v4MetricGroup(m) != baseMetric
+	})
+	if err != nil {
+		return nil, err
+	}
+	modified := &V4{metrics: make(map[string]string, len(v.metrics)+len(values))}
+	for name, value := range v.metrics {
+		modified.metrics[name] = value
+	}
+	for name, value := range values {
+		modified.metrics[name] = value
+	}
+	return modified, nil
+}
+
+// Metric returns the value of a metric, or "X" for a threat, environmental
+// or supplemental metric that isn't set.
+func (v *V4) Metric(name string) string {
+	if value, ok := v.metrics[name]; ok {
+		return value
+	}
+	return "X"
+}
+
+func (v *V4) String() string {
+	return "CVSS:4.0/" + formatMetrics(v.metrics, v4Metrics)
+}
+
+// only returns a copy of the vector keeping just the metrics in groups.
+func (v *V4) only(groups ...metricGroup) *V4 {
+	kept := &V4{metrics: map[string]string{}}
+	for _, m := range v4Metrics {
+		value, ok := v.metrics[m.name]
+		if !ok {
+			continue
+		}
+		for _, group := range groups {
+			if v4MetricGroup(m) == group {
+				kept.metrics[m.name] = value
+			}
+		}
+	}
+	return kept
+}
+
+// effective returns the value a metric is scored with: its modified value
+// if set, and the worst case for unset exploit maturity and security
+// requirements.
+func (v *V4) effective(name string) string {
+	if value := v.Metric("M" + name); value != "X" {
+		return value
+	}
+	value := v.Metric(name)
+	if value == "X" {
+		switch name {
+		case "E":
+			return "A"
+		case "CR", "IR", "AR":
+			return "H"
+		}
+	}
+	return value
+}
+
+// MacroVector returns the levels of the six equivalence sets the vector
+// falls in, e.g. "002201".
+func (v *V4) MacroVector() string {
+	levels := v.macroVector()
+	var macroVector strings.Builder
+	for _, level := range levels {
+		macroVector.WriteByte(byte('0' + level))
+	}
+	return macroVector.String()
+}
+
+func (v *V4) macroVector() [6]int {
+	var eq [6]int
+	av, pr, ui := v.effective("AV"), v.effective("PR"), v.effective("UI")
+	switch {
+	case av == "N" && pr == "N" && ui == "N":
+		eq[0] = 0
+	case (av == "N" || pr == "N" || ui == "N") && av != "P":
+		eq[0] = 1
+	default:
+		eq[0] = 2
+	}
+
+	if v.effective("AC") != "L" || v.effective("AT") != "N" {
+		eq[1] = 1
+	}
+
+	vc, vi, va := v.effective("VC"), v.effective("VI"), v.effective("VA")
+	switch {
+	case vc == "H" && vi == "H":
+		eq[2] = 0
+	case vc == "H" || vi == "H" || va == "H":
+		eq[2] = 1
+	default:
+		eq[2] = 2
+	}
+
+	sc, si, sa := v.effective("SC"), v.effective("SI"), v.effective("SA")
+	switch {
+	case si == "S" || sa == "S":
+		eq[3] = 0
+	case sc == "H" || si == "H" || sa == "H":
+		eq[3] = 1
+	default:
+		eq[3] = 2
+	}
+
+	switch v.effective("E") {
+	case "P":
+		eq[4] = 1
+	case "U":
+		eq[4] = 2
+	}
+
+	if !(v.effective("CR") == "H" && vc == "H") &&
+		!(v.effective("IR") == "H" && vi == "H") &&
+		!(v.effective("AR") == "H" && va == "H") {
+		eq[5] = 1
+	}
+	return eq
+}
+
+func v4MacroVectorScore(eq [6]int) float64 {
+	key := fmt.Sprintf("%d%d%d%d%d%d", eq[0], eq[1], eq[2], eq[3], eq[4], eq[5])
+	if score, ok := v4MacroVectorScores[key]; ok {
+		return score
+	}
+	return math.NaN()
+}
+
+// severityDistance returns how much less severe the vector is than the
+// closest of maxVectors it doesn't exceed, summed over their metrics.
+func (v *V4) severityDistance(maxVectors []string) float64 {
+	for _, maxVector := range maxVectors {
+		distance := 0.0
+		exceeds := false
+		for _, part := range strings.Split(maxVector, "/") {
+			colon := strings.IndexByte(part, ':')
+			name, maxValue := part[:colon], part[colon+1:]
+			m, _ := v4Metrics.lookup(name)
+			values := m.values
+			if name == "SI" || name == "SA" {
+				values = v4SubsequentImpact
+			}
+			metricDistance := values[v.effective(name)] - values[maxValue]
+			if metricDistance < 0 {
+				exceeds = true
+				break
+			}
+			distance += metricDistance
+		}
+		if !exceeds {
+			return distance
+		}
+	}
+	return 0
+}
+
+// score implements the CVSS v4.0 scoring algorithm on all of the metrics
+// set.
+func (v *V4) score() float64 {
+	noImpact := true
+	for _, name := range []string{"VC", "VI", "VA", "SC", "SI", "SA"} {
+		if v.effective(name) != "N" {
+			noImpact = false
+		}
+	}
+	if noImpact {
+		return 0
+	}
+
+	eq := v.macroVector()
+	value := v4MacroVectorScore(eq)
+
+	next := func(set int) [6]int {
+		lower := eq
+		lower[set]++
+		return lower
+	}
+	eq1Lower := v4MacroVectorScore(next(0))
+	eq2Lower := v4MacroVectorScore(next(1))
+	eq4Lower := v4MacroVectorScore(next(3))
+	eq5Lower := v4MacroVectorScore(next(4))
+	// EQ3 and EQ6 are scored together as not every combination of their
+	// levels exists. From 00 both 10 and 01 are lower; take the higher.
+	var eq3eq6Lower float64
+	switch {
+	case eq[2] == 0 && eq[5] == 0:
+		eq3eq6Lower = math.Max(v4MacroVectorScore(next(2)), v4MacroVectorScore(next(5)))
+	case eq[2] == 1 && eq[5] == 0:
+		eq3eq6Lower = v4MacroVectorScore(next(5))
+	default:
+		eq3eq6Lower = v4MacroVectorScore(next(2))
+	}
+
+	proportions := []struct {
+		lower    float64
+		distance float64
+		max      float64
+	}{
+		{eq1Lower, v.severityDistance(v4EQ1MaxVectors[eq[0]]), v4EQ1MaxSeverity[eq[0]]},
+		{eq2Lower, v.severityDistance(v4EQ2MaxVectors[eq[1]]), v4EQ2MaxSeverity[eq[1]]},
+		{eq3eq6Lower, v.severityDistance(v4EQ3EQ6MaxVectors[eq[2]][eq[5]]), v4EQ3EQ6MaxSeverity[eq[2]][eq[5]]},
+		{eq4Lower, v.severityDistance(v4EQ4MaxVectors[eq[3]]), v4EQ4MaxSeverity[eq[3]]},
+		{eq5Lower, 0, v4EQ5MaxSeverity[eq[4]]},
+	}
+	var total float64
+	var lowerCount int
+	for _, p := range proportions {
+		if math.IsNaN(p.lower) {
+			continue
+		}
+		lowerCount++
+		total += (value - p.lower) * p.distance / p.max
+	}
+	if lowerCount > 0 {
+		value -= total / float64(lowerCount)
+	}
+	return roundToOneDecimal(math.Max(0, math.Min(value, 10)))
+}
+
+// BaseScore is the CVSS-B score, from the base metrics alone.
+func (v *V4) BaseScore() float64 {
+	return v.only(baseMetric).score()
+}
+
+// ThreatScore is the CVSS-BT score, the base score adjusted for exploit
+// maturity. It is the v4 counterpart of the v2 and v3 temporal scores.
+func (v *V4) ThreatScore() float64 {
+	return v.only(baseMetric, temporalMetric).score()
+}
+
+// EnvironmentalScore is the CVSS-BTE score, calculated from every metric
+// set. It equals the threat score when no environmental metrics are set.
+func (v *V4) EnvironmentalScore() float64 {
+	return v.score()
+}
@@ -0,0 +1,364 @@
+package querynessus
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DiffFields are the fields compared by DiffPlugins, named as in a
+// PluginFilter. Fields that change with every update, like the modification
+// date, are left out so the changelog only shows what matters for triage.
+var DiffFields = []string{
+	"name",
+	"family_name",
+	"risk_factor",
+	"stig_severity",
+	"cvss_base_score",
+	"cvss_temporal_score",
+	"cvss_vector.raw",
+	"cvss3_base_score",
+	"cvss3_temporal_score",
+	"cvss3_vector.raw",
+	"cvss4_base_score",
+	"cvss4_threat_score",
+	"cvss4_vector.raw",
+	"epss_score",
+	"vpr.score",
+	"exploit_available",
+	"exploited_by_malware",
+	"in_the_news",
+	"has_patch",
+	"unsupported_by_vendor",
+	"cve",
+	"cpe",
+	"xref",
+}
+
+// PluginSummary identifies a plugin in a PluginDiff.
+type PluginSummary struct {
+	ID              int      `json:"id"`
+	Name            string   `json:"name"`
+	FamilyName      string   `json:"family_name,omitempty"`
+	RiskFactor      string   `json:"risk_factor,omitempty"`
+	CVSSv3BaseScore float32  `json:"cvss3_base_score,omitempty"`
+	VPRScore        float32  `json:"vpr_score,omitempty"`
+	CVE             []string `json:"cve,omitempty"`
+}
+
+func summarisePlugin(plugin *PluginDetails) PluginSummary {
+	return PluginSummary{
+		ID:              plugin.ID,
+		Name:            plugin.Name,
+		FamilyName:      plugin.FamilyName,
+		RiskFactor:      plugin.Attributes.RiskFactor,
+		CVSSv3BaseScore: plugin.Attributes.CVSSv3BaseScore,
+		VPRScore:        plugin.Attributes.VPR.Score,
+		CVE:             plugin.Attributes.CVE,
+	}
+}
+
+// PluginFieldChange is a change to one field. Scalar fields have Old and
+// New set, list fields such as cve list the Added and Removed elements.
+type PluginFieldChange struct {
+	Field   string      `json:"field"`
+	Old     interface{} `json:"old,omitempty"`
+	New     interface{} `json:"new,omitempty"`
+	Added   []string    `json:"added,omitempty"`
+	Removed []string    `json:"removed,omitempty"`
+}
+
+type PluginChange struct {
+	PluginSummary
+	Changes []PluginFieldChange `json:"changes"`
+}
+
+// PluginDiff is a changelog between two versions of a plugin catalogue.
+type PluginDiff struct {
+	Added   []PluginSummary `json:"added"`
+	Removed []PluginSummary `json:"removed"`
+	Changed []PluginChange  `json:"changed"`
+	// Unchanged counts plugins present in both versions without a change to
+	// any of the DiffFields.
+	Unchanged int `json:"unchanged"`
+}
+
+func NewPluginDiff() *PluginDiff {
+	return &PluginDiff{
+		Added:   []PluginSummary{},
+		Removed: []PluginSummary{},
+		Changed: []PluginChange{},
+	}
+}
+
+// Add records the difference between two versions of a plugin. oldPlugin
+// is nil for a new plugin and newPlugin is nil for a removed one.
+func (diff *PluginDiff) Add(oldPlugin *PluginDetails, newPlugin *PluginDetails) {
+	switch {
+	case oldPlugin == nil && newPlugin == nil:
+		return
+	case oldPlugin == nil:
+		diff.Added = append(diff.Added, summarisePlugin(newPlugin))
+	case newPlugin == nil:
+		diff.Removed = append(diff.Removed, summarisePlugin(oldPlugin))
+	default:
+		changes := diffPlugin(oldPlugin, newPlugin)
+		if len(changes) == 0 {
+			diff.Unchanged += 1
+			return
+		}
+		diff.Changed = append(diff.Changed, PluginChange{
+			PluginSummary: summarisePlugin(newPlugin),
+			Changes:       changes,
+		})
+	}
+}
+
+// Sort orders each section by plugin ID.
+func (diff *PluginDiff) Sort() {
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].ID < diff.Added[j].ID })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].ID < diff.Removed[j].ID })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].ID < diff.Changed[j].ID })
+}
+
+func (diff *PluginDiff) Empty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0
+}
+
+func diffPlugin(oldPlugin *PluginDetails, newPlugin *PluginDetails) []PluginFieldChange {
+	var changes []PluginFieldChange
+	oldValue := reflect.ValueOf(oldPlugin)
+	newValue := reflect.ValueOf(newPlugin)
+	for _, name := range DiffFields {
+		field, ok := lookupFilterField(name)
+		if !ok {
+			continue
+		}
+		before, beforeOk := field.value(oldValue)
+		after, afterOk := field.value(newValue)
+		if !beforeOk || !afterOk {
+			if beforeOk != afterOk {
+				changes = append(changes, PluginFieldChange{Field: field.name, Old: interfaceOf(before, beforeOk), New: interfaceOf(after, afterOk)})
+			}
+			continue
+		}
+		if field.kind == reflect.Slice {
+			added, removed := diffLists(listStrings(before), listStrings(after))
+			if len(added) > 0 || len(removed) > 0 {
+				changes = append(changes, PluginFieldChange{Field: field.name, Added: added, Removed: removed})
+			}
+			continue
+		}
+		if !reflect.DeepEqual(before.Interface(), after.Interface()) {
+			changes = append(changes, PluginFieldChange{Field: field.name, Old: before.Interface(), New: after.Interface()})
+		}
+	}
+	return changes
+}
+
+func interfaceOf(value reflect.Value, ok bool) interface{} {
+	if !ok {
+		return nil
+	}
+	return value.Interface()
+}
+
+func listStrings(list reflect.Value) []string {
+	values := make([]string, 0, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		values = append(values, fmt.Sprint(list.Index(i).Interface()))
+	}
+	return values
+}
+
+// diffLists returns the elements only in after and only in before, sorted.
+func diffLists(before []string, after []string) (added []string, removed []string) {
+	inBefore := make(map[string]bool, len(before))
+	for _, value := range before {
+		inBefore[value] = true
+	}
+	inAfter := make(map[string]bool, len(after))
+	for _, value := range after {
+		inAfter[value] = true
+		if !inBefore[value] {
+			added = append(added, value)
+		}
+	}
+	for _, value := range before {
+		if !inAfter[value] {
+			removed = append(removed, value)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return dedupeSorted(added), dedupeSorted(removed)
+}
+
+func dedupeSorted(values []string) []string {
+	if len(values) < 2 {
+		return values
+	}
+	deduped := values[:1]
+	for _, value := range values[1:] {
+		if value != deduped[len(deduped)-1] {
+			deduped = append(deduped, value)
+		}
+	}
+	return deduped
+}
+
+// DiffPlugins compares two snapshots of the plugin catalogue.
+func DiffPlugins(oldPlugins *PluginListPage, newPlugins *PluginListPage) *PluginDiff {
+	diff := NewPluginDiff()
+	seen := make(map[int]bool, len(newPlugins.Data.PluginDetails))
+	for i := range newPlugins.Data.PluginDetails {
+		newPlugin := &newPlugins.Data.PluginDetails[i]
+		if seen[newPlugin.ID] {
+			continue
+		}
+		seen[newPlugin.ID] = true
+		oldPlugin, _, exists := oldPlugins.Data.PluginFromId(newPlugin.ID)
+		if !exists {
+			oldPlugin = nil
+		}
+		diff.Add(oldPlugin, newPlugin)
+	}
+	for i := range oldPlugins.Data.PluginDetails {
+		oldPlugin := &oldPlugins.Data.PluginDetails[i]
+		if !seen[oldPlugin.ID] {
+			seen[oldPlugin.ID] = true
+			diff.Add(oldPlugin, nil)
+		}
+	}
+	diff.Sort()
+	return diff
+}
+
+// MergeWithDiff merges otherPluginsPage like Merge and returns what the
+// merge changed. A merge never removes plugins.
+func (pluginsPage *PluginListPage) MergeWithDiff(otherPluginsPage *PluginListPage) (*PluginDiff, error) {
+	diff := NewPluginDiff()
+	seen := make(map[int]bool, len(otherPluginsPage.Data.PluginDetails))
+	for i := range otherPluginsPage.Data.PluginDetails {
+		otherPlugin := &otherPluginsPage.Data.PluginDetails[i]
+		if seen[otherPlugin.ID] {
+			continue
+		}
+		seen[otherPlugin.ID] = true
+		plugin, _, exists := pluginsPage.Data.PluginFromId(otherPlugin.ID)
+		if !exists {
+			plugin = nil
+		}
+		diff.Add(plugin, otherPlugin)
+	}
+	if _, _, _, err := pluginsPage.Merge(otherPluginsPage); err != nil {
+		return nil, err
+	}
+	diff.Sort()
+	return diff, nil
+}
+
+func formatDiffValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "(none)"
+	case string:
+		if v == "" {
+			return "(none)"
+		}
+		return v
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return fmt.Sprint(value)
+}
+
+func markdownCell(text string) string {
+	return strings.ReplaceAll(strings.Join(strings.Fields(text), " "), "|", `\|`)
+}
+
+func writeMarkdownSummaryTable(w io.Writer, plugins []PluginSummary) error {
+	if _, err := io.WriteString(w, "| ID | Name | Family | Risk | CVSSv3 | VPR | CVEs |\n|---|---|---|---|---|---|---|\n"); err != nil {
+		return err
+	}
+	for _, plugin := range plugins {
+		_, err := fmt.Fprintf(w, "| %d | %s | %s | %s | %s | %s | %s |\n",
+			plugin.ID,
+			markdownCell(plugin.Name),
+			markdownCell(plugin.FamilyName),
+			markdownCell(plugin.RiskFactor),
+			formatMarkdownScore(plugin.CVSSv3BaseScore),
+			formatMarkdownScore(plugin.VPRScore),
+			markdownCell(strings.Join(plugin.CVE, ", ")))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatMarkdownScore(score float32) string {
+	if score == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(score), 'f', 1, 32)
+}
+
+// WriteMarkdown writes the diff as a human readable changelog.
+func (diff *PluginDiff) WriteMarkdown(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# Plugin changes\n\n%d added, %d removed, %d changed, %d unchanged\n",
+		len(diff.Added), len(diff.Removed), len(diff.Changed), diff.Unchanged)
+	if err != nil {
+		return err
+	}
+	for _, section := range []struct {
+		title   string
+		plugins []PluginSummary
+	}{
+		{"Added plugins", diff.Added},
+		{"Removed plugins", diff.Removed},
+	} {
+		if len(section.plugins) == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "\n## %s (%d)\n\n", section.title, len(section.plugins)); err != nil {
+			return err
+		}
+		if err := writeMarkdownSummaryTable(w, section.plugins); err != nil {
+			return err
+		}
+	}
+	if len(diff.Changed) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "\n## Changed plugins (%d)\n", len(diff.Changed)); err != nil {
+		return err
+	}
+	for _, change := range diff.Changed {
+		if _, err := fmt.Fprintf(w, "\n### %d %s\n\n", change.ID, strings.Join(strings.Fields(change.Name), " ")); err != nil {
+			return err
+		}
+		for _, fieldChange := range change.Changes {
+			var line string
+			if fieldChange.Added != nil || fieldChange.Removed != nil {
+				var parts []string
+				if len(fieldChange.Added) > 0 {
+					parts = append(parts, "added "+strings.Join(fieldChange.Added, ", "))
+				}
+				if len(fieldChange.Removed) > 0 {
+					parts = append(parts, "removed "+strings.Join(fieldChange.Removed, ", "))
+				}
+				line = strings.Join(parts, "; ")
+			} else {
+				line = formatDiffValue(fieldChange.Old) + " → " + formatDiffValue(fieldChange.New)
+			}
+			if _, err := fmt.Fprintf(w, "- **%s**: %s\n", fieldChange.Field, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
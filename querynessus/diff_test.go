@@ -0,0 +1,38 @@
+package querynessus
+
+import "testing"
+
+func TestMergeWithDiffReportsChangesWithoutNewModificationDate(t *testing.T) {
+	before, after := vprUpdate()
+	after.Attributes.CVSSv3BaseScore = 9.8
+	after.Attributes.CVE = []string{"CVE-2022-3602"}
+	unchanged := PluginDetails{ID: 1, Name: "Unchanged"}
+	added := PluginDetails{ID: 2, Name: "Added"}
+
+	page := &PluginListPage{Data: PluginDetailsList{PluginDetails: []PluginDetails{before, unchanged}}}
+	diff, err := page.MergeWithDiff(&PluginListPage{Data: PluginDetailsList{PluginDetails: []PluginDetails{after, unchanged, added}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].ID != 2 {
+		t.Errorf("added %+v, want plugin 2", diff.Added)
+	}
+	if diff.Unchanged != 1 {
+		t.Errorf("unchanged = %d, want 1", diff.Unchanged)
+	}
+	if len(diff.Changed) != 1 {
+		t.Fatalf("changed %+v, want plugin 12345", diff.Changed)
+	}
+	fields := map[string]bool{}
+	for _, change := range diff.Changed[0].Changes {
+		fields[change.Field] = true
+	}
+	for _, field := range []string{"vpr.score", "cvss3_base_score", "cve"} {
+		if !fields[field] {
+			t.Errorf("changes %+v don't include %s", diff.Changed[0].Changes, field)
+		}
+	}
+	if plugin, _, _ := page.Data.PluginFromId(12345); plugin.Attributes.VPR.Score != after.Attributes.VPR.Score {
+		t.Errorf("merged VPR = %v, want %v", plugin.Attributes.VPR.Score, after.Attributes.VPR.Score)
+	}
+}
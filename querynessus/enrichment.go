@@ -0,0 +1,251 @@
+package querynessus
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidFeed = errors.New("invalid enrichment feed")
+
+// EPSSScore is a CVE's Exploit Prediction Scoring System score from FIRST:
+// the probability of it being exploited in the next 30 days and the
+// proportion of scored CVEs less likely to be.
+type EPSSScore struct {
+	CVE        string  `json:"cve"`
+	Score      float64 `json:"epss"`
+	Percentile float64 `json:"percentile"`
+}
+
+// EPSSFeed is one day of EPSS scores as published in
+// epss_scores-YYYY-MM-DD.csv.gz.
+type EPSSFeed struct {
+	ModelVersion string
+	ScoreDate    string
+	scores       map[string]EPSSScore
+}
+
+// ReadEPSSFeed reads the EPSS CSV, with its optional
+// #model_version:...,score_date:... comment line and its cve, epss and
+// percentile columns in any order.
+func ReadEPSSFeed(r io.Reader) (*EPSSFeed, error) {
+	feed := &EPSSFeed{scores: map[string]EPSSScore{}}
+	buffered := bufio.NewReader(r)
+	// The CSV reader counts lines from after the comment line.
+	lineOffset := 0
+	if first, err := buffered.Peek(1); err == nil && first[0] == '#' {
+		lineOffset = 1
+		comment, err := buffered.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		for _, field := range strings.Split(strings.TrimSpace(comment[1:]), ",") {
+			colon := strings.IndexByte(field, ':')
+			if colon < 0 {
+				continue
+			}
+			switch field[:colon] {
+			case "model_version":
+				feed.ModelVersion = field[colon+1:]
+			case "score_date":
+				feed.ScoreDate = field[colon+1:]
+			}
+		}
+	}
+
+	reader := csv.NewReader(buffered)
+	reader.Comment = '#'
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: EPSS feed has no header", ErrInvalidFeed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"cve", "epss", "percentile"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: EPSS feed has no %s column", ErrInvalidFeed, name)
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		line += lineOffset
+		score, err := strconv.ParseFloat(strings.TrimSpace(record[columns["epss"]]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: epss: %s", ErrInvalidFeed, line, err)
+		}
+		percentile, err := strconv.ParseFloat(strings.TrimSpace(record[columns["percentile"]]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: percentile: %s", ErrInvalidFeed, line, err)
+		}
+		cve := normaliseCVE(record[columns["cve"]])
+		feed.scores[cve] = EPSSScore{CVE: cve, Score: score, Percentile: percentile}
+	}
+	return feed, nil
+}
+
+// LoadEPSSFile reads an EPSS feed from a CSV file, which may be gzip or
+// zstd compressed as downloaded.
+func LoadEPSSFile(filename string) (*EPSSFeed, error) {
+	file, err := openDecompressed(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	feed, err := ReadEPSSFeed(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return feed, nil
+}
+
+func (feed *EPSSFeed) Len() int {
+	return len(feed.scores)
+}
+
+func (feed *EPSSFeed) Lookup(cve string) (EPSSScore, bool) {
+	score, ok := feed.scores[normaliseCVE(cve)]
+	return score, ok
+}
+
+// KEVVulnerability is an entry in CISA's Known Exploited Vulnerabilities
+// catalog.
+type KEVVulnerability struct {
+	CVE                        string `json:"cveID"`
+	VendorProject              string `json:"vendorProject"`
+	Product                    string `json:"product"`
+	VulnerabilityName          string `json:"vulnerabilityName"`
+	DateAdded                  string `json:"dateAdded"`
+	ShortDescription           string `json:"shortDescription"`
+	RequiredAction             string `json:"requiredAction"`
+	DueDate                    string `json:"dueDate"`
+	KnownRansomwareCampaignUse string `json:"knownRansomwareCampaignUse"`
+	Notes                      string `json:"notes"`
+}
+
+// KEVCatalog is CISA's Known Exploited Vulnerabilities catalog as published
+// in known_exploited_vulnerabilities.json.
+type KEVCatalog struct {
+	Title           string             `json:"title"`
+	CatalogVersion  string             `json:"catalogVersion"`
+	DateReleased    string             `json:"dateReleased"`
+	Count           int                `json:"count"`
+	Vulnerabilities []KEVVulnerability `json:"vulnerabilities"`
+	byCVE           map[string]int
+}
+
+func ReadKEVCatalog(r io.Reader) (*KEVCatalog, error) {
+	var catalog KEVCatalog
+	if err := json.NewDecoder(r).Decode(&catalog); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFeed, err)
+	}
+	catalog.byCVE = make(map[string]int, len(catalog.Vulnerabilities))
+	for i, vulnerability := range catalog.Vulnerabilities {
+		catalog.byCVE[normaliseCVE(vulnerability.CVE)] = i
+	}
+	return &catalog, nil
+}
+
+// LoadKEVFile reads the KEV catalog from a JSON file, which may be gzip or
+// zstd compressed.
+func LoadKEVFile(filename string) (*KEVCatalog, error) {
+	file, err := openDecompressed(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	catalog, err := ReadKEVCatalog(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return catalog, nil
+}
+
+func (catalog *KEVCatalog) Lookup(cve string) (KEVVulnerability, bool) {
+	i, ok := catalog.byCVE[normaliseCVE(cve)]
+	if !ok {
+		return KEVVulnerability{}, false
+	}
+	return catalog.Vulnerabilities[i], true
+}
+
+// PluginEnrichment is what the EPSS and KEV feeds say about the CVEs a
+// plugin detects. It can be queried as e.g. enrichment.kev or
+// enrichment.epss_score > 0.5.
+type PluginEnrichment struct {
+	// EPSSScore and EPSSPercentile are those of EPSSCVE, the plugin's CVE
+	// most likely to be exploited.
+	EPSSScore      float64 `json:"epss_score"`
+	EPSSPercentile float64 `json:"epss_percentile"`
+	EPSSCVE        string  `json:"epss_cve,omitempty"`
+	// KEV is true if any of the plugin's CVEs, listed in KEVCVEs, is known
+	// to be exploited. KEVDueDate is the earliest remediation due date of
+	// them and KEVDateAdded the date the first was added to the catalog.
+	KEV           bool     `json:"kev"`
+	KEVCVEs       []string `json:"kev_cves,omitempty"`
+	KEVDateAdded  string   `json:"kev_date_added,omitempty"`
+	KEVDueDate    string   `json:"kev_due_date,omitempty"`
+	KEVRansomware bool     `json:"kev_ransomware,omitempty"`
+}
+
+// Enricher joins the EPSS and KEV feeds onto plugins by their CVEs. Either
+// feed may be nil.
+type Enricher struct {
+	EPSS *EPSSFeed
+	KEV  *KEVCatalog
+}
+
+// Enrich sets plugin.Enrichment, replacing any earlier enrichment.
+func (enricher *Enricher) Enrich(plugin *PluginDetails) {
+	enrichment := &PluginEnrichment{}
+	for _, cve := range plugin.Attributes.CVE {
+		if enricher.EPSS != nil {
+			if score, ok := enricher.EPSS.Lookup(cve); ok && (enrichment.EPSSCVE == "" || score.Score > enrichment.EPSSScore) {
+				enrichment.EPSSScore = score.Score
+				enrichment.EPSSPercentile = score.Percentile
+				enrichment.EPSSCVE = score.CVE
+			}
+		}
+		if enricher.KEV != nil {
+			vulnerability, ok := enricher.KEV.Lookup(cve)
+			if !ok {
+				continue
+			}
+			enrichment.KEV = true
+			enrichment.KEVCVEs = append(enrichment.KEVCVEs, vulnerability.CVE)
+			if enrichment.KEVDueDate == "" || (vulnerability.DueDate != "" && vulnerability.DueDate < enrichment.KEVDueDate) {
+				enrichment.KEVDueDate = vulnerability.DueDate
+			}
+			if enrichment.KEVDateAdded == "" || (vulnerability.DateAdded != "" && vulnerability.DateAdded < enrichment.KEVDateAdded) {
+				enrichment.KEVDateAdded = vulnerability.DateAdded
+			}
+			if strings.EqualFold(vulnerability.KnownRansomwareCampaignUse, "Known") {
+				enrichment.KEVRansomware = true
+			}
+		}
+	}
+	plugin.Enrichment = enrichment
+}
+
+func (enricher *Enricher) EnrichAll(plugins []PluginDetails) {
+	for i := range plugins {
+		enricher.Enrich(&plugins[i])
+	}
+}
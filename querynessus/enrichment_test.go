@@ -0,0 +1,186 @@
+package querynessus
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testEPSSFeed = `#model_version:v2023.03.01,score_date:2024-05-01T00:00:00+0000
+percentile,cve,epss
+0.99999,CVE-2021-44228,0.97565
+0.99900,cve-2021-45046,0.97200
+0.50000, CVE-2022-3602 ,0.00123
+`
+
+const testKEVCatalog = `{
+	"title": "CISA Catalog of Known Exploited Vulnerabilities",
+	"catalogVersion": "2024.05.01",
+	"dateReleased": "2024-05-01T14:00:00.000Z",
+	"count": 2,
+	"vulnerabilities": [
+		{"cveID": "CVE-2021-44228", "vendorProject": "Apache", "product": "Log4j2", "dateAdded": "2021-12-10", "dueDate": "2021-12-24", "knownRansomwareCampaignUse": "Known"},
+		{"cveID": "CVE-2021-45046", "vendorProject": "Apache", "product": "Log4j2", "dateAdded": "2023-05-01", "dueDate": "2023-05-22", "knownRansomwareCampaignUse": "Unknown"}
+	]
+}`
+
+func testEnricher(t *testing.T) *Enricher {
+	t.Helper()
+	epss, err := ReadEPSSFeed(strings.NewReader(testEPSSFeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kev, err := ReadKEVCatalog(strings.NewReader(testKEVCatalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Enricher{EPSS: epss, KEV: kev}
+}
+
+func TestReadEPSSFeed(t *testing.T) {
+	feed, err := ReadEPSSFeed(strings.NewReader(testEPSSFeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.ModelVersion != "v2023.03.01" || feed.ScoreDate != "2024-05-01T00:00:00+0000" {
+		t.Errorf("read model version %q and score date %q", feed.ModelVersion, feed.ScoreDate)
+	}
+	if feed.Len() != 3 {
+		t.Errorf("read %d scores, want 3", feed.Len())
+	}
+	for cve, want := range map[string]EPSSScore{
+		"CVE-2021-44228":  {CVE: "CVE-2021-44228", Score: 0.97565, Percentile: 0.99999},
+		"cve-2021-45046":  {CVE: "CVE-2021-45046", Score: 0.972, Percentile: 0.999},
+		" CVE-2022-3602 ": {CVE: "CVE-2022-3602", Score: 0.00123, Percentile: 0.5},
+	} {
+		if score, ok := feed.Lookup(cve); !ok || score != want {
+			t.Errorf("Lookup(%q) = %+v, %v, want %+v", cve, score, ok, want)
+		}
+	}
+	if _, ok := feed.Lookup("CVE-2017-0144"); ok {
+		t.Error("Lookup found a CVE missing from the feed")
+	}
+
+	// The comment line is optional.
+	feed, err = ReadEPSSFeed(strings.NewReader("cve,epss,percentile\nCVE-2021-44228,0.97565,0.99999\n"))
+	if err != nil || feed.Len() != 1 || feed.ModelVersion != "" {
+		t.Errorf("read %v, %v from a feed without a comment line", feed, err)
+	}
+}
+
+func TestReadEPSSFeedErrors(t *testing.T) {
+	for _, test := range []struct {
+		feed string
+		want string
+	}{
+		{"", "invalid enrichment feed: EPSS feed has no header"},
+		{"#model_version:v2023.03.01\n", "invalid enrichment feed: EPSS feed has no header"},
+		{"cve,percentile\n", "invalid enrichment feed: EPSS feed has no epss column"},
+		{"cve,epss,percentile\nCVE-2021-44228,high,0.99\n", `invalid enrichment feed: line 2: epss: strconv.ParseFloat: parsing "high": invalid syntax`},
+		{"#model_version:v2023.03.01\ncve,epss,percentile\nCVE-2021-44228,0.9,0.99\nCVE-2021-45046,0.9,\n", `invalid enrichment feed: line 4: percentile: strconv.ParseFloat: parsing "": invalid syntax`},
+	} {
+		_, err := ReadEPSSFeed(strings.NewReader(test.feed))
+		if !errors.Is(err, ErrInvalidFeed) || err.Error() != test.want {
+			t.Errorf("ReadEPSSFeed(%q) returned %v, want %s", test.feed, err, test.want)
+		}
+	}
+}
+
+func TestReadKEVCatalog(t *testing.T) {
+	catalog, err := ReadKEVCatalog(strings.NewReader(testKEVCatalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if catalog.CatalogVersion != "2024.05.01" || catalog.Count != 2 || len(catalog.Vulnerabilities) != 2 {
+		t.Errorf("read catalog version %q with count %d and %d vulnerabilities",
+			catalog.CatalogVersion, catalog.Count, len(catalog.Vulnerabilities))
+	}
+	vulnerability, ok := catalog.Lookup("cve-2021-44228")
+	if !ok || vulnerability.Product != "Log4j2" || vulnerability.DateAdded != "2021-12-10" || vulnerability.KnownRansomwareCampaignUse != "Known" {
+		t.Errorf("Lookup returned %+v, %v", vulnerability, ok)
+	}
+	if _, ok := catalog.Lookup("CVE-2022-3602"); ok {
+		t.Error("Lookup found a CVE missing from the catalog")
+	}
+
+	if _, err := ReadKEVCatalog(strings.NewReader(`{"vulnerabilities": [`)); !errors.Is(err, ErrInvalidFeed) {
+		t.Errorf("ReadKEVCatalog of truncated JSON returned %v, want ErrInvalidFeed", err)
+	}
+}
+
+func TestLoadEnrichmentFilesDecompress(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{"epss.csv.gz": testEPSSFeed, "kev.json.zst": testKEVCatalog} {
+		err := writeCompressedFileAtomic(filepath.Join(dir, name), 0644, func(w io.Writer) error {
+			_, err := io.WriteString(w, contents)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if feed, err := LoadEPSSFile(filepath.Join(dir, "epss.csv.gz")); err != nil || feed.Len() != 3 {
+		t.Errorf("LoadEPSSFile returned %v, %v", feed, err)
+	}
+	if catalog, err := LoadKEVFile(filepath.Join(dir, "kev.json.zst")); err != nil || len(catalog.Vulnerabilities) != 2 {
+		t.Errorf("LoadKEVFile returned %v, %v", catalog, err)
+	}
+}
+
+func TestEnrich(t *testing.T) {
+	enricher := testEnricher(t)
+	for _, test := range []struct {
+		name string
+		cves []string
+		want PluginEnrichment
+	}{
+		{"several CVEs", []string{"CVE-2022-3602", "CVE-2021-45046", "CVE-2021-44228", "CVE-2017-0144"}, PluginEnrichment{
+			EPSSScore:      0.97565,
+			EPSSPercentile: 0.99999,
+			EPSSCVE:        "CVE-2021-44228",
+			KEV:            true,
+			KEVCVEs:        []string{"CVE-2021-45046", "CVE-2021-44228"},
+			KEVDateAdded:   "2021-12-10",
+			KEVDueDate:     "2021-12-24",
+			KEVRansomware:  true,
+		}},
+		{"scored but not exploited", []string{"cve-2022-3602"}, PluginEnrichment{
+			EPSSScore:      0.00123,
+			EPSSPercentile: 0.5,
+			EPSSCVE:        "CVE-2022-3602",
+		}},
+		{"unknown CVE", []string{"CVE-2017-0144"}, PluginEnrichment{}},
+		{"no CVEs", nil, PluginEnrichment{}},
+	} {
+		plugin := PluginDetails{ID: 1}
+		plugin.Attributes.CVE = test.cves
+		plugin.Enrichment = &PluginEnrichment{KEV: true, EPSSScore: 1}
+		enricher.Enrich(&plugin)
+		if plugin.Enrichment == nil || !reflect.DeepEqual(*plugin.Enrichment, test.want) {
+			t.Errorf("%s: enriched with %+v, want %+v", test.name, plugin.Enrichment, test.want)
+		}
+	}
+}
+
+func TestEnrichWithOneFeed(t *testing.T) {
+	full := testEnricher(t)
+	plugins := []PluginDetails{{ID: 1}, {ID: 2}}
+	plugins[0].Attributes.CVE = []string{"CVE-2021-44228"}
+	plugins[1].Attributes.CVE = []string{"CVE-2022-3602"}
+
+	(&Enricher{KEV: full.KEV}).EnrichAll(plugins)
+	if enrichment := plugins[0].Enrichment; !enrichment.KEV || enrichment.EPSSCVE != "" {
+		t.Errorf("KEV only enrichment was %+v", enrichment)
+	}
+
+	(&Enricher{EPSS: full.EPSS}).EnrichAll(plugins)
+	if enrichment := plugins[0].Enrichment; enrichment.KEV || enrichment.EPSSCVE != "CVE-2021-44228" {
+		t.Errorf("EPSS only enrichment was %+v", enrichment)
+	}
+	if enrichment := plugins[1].Enrichment; enrichment.EPSSScore != 0.00123 {
+		t.Errorf("EPSS only enrichment of the second plugin was %+v", enrichment)
+	}
+}
@@ -0,0 +1,118 @@
+package querynessus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrEmptyResponse = errors.New("empty response received")
+	ErrNotFound      = errors.New("not found")
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrForbidden     = errors.New("forbidden")
+	ErrRateLimited   = errors.New("rate limited")
+)
+
+const maxErrorBodySize = 64 * 1024
+
+// APIError is returned for any non 200 response from the Tenable API. It
+// matches ErrNotFound, ErrUnauthorized, ErrForbidden and ErrRateLimited with
+// errors.Is based on the status code.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Method     string
+	Endpoint   string
+	RequestID  string
+	ErrorType  string
+	Message    string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("received %s response from %s %s", e.Status, e.Method, e.Endpoint)
+	if e.Message != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Message)
+	}
+	if e.RequestID != "" {
+		msg = fmt.Sprintf("%s (request id %s)", msg, e.RequestID)
+	}
+	return msg
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RequestID:  resp.Header.Get("X-Request-Uuid"),
+	}
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = resp.Header.Get("X-Request-Id")
+	}
+	if resp.Request != nil {
+		apiErr.Method = resp.Request.Method
+		apiErr.Endpoint = resp.Request.URL.Redacted()
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil {
+		return apiErr
+	}
+	apiErr.Body = strings.TrimSpace(string(body))
+
+	// Tenable returns {"statusCode": 404, "error": "Not Found", "message": "..."}
+	// while Nessus Manager returns {"error": "..."}.
+	var tenableErr struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &tenableErr) == nil {
+		apiErr.ErrorType = tenableErr.Error
+		apiErr.Message = tenableErr.Message
+		if apiErr.Message == "" {
+			apiErr.Message = tenableErr.Error
+		}
+	}
+	return apiErr
+}
+
+// DecodeError is returned when a response from the Tenable API could not be
+// decoded into the expected structure.
+type DecodeError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode response from %s: %s", e.Endpoint, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func newDecodeError(resp *http.Response, err error) *DecodeError {
+	decodeErr := &DecodeError{Err: err}
+	if resp.Request != nil {
+		decodeErr.Endpoint = resp.Request.URL.Redacted()
+	}
+	return decodeErr
+}
@@ -0,0 +1,324 @@
+package querynessus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrExportFailed     = errors.New("scan export failed")
+	ErrExportIncomplete = errors.New("scan export download incomplete")
+)
+
+// Statuses of a scan export as reported by the export status endpoint.
+const (
+	ExportStatusLoading = "loading"
+	ExportStatusReady   = "ready"
+	ExportStatusError   = "error"
+)
+
+// DefaultExportPollPolicy checks an export's status after 2 seconds, then
+// waits half as long again each time up to 30 seconds between checks.
+var DefaultExportPollPolicy = RetryPolicy{
+	InitialBackoff: 2 * time.Second,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     1.5,
+	Jitter:         0.1,
+}
+
+// ExportStage is how far ExportScan has got.
+type ExportStage string
+
+const (
+	ExportRequested   ExportStage = "requested"
+	ExportWaiting     ExportStage = "waiting"
+	ExportDownloading ExportStage = "downloading"
+	ExportComplete    ExportStage = "complete"
+)
+
+// ExportProgress is passed to ExportOptions.Progress as an export moves
+// through its stages.
+type ExportProgress struct {
+	Stage  ExportStage
+	ScanID int
+	FileID string
+	// Status and Polls are the last status reported while waiting and the
+	// number of times it has been checked.
+	Status string
+	Polls  int
+	// Bytes is how much of the file has been downloaded, including any
+	// resumed from an earlier attempt, and TotalBytes its size, or -1 if
+	// the server didn't say.
+	Bytes      int64
+	TotalBytes int64
+	Elapsed    time.Duration
+}
+
+type ExportOptions struct {
+	Payload ExportScanPayload
+	Params  ExportScanParams
+	// OutFile is where the export is written, by default
+	// SCANID-FILEID.FORMAT in the current directory. It is downloaded to
+	// OutFile.part first, which is resumed if a download is interrupted.
+	OutFile string
+	// PollPolicy spaces out checks of the export's status, with
+	// DefaultExportPollPolicy used if it is the zero value. A MaxAttempts
+	// above 0 limits the number of checks.
+	PollPolicy RetryPolicy
+	// Timeout limits how long requesting, waiting for and downloading the
+	// export may take altogether, 0 for no limit.
+	Timeout time.Duration
+	// Progress, if set, is called at each stage, after each status check
+	// and as the file is written.
+	Progress func(ExportProgress)
+}
+
+type ExportResult struct {
+	FileID  string
+	OutFile string
+	Bytes   int64
+}
+
+// ExportScan requests an export of a scan's results, waits for Tenable to
+// prepare it and downloads it. Downloads cut off by the network are resumed
+// from where they stopped, up to the client's retry policy's attempts.
+func (tac TenableApiClient) ExportScan(ctx context.Context, scanId int, opts *ExportOptions) (*ExportResult, error) {
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	started := time.Now()
+	progress := func(update ExportProgress) {
+		if opts.Progress == nil {
+			return
+		}
+		update.ScanID = scanId
+		update.Elapsed = time.Since(started)
+		opts.Progress(update)
+	}
+	timedOut := func(err error) error {
+		if errors.Is(err, context.DeadlineExceeded) && opts.Timeout > 0 {
+			return fmt.Errorf("export of scan %d did not finish within %s: %w", scanId, opts.Timeout, err)
+		}
+		return err
+	}
+
+	fileId, _, err := tac.ExportScanResultsContext(ctx, &opts.Params, scanId, &opts.Payload)
+	if err != nil {
+		return nil, timedOut(err)
+	}
+	progress(ExportProgress{Stage: ExportRequested, FileID: fileId})
+
+	pollPolicy := opts.PollPolicy
+	if pollPolicy == (RetryPolicy{}) {
+		pollPolicy = DefaultExportPollPolicy
+	}
+	for poll := 1; ; poll++ {
+		if err := sleepContext(ctx, pollPolicy.Backoff(poll)); err != nil {
+			return nil, timedOut(err)
+		}
+		status, err := tac.scanResultExportStatus(ctx, scanId, fileId)
+		if err != nil {
+			return nil, timedOut(err)
+		}
+		progress(ExportProgress{Stage: ExportWaiting, FileID: fileId, Status: status, Polls: poll})
+		if status == ExportStatusReady {
+			break
+		}
+		if status == ExportStatusError {
+			return nil, fmt.Errorf("%w: scan %d file %s", ErrExportFailed, scanId, fileId)
+		}
+		if pollPolicy.MaxAttempts > 0 && poll >= pollPolicy.MaxAttempts {
+			return nil, fmt.Errorf("export of scan %d file %s still %s after %d status checks", scanId, fileId, status, poll)
+		}
+	}
+
+	outFile := opts.OutFile
+	if outFile == "" {
+		outFile = fmt.Sprintf("%d-%s.%s", scanId, fileId, opts.Payload.Format)
+	}
+	written, err := tac.downloadExport(ctx, scanId, fileId, outFile, func(bytes int64, totalBytes int64) {
+		progress(ExportProgress{Stage: ExportDownloading, FileID: fileId, Bytes: bytes, TotalBytes: totalBytes})
+	})
+	if err != nil {
+		return nil, timedOut(err)
+	}
+	progress(ExportProgress{Stage: ExportComplete, FileID: fileId, Bytes: written, TotalBytes: written})
+	return &ExportResult{FileID: fileId, OutFile: outFile, Bytes: written}, nil
+}
+
+// downloadExport downloads an export to outFile.part, then renames it to
+// outFile. Requests are already retried by sendRequest, so this only resumes
+// downloads cut off while the file was being received, from the end of the
+// partial file, up to the client's retry policy's attempts. Errors writing
+// the partial file fail straight away. progress, if not nil, is called as
+// the file is written.
+func (tac TenableApiClient) downloadExport(ctx context.Context, scanId int, fileId string, outFile string, progress func(bytes int64, totalBytes int64)) (int64, error) {
+	partFile := outFile + ".part"
+	maxAttempts := tac.retryPolicy.attempts()
+	for attempt := 1; ; attempt++ {
+		written, err := tac.downloadExportPart(ctx, scanId, fileId, partFile, progress)
+		if err == nil {
+			if err := os.Rename(partFile, outFile); err != nil {
+				return 0, err
+			}
+			return written, syncDir(filepath.Dir(outFile))
+		}
+		var apiErr *APIError
+		restart := errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusRequestedRangeNotSatisfiable
+		if attempt >= maxAttempts || !(restart || errors.Is(err, ErrExportIncomplete)) {
+			return 0, err
+		}
+		if restart {
+			// The partial file is no longer a prefix of the export, so start
+			// again.
+			log.Printf("Server could not resume %s, restarting download", partFile)
+			if err := os.Remove(partFile); err != nil {
+				return 0, err
+			}
+		}
+		delay := tac.retryPolicy.Backoff(attempt)
+		log.Printf("Download of %s failed (%s), resuming in %s (attempt %d of %d)", outFile, err, delay, attempt+1, maxAttempts)
+		if err := sleepContext(ctx, delay); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// downloadExportPart appends the rest of an export to partFile and checks
+// that it has the whole file, returning its size. A download cut off by the
+// network returns ErrExportIncomplete.
+func (tac TenableApiClient) downloadExportPart(ctx context.Context, scanId int, fileId string, partFile string, progress func(bytes int64, totalBytes int64)) (int64, error) {
+	out, err := os.OpenFile(partFile, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+	offset, err := out.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	var header http.Header
+	if offset > 0 {
+		header = http.Header{"Range": []string{fmt.Sprintf("bytes=%d-", offset)}}
+	}
+	endpoint := tac.endpoint("%s/%d/export/%s/download", TenableScanPath, scanId, fileId)
+	resp, err := tac.sendRequestWithHeader(ctx, "GET", endpoint, &RequestParams{}, nil, header)
+	if err != nil {
+		return 0, err
+	}
+	if resp == nil {
+		return 0, ErrEmptyResponse
+	}
+	defer resp.Body.Close()
+
+	totalBytes := int64(-1)
+	if resp.StatusCode == http.StatusPartialContent {
+		start, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return 0, err
+		}
+		if start != offset {
+			return 0, fmt.Errorf("asked to resume %s at byte %d but the server resumed at %d", partFile, offset, start)
+		}
+		totalBytes = total
+	} else {
+		// The server sent the whole file, so drop what was already there.
+		offset = 0
+		if err := out.Truncate(0); err != nil {
+			return 0, err
+		}
+		if _, err := out.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if resp.ContentLength >= 0 {
+			totalBytes = resp.ContentLength
+		}
+	}
+	if offset > 0 {
+		log.Printf("Resuming download of %s at byte %d", partFile, offset)
+	}
+
+	writer := &progressWriter{writer: out, written: offset, total: totalBytes, progress: progress}
+	_, copyErr := io.Copy(writer, resp.Body)
+	if writer.err != nil {
+		return writer.written, fmt.Errorf("failed to write %s: %w", partFile, writer.err)
+	}
+	// Keep what was received for the next attempt even if the copy failed.
+	if err := out.Sync(); err != nil {
+		return writer.written, fmt.Errorf("failed to write %s: %w", partFile, err)
+	}
+	if copyErr != nil {
+		if !isTransientNetworkError(copyErr) {
+			return writer.written, copyErr
+		}
+		return writer.written, fmt.Errorf("%w: cut off after %d bytes: %s", ErrExportIncomplete, writer.written, copyErr)
+	}
+	if totalBytes >= 0 && writer.written != totalBytes {
+		return writer.written, fmt.Errorf("%w: received %d of %d bytes", ErrExportIncomplete, writer.written, totalBytes)
+	}
+	return writer.written, nil
+}
+
+// parseContentRange parses a "bytes START-END/TOTAL" Content-Range header,
+// returning a total of -1 if it is given as *.
+func parseContentRange(contentRange string) (start int64, total int64, err error) {
+	invalid := fmt.Errorf("invalid Content-Range %q", contentRange)
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return 0, 0, invalid
+	}
+	contentRange = strings.TrimPrefix(contentRange, "bytes ")
+	slash := strings.IndexByte(contentRange, '/')
+	dash := strings.IndexByte(contentRange, '-')
+	if slash < 0 || dash < 0 || dash > slash {
+		return 0, 0, invalid
+	}
+	start, err = strconv.ParseInt(contentRange[:dash], 10, 64)
+	if err != nil {
+		return 0, 0, invalid
+	}
+	if contentRange[slash+1:] == "*" {
+		return start, -1, nil
+	}
+	total, err = strconv.ParseInt(contentRange[slash+1:], 10, 64)
+	if err != nil {
+		return 0, 0, invalid
+	}
+	return start, total, nil
+}
+
+// progressWriter counts the bytes written and keeps any write error, so it
+// can be told apart from an error reading the download.
+type progressWriter struct {
+	writer   io.Writer
+	written  int64
+	total    int64
+	progress func(bytes int64, totalBytes int64)
+	err      error
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.writer.Write(p)
+	pw.written += int64(n)
+	if err != nil {
+		pw.err = err
+	}
+	if pw.progress != nil {
+		pw.progress(pw.written, pw.total)
+	}
+	return n, err
+}
@@ -0,0 +1,188 @@
+package querynessus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var fastPollPolicy = RetryPolicy{InitialBackoff: time.Millisecond}
+
+// exportServer stands in for the export endpoints of scan 7, whose export
+// is file f1. The status is "loading" until polled loadingPolls times and
+// then status. The download is cut off after cutOff bytes on the first
+// request if cutOff is above 0.
+type exportServer struct {
+	counter      requestCounter
+	contents     string
+	loadingPolls int
+	status       string
+	cutOff       int
+	ranges       []string
+}
+
+func (server *exportServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	count := server.counter.add(r)
+	switch r.URL.Path {
+	case TenableScanPath + "/7/export":
+		fmt.Fprint(w, `{"file": "f1", "temp_token": "t"}`)
+	case TenableScanPath + "/7/export/f1/status":
+		status := server.status
+		if count <= server.loadingPolls {
+			status = "loading"
+		}
+		fmt.Fprintf(w, `{"status": %q}`, status)
+	case TenableScanPath + "/7/export/f1/download":
+		server.ranges = append(server.ranges, r.Header.Get("Range"))
+		start := 0
+		if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+			start, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rangeHeader, "bytes="), "-"))
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(server.contents)-1, len(server.contents)))
+			w.Header().Set("Content-Length", strconv.Itoa(len(server.contents)-start))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", strconv.Itoa(len(server.contents)))
+		}
+		if count == 1 && server.cutOff > 0 {
+			fmt.Fprint(w, server.contents[start:server.cutOff])
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		fmt.Fprint(w, server.contents[start:])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestExportScanPollsAndResumesInterruptedDownloads(t *testing.T) {
+	server := &exportServer{contents: strings.Repeat("0123456789", 100000), loadingPolls: 2, status: "ready", cutOff: 300000}
+	client := newTestClient(t, server)
+	outFile := filepath.Join(t.TempDir(), "scan.nessus")
+	var stages []ExportStage
+	var lastBytes int64
+	result, err := client.ExportScan(context.Background(), 7, &ExportOptions{
+		Payload:    ExportScanPayload{Format: "nessus"},
+		OutFile:    outFile,
+		PollPolicy: fastPollPolicy,
+		Progress: func(progress ExportProgress) {
+			if len(stages) == 0 || stages[len(stages)-1] != progress.Stage {
+				stages = append(stages, progress.Stage)
+			}
+			lastBytes = progress.Bytes
+		},
+	})
+	if err != nil {
+		t.Fatalf("ExportScan: %s", err)
+	}
+	if result.FileID != "f1" || result.OutFile != outFile || result.Bytes != int64(len(server.contents)) {
+		t.Errorf("got result %+v", result)
+	}
+	contents, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != server.contents {
+		t.Errorf("downloaded %d bytes that don't match the export", len(contents))
+	}
+	if _, err := os.Stat(outFile + ".part"); !os.IsNotExist(err) {
+		t.Errorf("partial file left behind: %v", err)
+	}
+	if got := server.counter.get(TenableScanPath + "/7/export/f1/status?"); got != 3 {
+		t.Errorf("checked the status %d times, want 3", got)
+	}
+	if want := []string{"", "bytes=300000-"}; fmt.Sprint(server.ranges) != fmt.Sprint(want) {
+		t.Errorf("requested ranges %q, want %q", server.ranges, want)
+	}
+	wantStages := []ExportStage{ExportRequested, ExportWaiting, ExportDownloading, ExportComplete}
+	if fmt.Sprint(stages) != fmt.Sprint(wantStages) || lastBytes != int64(len(server.contents)) {
+		t.Errorf("progress went through %v ending at %d bytes", stages, lastBytes)
+	}
+}
+
+func TestExportScanResumesPartialFileFromEarlierRun(t *testing.T) {
+	server := &exportServer{contents: "<NessusClientData_v2/>", status: "ready"}
+	client := newTestClient(t, server)
+	outFile := filepath.Join(t.TempDir(), "scan.nessus")
+	if err := ioutil.WriteFile(outFile+".part", []byte(server.contents[:10]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ExportScan(context.Background(), 7, &ExportOptions{OutFile: outFile, PollPolicy: fastPollPolicy}); err != nil {
+		t.Fatalf("ExportScan: %s", err)
+	}
+	if contents, _ := ioutil.ReadFile(outFile); string(contents) != server.contents {
+		t.Errorf("downloaded %q, want %q", contents, server.contents)
+	}
+	if want := []string{"bytes=10-"}; fmt.Sprint(server.ranges) != fmt.Sprint(want) {
+		t.Errorf("requested ranges %q, want %q", server.ranges, want)
+	}
+}
+
+func TestExportScanFailsOnErrorStatus(t *testing.T) {
+	server := &exportServer{loadingPolls: 1, status: "error"}
+	client := newTestClient(t, server)
+	_, err := client.ExportScan(context.Background(), 7, &ExportOptions{OutFile: filepath.Join(t.TempDir(), "scan.nessus"), PollPolicy: fastPollPolicy})
+	if !errors.Is(err, ErrExportFailed) {
+		t.Errorf("got %v, want ErrExportFailed", err)
+	}
+}
+
+func TestExportScanGivesUpAfterTimeout(t *testing.T) {
+	server := &exportServer{loadingPolls: 1 << 30}
+	client := newTestClient(t, server)
+	_, err := client.ExportScan(context.Background(), 7, &ExportOptions{PollPolicy: fastPollPolicy, Timeout: 50 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestExportScanLimitsStatusChecks(t *testing.T) {
+	server := &exportServer{loadingPolls: 1 << 30}
+	client := newTestClient(t, server)
+	policy := fastPollPolicy
+	policy.MaxAttempts = 4
+	if _, err := client.ExportScan(context.Background(), 7, &ExportOptions{PollPolicy: policy}); err == nil {
+		t.Fatal("ExportScan succeeded, want an error")
+	}
+	if got := server.counter.get(TenableScanPath + "/7/export/f1/status?"); got != 4 {
+		t.Errorf("checked the status %d times, want 4", got)
+	}
+}
+
+func TestExportScanDoesNotRetryWriteErrors(t *testing.T) {
+	server := &exportServer{contents: "<NessusClientData_v2/>", status: "ready"}
+	client := newTestClient(t, server)
+	outFile := filepath.Join(t.TempDir(), "missing", "scan.nessus")
+	if _, err := client.ExportScan(context.Background(), 7, &ExportOptions{OutFile: outFile, PollPolicy: fastPollPolicy}); err == nil {
+		t.Fatal("ExportScan succeeded, want an error")
+	}
+	if got := server.counter.get(TenableScanPath + "/7/export/f1/download?"); got != 0 {
+		t.Errorf("requested the download %d times, want 0", got)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	for _, test := range []struct {
+		header       string
+		start, total int64
+		ok           bool
+	}{
+		{"bytes 10-99/100", 10, 100, true},
+		{"bytes 0-9/*", 0, -1, true},
+		{"bytes */100", 0, 0, false},
+		{"items 0-9/10", 0, 0, false},
+	} {
+		start, total, err := parseContentRange(test.header)
+		if (err == nil) != test.ok || start != test.start || total != test.total {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v", test.header, start, total, err)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package querynessus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidExportFilter = errors.New("invalid export filter")
+
+// Qualities compare an export filter's field to its value.
+const (
+	QualityEqual       = "eq"
+	QualityNotEqual    = "neq"
+	QualityMatch       = "match"
+	QualityNotMatch    = "nmatch"
+	QualityGreaterThan = "gt"
+	QualityLessThan    = "lt"
+)
+
+// ExportFilter is one condition on the findings a scan export includes, such
+// as severity gt 2 or plugin_family eq "Web Servers".
+type ExportFilter struct {
+	Filter  string
+	Quality string
+	Value   string
+}
+
+// SeverityAtLeast keeps findings of severity or above, from 0 for info to 4
+// for critical.
+func SeverityAtLeast(severity int) ExportFilter {
+	return ExportFilter{Filter: "severity", Quality: QualityGreaterThan, Value: strconv.Itoa(severity - 1)}
+}
+
+func PluginFamilyIs(family string) ExportFilter {
+	return ExportFilter{Filter: "plugin_family", Quality: QualityEqual, Value: family}
+}
+
+func PluginIDIs(pluginId int) ExportFilter {
+	return ExportFilter{Filter: "plugin_id", Quality: QualityEqual, Value: strconv.Itoa(pluginId)}
+}
+
+// PluginNameContains keeps findings whose plugin name contains text.
+func PluginNameContains(text string) ExportFilter {
+	return ExportFilter{Filter: "plugin_name", Quality: QualityMatch, Value: text}
+}
+
+func CVEIs(cve string) ExportFilter {
+	return ExportFilter{Filter: "cve", Quality: QualityEqual, Value: normaliseCVE(cve)}
+}
+
+// exportSeverities are the names ParseExportFilter accepts for severity
+// values.
+var exportSeverities = map[string]int{"none": 0, "info": 0, "low": 1, "medium": 2, "high": 3, "critical": 4}
+
+// ParseExportFilter parses a filter written as FIELD OP VALUE, where OP is
+// one of = != ~ (contains) !~ > < >= <=, e.g. 'severity >= high' or
+// 'plugin_family = Web Servers'. Severities may be given by name, and >= and
+// <= only work with whole numbers as Tenable only has > and <.
+func ParseExportFilter(expression string) (ExportFilter, error) {
+	opStart := strings.IndexAny(expression, "=!~<>")
+	if opStart < 0 {
+		return ExportFilter{}, fmt.Errorf("%w: %q has no operator", ErrInvalidExportFilter, expression)
+	}
+	opEnd := opStart + 1
+	if opEnd < len(expression) && strings.IndexByte("=~", expression[opEnd]) >= 0 {
+		opEnd++
+	}
+	field := strings.TrimSpace(expression[:opStart])
+	op := expression[opStart:opEnd]
+	value := strings.TrimSpace(expression[opEnd:])
+	if field == "" || value == "" {
+		return ExportFilter{}, fmt.Errorf("%w: %q needs a field and a value", ErrInvalidExportFilter, expression)
+	}
+	if field == "severity" {
+		if severity, ok := exportSeverities[strings.ToLower(value)]; ok {
+			value = strconv.Itoa(severity)
+		}
+	}
+
+	filter := ExportFilter{Filter: field, Value: value}
+	switch op {
+	case "=", "==":
+		filter.Quality = QualityEqual
+	case "!=":
+		filter.Quality = QualityNotEqual
+	case "~":
+		filter.Quality = QualityMatch
+	case "!~":
+		filter.Quality = QualityNotMatch
+	case ">":
+		filter.Quality = QualityGreaterThan
+	case "<":
+		filter.Quality = QualityLessThan
+	case ">=", "<=":
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return ExportFilter{}, fmt.Errorf("%w: %q: %s needs a whole number", ErrInvalidExportFilter, expression, op)
+		}
+		if op == ">=" {
+			filter.Quality, filter.Value = QualityGreaterThan, strconv.Itoa(number-1)
+		} else {
+			filter.Quality, filter.Value = QualityLessThan, strconv.Itoa(number+1)
+		}
+	default:
+		return ExportFilter{}, fmt.Errorf("%w: %q: unknown operator %s", ErrInvalidExportFilter, expression, op)
+	}
+	return filter, nil
+}
+
+// ExportFilters are the conditions on an export, which must all match
+// unless MatchAny is set.
+type ExportFilters struct {
+	Filters  []ExportFilter
+	MatchAny bool
+}
+
+// Add appends filters, returning the ExportFilters so calls can be chained:
+//
+//	filters := (&querynessus.ExportFilters{}).Add(querynessus.SeverityAtLeast(3), querynessus.PluginFamilyIs("Web Servers"))
+func (filters *ExportFilters) Add(filter ...ExportFilter) *ExportFilters {
+	filters.Filters = append(filters.Filters, filter...)
+	return filters
+}
+
+// ExportChapter is a section of an html or pdf export.
+type ExportChapter string
+
+const (
+	ChapterHostsSummary    ExportChapter = "vuln_hosts_summary"
+	ChapterVulnsByHost     ExportChapter = "vuln_by_host"
+	ChapterVulnsByPlugin   ExportChapter = "vuln_by_plugin"
+	ChapterComplianceExec  ExportChapter = "compliance_exec"
+	ChapterCompliance      ExportChapter = "compliance"
+	ChapterRemediations    ExportChapter = "remediations"
+	ChapterExecutiveReport ExportChapter = "exec_report"
+)
+
+var exportChapters = map[ExportChapter]bool{
+	ChapterHostsSummary:    true,
+	ChapterVulnsByHost:     true,
+	ChapterVulnsByPlugin:   true,
+	ChapterComplianceExec:  true,
+	ChapterCompliance:      true,
+	ChapterRemediations:    true,
+	ChapterExecutiveReport: true,
+}
+
+// ParseExportChapters parses a comma separated list of chapters, e.g.
+// "vuln_hosts_summary,vuln_by_plugin".
+func ParseExportChapters(chapters string) ([]ExportChapter, error) {
+	var parsed []ExportChapter
+	for _, name := range strings.Split(chapters, ",") {
+		chapter := ExportChapter(strings.TrimSpace(name))
+		if chapter == "" {
+			continue
+		}
+		if !exportChapters[chapter] {
+			return nil, fmt.Errorf("unknown export chapter %q", chapter)
+		}
+		parsed = append(parsed, chapter)
+	}
+	return parsed, nil
+}
+
+func isReportFormat(format string) bool {
+	return format == "html" || format == "pdf"
+}
+
+// validate checks that html and pdf exports, and only those, have chapters.
+func (payload *ExportScanPayload) validate() error {
+	if isReportFormat(payload.Format) && len(payload.Chapters) == 0 {
+		return fmt.Errorf("%s exports need at least one chapter", payload.Format)
+	}
+	if !isReportFormat(payload.Format) && len(payload.Chapters) > 0 {
+		return fmt.Errorf("%s exports don't have chapters", payload.Format)
+	}
+	return nil
+}
+
+func (payload ExportScanPayload) MarshalJSON() ([]byte, error) {
+	type exportScanPayloadJSON ExportScanPayload
+	body, err := json.Marshal(exportScanPayloadJSON(payload))
+	if err != nil {
+		return nil, err
+	}
+	if payload.Filters == nil && len(payload.Chapters) == 0 {
+		return body, nil
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{}, len(raw))
+	for name, value := range raw {
+		fields[name] = value
+	}
+	if payload.Filters != nil {
+		for i, filter := range payload.Filters.Filters {
+			fields[fmt.Sprintf("filter.%d.filter", i)] = filter.Filter
+			fields[fmt.Sprintf("filter.%d.quality", i)] = filter.Quality
+			fields[fmt.Sprintf("filter.%d.value", i)] = filter.Value
+		}
+		if len(payload.Filters.Filters) > 0 {
+			fields["filter.search_type"] = "and"
+			if payload.Filters.MatchAny {
+				fields["filter.search_type"] = "or"
+			}
+		}
+	}
+	if len(payload.Chapters) > 0 {
+		chapters := make([]string, 0, len(payload.Chapters))
+		for _, chapter := range payload.Chapters {
+			chapters = append(chapters, string(chapter))
+		}
+		fields["chapters"] = strings.Join(chapters, ";")
+	}
+	return json.Marshal(fields)
+}
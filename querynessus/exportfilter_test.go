@@ -0,0 +1,148 @@
+package querynessus
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseExportFilter(t *testing.T) {
+	for _, test := range []struct {
+		expression string
+		want       ExportFilter
+	}{
+		// Tenable only has gt and lt, so >= and <= move the value by one.
+		{"severity >= high", ExportFilter{"severity", QualityGreaterThan, "2"}},
+		{"severity<=3", ExportFilter{"severity", QualityLessThan, "4"}},
+		{"severity >= info", ExportFilter{"severity", QualityGreaterThan, "-1"}},
+		{"port >= 1024", ExportFilter{"port", QualityGreaterThan, "1023"}},
+		{"severity > Medium", ExportFilter{"severity", QualityGreaterThan, "2"}},
+		{"severity = CRITICAL", ExportFilter{"severity", QualityEqual, "4"}},
+		{"severity == none", ExportFilter{"severity", QualityEqual, "0"}},
+		{"severity < low", ExportFilter{"severity", QualityLessThan, "1"}},
+		// Severity names are only translated for the severity field.
+		{"plugin_name = high", ExportFilter{"plugin_name", QualityEqual, "high"}},
+		{"plugin_family = Web Servers", ExportFilter{"plugin_family", QualityEqual, "Web Servers"}},
+		{"cve != CVE-2021-44228", ExportFilter{"cve", QualityNotEqual, "CVE-2021-44228"}},
+		{"plugin_name ~ OpenSSL", ExportFilter{"plugin_name", QualityMatch, "OpenSSL"}},
+		{"plugin_name !~ Windows", ExportFilter{"plugin_name", QualityNotMatch, "Windows"}},
+		{"plugin_name ~ a=b", ExportFilter{"plugin_name", QualityMatch, "a=b"}},
+		{"port < 1024", ExportFilter{"port", QualityLessThan, "1024"}},
+	} {
+		filter, err := ParseExportFilter(test.expression)
+		if err != nil {
+			t.Errorf("ParseExportFilter(%q) failed: %v", test.expression, err)
+			continue
+		}
+		if filter != test.want {
+			t.Errorf("ParseExportFilter(%q) = %+v, want %+v", test.expression, filter, test.want)
+		}
+	}
+}
+
+func TestParseExportFilterErrors(t *testing.T) {
+	for _, test := range []struct {
+		expression string
+		want       string
+	}{
+		{"severity high", `invalid export filter: "severity high" has no operator`},
+		{"= high", `invalid export filter: "= high" needs a field and a value`},
+		{"severity >=", `invalid export filter: "severity >=" needs a field and a value`},
+		{"port >= 1.5", `invalid export filter: "port >= 1.5": >= needs a whole number`},
+		{"plugin_name <= z", `invalid export filter: "plugin_name <= z": <= needs a whole number`},
+		{"plugin_name ! z", `invalid export filter: "plugin_name ! z": unknown operator !`},
+	} {
+		_, err := ParseExportFilter(test.expression)
+		if !errors.Is(err, ErrInvalidExportFilter) || err.Error() != test.want {
+			t.Errorf("ParseExportFilter(%q) returned %v, want %s", test.expression, err, test.want)
+		}
+	}
+}
+
+func TestExportFilterConstructors(t *testing.T) {
+	for _, test := range []struct {
+		got  ExportFilter
+		want ExportFilter
+	}{
+		{SeverityAtLeast(3), ExportFilter{"severity", QualityGreaterThan, "2"}},
+		{PluginFamilyIs("Web Servers"), ExportFilter{"plugin_family", QualityEqual, "Web Servers"}},
+		{PluginIDIs(19506), ExportFilter{"plugin_id", QualityEqual, "19506"}},
+		{PluginNameContains("OpenSSL"), ExportFilter{"plugin_name", QualityMatch, "OpenSSL"}},
+		{CVEIs(" cve-2021-44228 "), ExportFilter{"cve", QualityEqual, "CVE-2021-44228"}},
+	} {
+		if test.got != test.want {
+			t.Errorf("got %+v, want %+v", test.got, test.want)
+		}
+	}
+}
+
+func TestExportScanPayloadMarshalJSON(t *testing.T) {
+	highWebServers := (&ExportFilters{}).Add(SeverityAtLeast(3), PluginFamilyIs("Web Servers"))
+	parsed, err := ParseExportFilter("severity <= medium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name    string
+		payload ExportScanPayload
+		want    string
+	}{
+		{"plain", ExportScanPayload{Format: "nessus"},
+			`{"format":"nessus"}`},
+		{"no filters", ExportScanPayload{Format: "nessus", Filters: &ExportFilters{MatchAny: true}},
+			`{"format":"nessus"}`},
+		{"all filters", ExportScanPayload{Format: "csv", Filters: highWebServers},
+			`{"filter.0.filter":"severity","filter.0.quality":"gt","filter.0.value":"2",` +
+				`"filter.1.filter":"plugin_family","filter.1.quality":"eq","filter.1.value":"Web Servers",` +
+				`"filter.search_type":"and","format":"csv"}`},
+		{"any filter", ExportScanPayload{Format: "csv", Filters: &ExportFilters{Filters: []ExportFilter{parsed}, MatchAny: true}},
+			`{"filter.0.filter":"severity","filter.0.quality":"lt","filter.0.value":"3","filter.search_type":"or","format":"csv"}`},
+		{"chapters", ExportScanPayload{Format: "pdf", Password: "secret", AssetID: 7, Chapters: []ExportChapter{ChapterHostsSummary, ChapterVulnsByPlugin}},
+			`{"asset_id":7,"chapters":"vuln_hosts_summary;vuln_by_plugin","format":"pdf","password":"secret"}`},
+		{"filters and chapters", ExportScanPayload{Format: "html", Filters: (&ExportFilters{}).Add(CVEIs("CVE-2021-44228")), Chapters: []ExportChapter{ChapterRemediations}},
+			`{"chapters":"remediations","filter.0.filter":"cve","filter.0.quality":"eq","filter.0.value":"CVE-2021-44228","filter.search_type":"and","format":"html"}`},
+	} {
+		data, err := json.Marshal(test.payload)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if string(data) != test.want {
+			t.Errorf("%s: marshalled to\n%s\nwant\n%s", test.name, data, test.want)
+		}
+		// ExportScanResults marshals a pointer, which must come out the same.
+		if pointerData, _ := json.Marshal(&test.payload); string(pointerData) != string(data) {
+			t.Errorf("%s: pointer marshalled to %s", test.name, pointerData)
+		}
+	}
+}
+
+func TestParseExportChapters(t *testing.T) {
+	chapters, err := ParseExportChapters(" vuln_hosts_summary,vuln_by_plugin ,")
+	if err != nil || !reflect.DeepEqual(chapters, []ExportChapter{ChapterHostsSummary, ChapterVulnsByPlugin}) {
+		t.Errorf("ParseExportChapters returned %v, %v", chapters, err)
+	}
+	if chapters, err := ParseExportChapters(""); err != nil || len(chapters) != 0 {
+		t.Errorf("ParseExportChapters of nothing returned %v, %v", chapters, err)
+	}
+	if _, err := ParseExportChapters("vuln_by_host,summary"); err == nil || err.Error() != `unknown export chapter "summary"` {
+		t.Errorf("ParseExportChapters of an unknown chapter returned %v", err)
+	}
+}
+
+func TestExportScanPayloadValidate(t *testing.T) {
+	for _, test := range []struct {
+		payload ExportScanPayload
+		valid   bool
+	}{
+		{ExportScanPayload{Format: "nessus"}, true},
+		{ExportScanPayload{Format: "pdf", Chapters: []ExportChapter{ChapterExecutiveReport}}, true},
+		{ExportScanPayload{Format: "html"}, false},
+		{ExportScanPayload{Format: "csv", Chapters: []ExportChapter{ChapterVulnsByHost}}, false},
+	} {
+		if err := test.payload.validate(); (err == nil) != test.valid {
+			t.Errorf("validate of %+v returned %v", test.payload, err)
+		}
+	}
+}
@@ -0,0 +1,581 @@
+package querynessus
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// PluginFilter is a compiled filter expression over PluginDetails, e.g.
+//
+//	cvss3_base_score >= 9 and exploit_available and family ~ "Windows"
+//
+// Fields are named by their JSON keys. Attribute fields can be used without
+// the "attributes." prefix and nested structs are reached with dots, such as
+// vpr.score. Operators are == (or =), !=, <, <=, >, >=, ~ (case insensitive
+// contains) and !~. String equality is case insensitive. A comparison against
+// a list field matches if any element matches, and a field on its own is true
+// when it is true, non-zero or non-empty. Comparisons combine with and, or,
+// not and parentheses.
+type PluginFilter struct {
+	expression string
+	root       filterNode
+}
+
+func ParsePluginFilter(expression string) (*PluginFilter, error) {
+	tokens, err := lexFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+	parser := &filterParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !parser.done() {
+		return nil, fmt.Errorf("unexpected %q at position %d", parser.peek().text, parser.peek().pos)
+	}
+	return &PluginFilter{
+		expression: expression,
+		root:       root,
+	}, nil
+}
+
+func (filter *PluginFilter) Match(plugin *PluginDetails) bool {
+	return filter.root.match(reflect.ValueOf(plugin).Elem())
+}
+
+func (filter *PluginFilter) String() string {
+	return filter.expression
+}
+
+func (pluginsPage *PluginListPage) Filter(filter *PluginFilter) []PluginDetails {
+	var matches []PluginDetails
+	for i := range pluginsPage.Data.PluginDetails {
+		if filter.Match(&pluginsPage.Data.PluginDetails[i]) {
+			matches = append(matches, pluginsPage.Data.PluginDetails[i])
+		}
+	}
+	return matches
+}
+
+// Fields
+
+type filterField struct {
+	name  string
+	index []int
+	kind  reflect.Kind
+	elem  reflect.Kind
+}
+
+var filterFieldAliases = map[string]string{
+	"family": "family_name",
+}
+
+var filterFields = buildFilterFields()
+
+func jsonFieldName(field reflect.StructField) string {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	name := strings.Split(tag, ",")[0]
+	if name == "" {
+		name = field.Name
+	}
+	return strings.ToLower(name)
+}
+
+func buildFilterFields() map[string]filterField {
+	fields := map[string]filterField{}
+	var walk func(t reflect.Type, prefix string, index []int, flatten bool)
+	walk = func(t reflect.Type, prefix string, index []int, flatten bool) {
+		for i := 0; i < t.NumField(); i++ {
+			structField := t.Field(i)
+			if structField.PkgPath != "" {
+				continue
+			}
+			name := jsonFieldName(structField)
+			if name == "" {
+				continue
+			}
+			fieldIndex := append(append([]int{}, index...), i)
+			fieldType := structField.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			names := []string{prefix + name}
+			if flatten {
+				names = append(names, name)
+			}
+			if fieldType.Kind() == reflect.Struct {
+				for _, nestedPrefix := range names {
+					walk(fieldType, nestedPrefix+".", fieldIndex, false)
+				}
+				continue
+			}
+			field := filterField{index: fieldIndex, kind: fieldType.Kind()}
+			if fieldType.Kind() == reflect.Slice {
+				field.elem = fieldType.Elem().Kind()
+			}
+			for _, fieldName := range names {
+				if _, exists := fields[fieldName]; exists {
+					continue
+				}
+				field.name = fieldName
+				fields[fieldName] = field
+			}
+		}
+	}
+	pluginType := reflect.TypeOf(PluginDetails{})
+	for i := 0; i < pluginType.NumField(); i++ {
+		structField := pluginType.Field(i)
+		if jsonFieldName(structField) == "attributes" {
+			walk(structField.Type, "attributes.", []int{i}, true)
+		}
+	}
+	walk(pluginType, "", nil, false)
+	return fields
+}
+
+// FilterFieldNames lists the field names usable in a PluginFilter.
+func FilterFieldNames() []string {
+	names := make([]string, 0, len(filterFields))
+	for name := range filterFields {
+		if !strings.HasPrefix(name, "attributes.") {
+			names = append(names, name)
+		}
+	}
+	for alias := range filterFieldAliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupFilterField(name string) (filterField, bool) {
+	name = strings.ToLower(name)
+	if target, ok := filterFieldAliases[name]; ok {
+		name = target
+	}
+	field, ok := filterFields[name]
+	return field, ok
+}
+
+func (field filterField) value(plugin reflect.Value) (reflect.Value, bool) {
+	value := plugin
+	for _, i := range field.index {
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return reflect.Value{}, false
+			}
+			value = value.Elem()
+		}
+		value = value.Field(i)
+	}
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return reflect.Value{}, false
+		}
+		value = value.Elem()
+	}
+	return value, true
+}
+
+// Evaluation
+
+type filterNode interface {
+	match(plugin reflect.Value) bool
+}
+
+type andNode struct {
+	left, right filterNode
+}
+
+func (node andNode) match(plugin reflect.Value) bool {
+	return node.left.match(plugin) && node.right.match(plugin)
+}
+
+type orNode struct {
+	left, right filterNode
+}
+
+func (node orNode) match(plugin reflect.Value) bool {
+	return node.left.match(plugin) || node.right.match(plugin)
+}
+
+type notNode struct {
+	operand filterNode
+}
+
+func (node notNode) match(plugin reflect.Value) bool {
+	return !node.operand.match(plugin)
+}
+
+type truthyNode struct {
+	field filterField
+}
+
+func (node truthyNode) match(plugin reflect.Value) bool {
+	value, ok := node.field.value(plugin)
+	if !ok {
+		return false
+	}
+	switch value.Kind() {
+	case reflect.Bool:
+		return value.Bool()
+	case reflect.Slice, reflect.Map, reflect.String:
+		return value.Len() > 0
+	}
+	return !value.IsZero()
+}
+
+type comparisonNode struct {
+	field    filterField
+	operator string
+	text     string
+	number   float64
+	boolean  bool
+}
+
+func (node comparisonNode) match(plugin reflect.Value) bool {
+	value, ok := node.field.value(plugin)
+	if !ok {
+		return false
+	}
+	if value.Kind() != reflect.Slice {
+		return node.compare(node.operator, value)
+	}
+	// A negated comparison against a list holds when no element matches.
+	operator, negated := node.operator, false
+	switch operator {
+	case "!=":
+		operator, negated = "==", true
+	case "!~":
+		operator, negated = "~", true
+	}
+	for i := 0; i < value.Len(); i++ {
+		if node.compare(operator, value.Index(i)) {
+			return !negated
+		}
+	}
+	return negated
+}
+
+func (node comparisonNode) compare(operator string, value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Bool:
+		return compareOrdered(operator, boolToFloat(value.Bool()), boolToFloat(node.boolean))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(operator, float64(value.Int()), node.number)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return compareOrdered(operator, float64(value.Uint()), node.number)
+	case reflect.Float32:
+		// Round the literal the same way so 9.8 == 9.8 holds for float32 scores.
+		return compareOrdered(operator, value.Float(), float64(float32(node.number)))
+	case reflect.Float64:
+		return compareOrdered(operator, value.Float(), node.number)
+	case reflect.String:
+		return compareStrings(operator, value.String(), node.text)
+	}
+	return compareStrings(operator, fmt.Sprint(value.Interface()), node.text)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func compareOrdered(operator string, a float64, b float64) bool {
+	switch operator {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+func compareStrings(operator string, a string, b string) bool {
+	lowerA := strings.ToLower(a)
+	lowerB := strings.ToLower(b)
+	switch operator {
+	case "==":
+		return lowerA == lowerB
+	case "!=":
+		return lowerA != lowerB
+	case "~":
+		return strings.Contains(lowerA, lowerB)
+	case "!~":
+		return !strings.Contains(lowerA, lowerB)
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+// Lexing
+
+type filterTokenKind int
+
+const (
+	tokenEOF filterTokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenAnd
+	tokenOr
+	tokenNot
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	pos  int
+}
+
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+func isIdentPart(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.-:/*", r)
+}
+
+func lexFilter(expression string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(expression)
+	for pos := 0; pos < len(runes); {
+		r := runes[pos]
+		switch {
+		case unicode.IsSpace(r):
+			pos += 1
+		case r == '(':
+			tokens = append(tokens, filterToken{tokenLeftParen, "(", pos})
+			pos += 1
+		case r == ')':
+			tokens = append(tokens, filterToken{tokenRightParen, ")", pos})
+			pos += 1
+		case r == '"' || r == '\'':
+			start := pos
+			var text strings.Builder
+			pos += 1
+			for ; pos < len(runes) && runes[pos] != r; pos++ {
+				if runes[pos] == '\\' && pos+1 < len(runes) {
+					pos += 1
+				}
+				text.WriteRune(runes[pos])
+			}
+			if pos >= len(runes) {
+				return nil, fmt.Errorf("unterminated string starting at position %d", start)
+			}
+			pos += 1
+			tokens = append(tokens, filterToken{tokenString, text.String(), start})
+		case unicode.IsDigit(r) || (r == '-' && pos+1 < len(runes) && unicode.IsDigit(runes[pos+1])):
+			start := pos
+			pos += 1
+			for pos < len(runes) && isIdentPart(runes[pos]) {
+				pos += 1
+			}
+			tokens = append(tokens, filterToken{tokenNumber, string(runes[start:pos]), start})
+		case isIdentStart(r):
+			start := pos
+			for pos < len(runes) && isIdentPart(runes[pos]) {
+				pos += 1
+			}
+			word := string(runes[start:pos])
+			switch strings.ToLower(word) {
+			case "and":
+				tokens = append(tokens, filterToken{tokenAnd, word, start})
+			case "or":
+				tokens = append(tokens, filterToken{tokenOr, word, start})
+			case "not":
+				tokens = append(tokens, filterToken{tokenNot, word, start})
+			default:
+				tokens = append(tokens, filterToken{tokenIdent, word, start})
+			}
+		default:
+			start := pos
+			two := ""
+			if pos+1 < len(runes) {
+				two = string(runes[pos : pos+2])
+			}
+			switch {
+			case two == "&&":
+				tokens = append(tokens, filterToken{tokenAnd, two, start})
+				pos += 2
+			case two == "||":
+				tokens = append(tokens, filterToken{tokenOr, two, start})
+				pos += 2
+			case two == "==" || two == "!=" || two == "<=" || two == ">=" || two == "!~":
+				tokens = append(tokens, filterToken{tokenOperator, two, start})
+				pos += 2
+			case r == '=':
+				tokens = append(tokens, filterToken{tokenOperator, "==", start})
+				pos += 1
+			case r == '<' || r == '>' || r == '~':
+				tokens = append(tokens, filterToken{tokenOperator, string(r), start})
+				pos += 1
+			case r == '!':
+				tokens = append(tokens, filterToken{tokenNot, "!", start})
+				pos += 1
+			default:
+				return nil, fmt.Errorf("unexpected character %q at position %d", r, pos)
+			}
+		}
+	}
+	return append(tokens, filterToken{tokenEOF, "end of expression", len(runes)}), nil
+}
+
+// Parsing
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (parser *filterParser) peek() filterToken {
+	return parser.tokens[parser.pos]
+}
+
+func (parser *filterParser) next() filterToken {
+	token := parser.tokens[parser.pos]
+	if token.kind != tokenEOF {
+		parser.pos += 1
+	}
+	return token
+}
+
+func (parser *filterParser) done() bool {
+	return parser.peek().kind == tokenEOF
+}
+
+func (parser *filterParser) parseOr() (filterNode, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for parser.peek().kind == tokenOr {
+		parser.next()
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (parser *filterParser) parseAnd() (filterNode, error) {
+	left, err := parser.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for parser.peek().kind == tokenAnd {
+		parser.next()
+		right, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (parser *filterParser) parseNot() (filterNode, error) {
+	if parser.peek().kind == tokenNot {
+		parser.next()
+		operand, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	}
+	return parser.parsePrimary()
+}
+
+func (parser *filterParser) parsePrimary() (filterNode, error) {
+	token := parser.next()
+	switch token.kind {
+	case tokenLeftParen:
+		node, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := parser.next(); closing.kind != tokenRightParen {
+			return nil, fmt.Errorf("expected ) at position %d, got %q", closing.pos, closing.text)
+		}
+		return node, nil
+	case tokenIdent:
+		field, ok := lookupFilterField(token.text)
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q at position %d", token.text, token.pos)
+		}
+		if parser.peek().kind != tokenOperator {
+			return truthyNode{field}, nil
+		}
+		return parser.parseComparison(field, parser.next())
+	}
+	return nil, fmt.Errorf("expected a field at position %d, got %q", token.pos, token.text)
+}
+
+func (parser *filterParser) parseComparison(field filterField, operator filterToken) (filterNode, error) {
+	valueToken := parser.next()
+	if valueToken.kind != tokenIdent && valueToken.kind != tokenString && valueToken.kind != tokenNumber {
+		return nil, fmt.Errorf("expected a value after %s at position %d, got %q", operator.text, valueToken.pos, valueToken.text)
+	}
+	node := comparisonNode{
+		field:    field,
+		operator: operator.text,
+		text:     valueToken.text,
+	}
+	kind := field.kind
+	if kind == reflect.Slice {
+		kind = field.elem
+	}
+	switch kind {
+	case reflect.Bool:
+		boolean, err := strconv.ParseBool(valueToken.text)
+		if err != nil {
+			return nil, fmt.Errorf("field %s is true or false, got %q", field.name, valueToken.text)
+		}
+		if operator.text != "==" && operator.text != "!=" {
+			return nil, fmt.Errorf("operator %s cannot be used with true/false field %s", operator.text, field.name)
+		}
+		node.boolean = boolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		number, err := strconv.ParseFloat(valueToken.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("field %s is a number, got %q", field.name, valueToken.text)
+		}
+		if operator.text == "~" || operator.text == "!~" {
+			return nil, fmt.Errorf("operator %s cannot be used with number field %s", operator.text, field.name)
+		}
+		node.number = number
+	}
+	return node, nil
+}
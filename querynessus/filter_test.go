@@ -0,0 +1,183 @@
+package querynessus
+
+import (
+	"fmt"
+	"testing"
+)
+
+func filterTestPlugins() []PluginDetails {
+	smb := PluginDetails{ID: 1, Name: "Windows SMB RCE", FamilyName: "Windows", Enrichment: &PluginEnrichment{KEV: true, EPSSScore: 0.97}}
+	smb.Attributes.RiskFactor = "Critical"
+	smb.Attributes.CVE = []string{"CVE-2017-0144", "CVE-2017-0145"}
+	smb.Attributes.BugtraqID = []int{96703}
+	smb.Attributes.CVSSv3BaseScore = 9.8
+	smb.Attributes.VPR.Score = 9.2
+	smb.Attributes.ExploitAvailable = true
+
+	openssl := PluginDetails{ID: 2, Name: "OpenSSL 3.0.x < 3.0.7", FamilyName: "Web Servers"}
+	openssl.Attributes.RiskFactor = "High"
+	openssl.Attributes.CVE = []string{"CVE-2022-3602"}
+	openssl.Attributes.CVSSv3BaseScore = 7.5
+
+	info := PluginDetails{ID: 3, Name: "Nessus Scan Information", FamilyName: "Settings"}
+	info.Attributes.RiskFactor = "None"
+	return []PluginDetails{smb, openssl, info}
+}
+
+func TestPluginFilterMatches(t *testing.T) {
+	plugins := filterTestPlugins()
+	for _, test := range []struct {
+		expression string
+		want       []int
+	}{
+		// Numbers, including float32 scores compared with the literal as
+		// written.
+		{"cvss3_base_score >= 9", []int{1}},
+		{"cvss3_base_score == 9.8", []int{1}},
+		{"cvss3_base_score = 7.5", []int{2}},
+		{"cvss3_base_score > 7.5", []int{1}},
+		{"cvss3_base_score <= 7.5", []int{2, 3}},
+		{"cvss3_base_score != 9.8", []int{2, 3}},
+		{"attributes.cvss3_base_score < 9.8", []int{2, 3}},
+		{"vpr.score > 9", []int{1}},
+		{"id >= 2 AND id < 3", []int{2}},
+		{"id > -1", []int{1, 2, 3}},
+
+		// Booleans and fields on their own.
+		{"exploit_available", []int{1}},
+		{"exploit_available == false", []int{2, 3}},
+		{"exploit_available != true", []int{2, 3}},
+		{"cve", []int{1, 2}},
+		{"enrichment.kev", []int{1}},
+		{"enrichment.epss_score > 0.5", []int{1}},
+
+		// Strings are case insensitive except when ordered.
+		{"family ~ win", []int{1}},
+		{"family_name == 'web servers'", []int{2}},
+		{`name == "Windows SMB RCE"`, []int{1}},
+		{`name ~ "3.0.x < 3"`, []int{2}},
+		{"name !~ openssl", []int{1, 3}},
+		{`name == 'it\'s'`, []int{}},
+		{"risk_factor < Low", []int{1, 2}},
+
+		// A list matches if any element does, and a negated comparison if
+		// none does, so empty lists match != and !~.
+		{"cve == CVE-2022-3602", []int{2}},
+		{"cve == cve-2017-0145", []int{1}},
+		{"cve != CVE-2017-0144", []int{2, 3}},
+		{"cve ~ 2017", []int{1}},
+		{"cve !~ 2017", []int{2, 3}},
+		{"bid == 96703", []int{1}},
+		{"bid != 96703", []int{2, 3}},
+
+		// not binds tighter than and, which binds tighter than or.
+		{"risk_factor == critical or risk_factor == high and exploit_available", []int{1}},
+		{"(risk_factor == critical or risk_factor == high) and not exploit_available", []int{2}},
+		{"not risk_factor == high and cve", []int{1}},
+		{"not (risk_factor == high and cve)", []int{1, 3}},
+		{"not not exploit_available", []int{1}},
+		{"!exploit_available", []int{2, 3}},
+		{"exploit_available && cvss3_base_score > 9 || id == 3", []int{1, 3}},
+		{"((id == 1))", []int{1}},
+	} {
+		filter, err := ParsePluginFilter(test.expression)
+		if err != nil {
+			t.Errorf("ParsePluginFilter(%q): %s", test.expression, err)
+			continue
+		}
+		got := []int{}
+		for i := range plugins {
+			if filter.Match(&plugins[i]) {
+				got = append(got, plugins[i].ID)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s matched %v, want %v", test.expression, got, test.want)
+		}
+	}
+}
+
+func TestParsePluginFilterErrors(t *testing.T) {
+	for _, test := range []struct {
+		expression string
+		err        string
+	}{
+		{"", `expected a field at position 0, got "end of expression"`},
+		{"and name", `expected a field at position 0, got "and"`},
+		{"unknown_field == 1", `unknown field "unknown_field" at position 0`},
+		{"id == 1 and nope", `unknown field "nope" at position 12`},
+		{"cvss3_base_score >", `expected a value after > at position 18, got "end of expression"`},
+		{"cvss3_base_score == high", `field cvss3_base_score is a number, got "high"`},
+		{"cvss3_base_score ~ 9", `operator ~ cannot be used with number field cvss3_base_score`},
+		{"exploit_available == maybe", `field exploit_available is true or false, got "maybe"`},
+		{"exploit_available > true", `operator > cannot be used with true/false field exploit_available`},
+		{"bid ~ 1", `operator ~ cannot be used with number field bid`},
+		{"(cve", `expected ) at position 4, got "end of expression"`},
+		{"id == 1)", `unexpected ")" at position 7`},
+		{"id == 1 id == 2", `unexpected "id" at position 8`},
+		{`name == "open`, `unterminated string starting at position 8`},
+		{"name $ x", `unexpected character '$' at position 5`},
+		{"name == (", `expected a value after == at position 8, got "("`},
+	} {
+		_, err := ParsePluginFilter(test.expression)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("ParsePluginFilter(%q) = %v, want %s", test.expression, err, test.err)
+		}
+	}
+}
+
+func TestLexFilter(t *testing.T) {
+	tokens, err := lexFilter(`not(cvss3_base_score>=9.5&&name ~ 'a "b"')||xref=IAVA:2021-A-0001`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []filterToken{
+		{tokenNot, "not", 0},
+		{tokenLeftParen, "(", 3},
+		{tokenIdent, "cvss3_base_score", 4},
+		{tokenOperator, ">=", 20},
+		{tokenNumber, "9.5", 22},
+		{tokenAnd, "&&", 25},
+		{tokenIdent, "name", 27},
+		{tokenOperator, "~", 32},
+		{tokenString, `a "b"`, 34},
+		{tokenRightParen, ")", 41},
+		{tokenOr, "||", 42},
+		{tokenIdent, "xref", 44},
+		{tokenOperator, "==", 48},
+		{tokenIdent, "IAVA:2021-A-0001", 49},
+		{tokenEOF, "end of expression", 65},
+	}
+	if fmt.Sprint(tokens) != fmt.Sprint(want) {
+		t.Errorf("lexed\n%v\nwant\n%v", tokens, want)
+	}
+}
+
+func TestFilterFieldNames(t *testing.T) {
+	names := map[string]bool{}
+	for _, name := range FilterFieldNames() {
+		names[name] = true
+	}
+	for _, name := range []string{"family", "family_name", "cve", "cvss3_base_score", "vpr.score", "enrichment.kev"} {
+		if !names[name] {
+			t.Errorf("FilterFieldNames doesn't include %s", name)
+		}
+	}
+	if names["attributes.cve"] {
+		t.Error("FilterFieldNames includes the attributes. prefixed duplicate of cve")
+	}
+}
+
+func TestPluginListPageFilter(t *testing.T) {
+	page := &PluginListPage{Data: PluginDetailsList{PluginDetails: filterTestPlugins()}}
+	filter, err := ParsePluginFilter("cve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matches := page.Filter(filter); len(matches) != 2 || matches[0].ID != 1 || matches[1].ID != 2 {
+		t.Errorf("Filter returned %d plugins", len(matches))
+	}
+	if filter.String() != "cve" {
+		t.Errorf("String() = %q", filter.String())
+	}
+}
@@ -0,0 +1,238 @@
+package querynessus
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/CarbonRook/go-querynessus/querynessus/nessuscsv"
+	"github.com/CarbonRook/go-querynessus/querynessus/nessusxml"
+)
+
+// Finding is a plugin's result on a host, from the API, a .nessus export or
+// a CSV export, joined by a FindingJoiner with what the plugin database
+// knows about the plugin.
+type Finding struct {
+	Scan            string `json:"scan,omitempty"`
+	Host            string `json:"host"`
+	HostIP          string `json:"host_ip,omitempty"`
+	HostFQDN        string `json:"host_fqdn,omitempty"`
+	OperatingSystem string `json:"operating_system,omitempty"`
+	// Port, Protocol, ServiceName and PluginOutput are only known for
+	// findings from exports.
+	Port         int    `json:"port"`
+	Protocol     string `json:"protocol,omitempty"`
+	ServiceName  string `json:"svc_name,omitempty"`
+	PluginID     int    `json:"plugin_id"`
+	PluginName   string `json:"plugin_name"`
+	PluginFamily string `json:"plugin_family,omitempty"`
+	Severity     int    `json:"severity"`
+	PluginOutput string `json:"plugin_output,omitempty"`
+	// CVE are the CVEs the scan reported, for when the plugin isn't in the
+	// plugin database.
+	CVE []string `json:"cve,omitempty"`
+	// Count is how many hosts the finding was on, for scan-wide findings
+	// from ScanDetails that have no Host.
+	Count int `json:"count,omitempty"`
+
+	// Plugin is set by a FindingJoiner, and stays nil if the plugin
+	// database doesn't have the plugin.
+	Plugin *PluginDetails `json:"plugin,omitempty"`
+}
+
+// FindingFromReportItem makes a Finding of an item from nessusxml or
+// nessuscsv.
+func FindingFromReportItem(scan string, host *nessusxml.ReportHost, item *nessusxml.ReportItem) Finding {
+	return Finding{
+		Scan:            scan,
+		Host:            host.Name,
+		HostIP:          host.Properties.IP(),
+		HostFQDN:        host.Properties.FQDN(),
+		OperatingSystem: host.Properties.OperatingSystem(),
+		Port:            item.Port,
+		Protocol:        item.Protocol,
+		ServiceName:     item.ServiceName,
+		PluginID:        item.PluginID,
+		PluginName:      item.PluginName,
+		PluginFamily:    item.PluginFamily,
+		Severity:        item.Severity,
+		PluginOutput:    item.PluginOutput,
+		CVE:             item.CVE,
+	}
+}
+
+// FindingsFromScanDetails makes scan-wide findings, without hosts, of the
+// vulnerabilities in a scan's details. Use FindingsFromHostDetails for
+// findings per host.
+func FindingsFromScanDetails(details *ScanDetails) []Finding {
+	findings := make([]Finding, 0, len(details.Vulnerabilities))
+	for _, vulnerability := range details.Vulnerabilities {
+		findings = append(findings, Finding{
+			Scan:         details.Info.Name,
+			PluginID:     vulnerability.PluginID,
+			PluginName:   vulnerability.PluginName,
+			PluginFamily: vulnerability.PluginFamily,
+			Severity:     vulnerability.Severity,
+			Count:        vulnerability.Count,
+		})
+	}
+	return findings
+}
+
+// FindingsFromHostDetails makes findings of the vulnerabilities found on one
+// host, as fetched with FetchScanHostDetails.
+func FindingsFromHostDetails(scan string, host *Host, details *ScanHostDetails) []Finding {
+	operatingSystem := ""
+	if len(details.Info.OperatingSystem) > 0 {
+		operatingSystem = details.Info.OperatingSystem[0]
+	}
+	findings := make([]Finding, 0, len(details.Vulnerabilities))
+	for _, vulnerability := range details.Vulnerabilities {
+		findings = append(findings, Finding{
+			Scan:            scan,
+			Host:            host.Hostname,
+			HostIP:          details.Info.HostIP,
+			HostFQDN:        details.Info.HostFQDN,
+			OperatingSystem: operatingSystem,
+			PluginID:        vulnerability.PluginID,
+			PluginName:      vulnerability.PluginName,
+			PluginFamily:    vulnerability.PluginFamily,
+			Severity:        vulnerability.Severity,
+		})
+	}
+	return findings
+}
+
+// reportItemReader is implemented by nessusxml.Reader and nessuscsv.Reader.
+type reportItemReader interface {
+	Next() bool
+	Host() *nessusxml.ReportHost
+	Item() *nessusxml.ReportItem
+	Err() error
+}
+
+// FindingReader streams the findings of a .nessus or CSV export.
+//
+//	reader, err := querynessus.NewFindingReader(file)
+//	for reader.Next() {
+//		finding := reader.Finding()
+//	}
+//	if err := reader.Err(); err != nil {
+//	}
+type FindingReader struct {
+	reader    reportItemReader
+	closer    io.Closer
+	reportXML *nessusxml.Reader
+	finding   Finding
+}
+
+// NewFindingReader tells .nessus from CSV exports by their content, and
+// decompresses gzip or zstd exports.
+func NewFindingReader(r io.Reader) (*FindingReader, error) {
+	decompressed, err := NewDecompressingReader(r)
+	if err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewReader(decompressed)
+	// Skip a byte order mark and white space to see the first character.
+	start, err := buffered.Peek(512)
+	if err != nil && err != io.EOF {
+		decompressed.Close()
+		return nil, err
+	}
+	start = bytes.TrimLeft(bytes.TrimPrefix(start, []byte("\ufeff")), " \t\r\n")
+	findingReader := &FindingReader{closer: decompressed}
+	if bytes.HasPrefix(start, []byte("<")) {
+		findingReader.reportXML = nessusxml.NewReader(buffered)
+		findingReader.reader = findingReader.reportXML
+	} else {
+		findingReader.reader = nessuscsv.NewReader(buffered)
+	}
+	return findingReader, nil
+}
+
+func (fr *FindingReader) Next() bool {
+	if !fr.reader.Next() {
+		return false
+	}
+	scan := ""
+	if fr.reportXML != nil {
+		scan = fr.reportXML.ReportName()
+	}
+	fr.finding = FindingFromReportItem(scan, fr.reader.Host(), fr.reader.Item())
+	return true
+}
+
+func (fr *FindingReader) Finding() *Finding {
+	return &fr.finding
+}
+
+func (fr *FindingReader) Err() error {
+	return fr.reader.Err()
+}
+
+// Close closes the decompressor, not the underlying reader.
+func (fr *FindingReader) Close() error {
+	return fr.closer.Close()
+}
+
+// FindingJoiner joins findings with their plugins from a plugin repository.
+// Repositories that can get single plugins, like BoltPluginRepository, are
+// read one plugin at a time; others are loaded whole once.
+type FindingJoiner struct {
+	get     func(id int) (PluginDetails, bool, error)
+	plugins map[int]*PluginDetails
+}
+
+func NewFindingJoiner(repository PluginRepository) (*FindingJoiner, error) {
+	joiner := &FindingJoiner{plugins: map[int]*PluginDetails{}}
+	if incremental, ok := repository.(IncrementalPluginRepository); ok {
+		joiner.get = incremental.Get
+		return joiner, nil
+	}
+	pluginPage, err := repository.Load()
+	if err != nil {
+		return nil, err
+	}
+	joiner.get = func(id int) (PluginDetails, bool, error) {
+		plugin, _, exists := pluginPage.Data.PluginFromId(id)
+		return *plugin, exists, nil
+	}
+	return joiner, nil
+}
+
+// Join sets finding.Plugin, and the plugin's name and family if the finding
+// doesn't have them. Findings of the same plugin share one PluginDetails.
+func (joiner *FindingJoiner) Join(finding *Finding) error {
+	plugin, cached := joiner.plugins[finding.PluginID]
+	if !cached {
+		found, exists, err := joiner.get(finding.PluginID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			plugin = &found
+		}
+		joiner.plugins[finding.PluginID] = plugin
+	}
+	finding.Plugin = plugin
+	if plugin == nil {
+		return nil
+	}
+	if finding.PluginName == "" {
+		finding.PluginName = plugin.Name
+	}
+	if finding.PluginFamily == "" {
+		finding.PluginFamily = plugin.FamilyName
+	}
+	return nil
+}
+
+func (joiner *FindingJoiner) JoinAll(findings []Finding) error {
+	for i := range findings {
+		if err := joiner.Join(&findings[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
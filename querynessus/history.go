@@ -0,0 +1,185 @@
+package querynessus
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// PluginRevision records a plugin being replaced by a newer version: when
+// the change was observed, the version that was replaced and how it differs
+// from its replacement.
+type PluginRevision struct {
+	ID         int                 `json:"id"`
+	ObservedAt time.Time           `json:"observed_at"`
+	Previous   PluginDetails       `json:"previous"`
+	Changes    []PluginFieldChange `json:"changes,omitempty"`
+}
+
+func newPluginRevision(previous *PluginDetails, current *PluginDetails, observedAt time.Time) PluginRevision {
+	return PluginRevision{
+		ID:         previous.ID,
+		ObservedAt: observedAt.UTC(),
+		Previous:   *previous,
+		Changes:    diffPlugin(previous, current),
+	}
+}
+
+// PluginHistory is every recorded revision of one plugin, oldest first.
+type PluginHistory struct {
+	ID        int              `json:"id"`
+	Revisions []PluginRevision `json:"revisions"`
+}
+
+// PluginHistoryReader is implemented by repositories that keep the versions
+// of plugins replaced by updates.
+type PluginHistoryReader interface {
+	History(id int) (*PluginHistory, error)
+}
+
+var (
+	_ PluginHistoryReader = (*JsonFilePluginRepository)(nil)
+	_ PluginHistoryReader = (*BoltPluginRepository)(nil)
+)
+
+func (history *PluginHistory) sort() {
+	sort.SliceStable(history.Revisions, func(i, j int) bool {
+		return history.Revisions[i].ObservedAt.Before(history.Revisions[j].ObservedAt)
+	})
+}
+
+// versions returns each known version of the plugin, oldest first, with the
+// time it was first observed. The time is zero for the oldest version as it
+// predates the recorded history.
+func (history *PluginHistory) versions(current *PluginDetails) ([]PluginDetails, []time.Time) {
+	versions := make([]PluginDetails, 0, len(history.Revisions)+1)
+	since := make([]time.Time, 0, len(history.Revisions)+1)
+	for i, revision := range history.Revisions {
+		versions = append(versions, revision.Previous)
+		if i == 0 {
+			since = append(since, time.Time{})
+		} else {
+			since = append(since, history.Revisions[i-1].ObservedAt)
+		}
+	}
+	if current != nil {
+		versions = append(versions, *current)
+		if len(history.Revisions) == 0 {
+			since = append(since, time.Time{})
+		} else {
+			since = append(since, history.Revisions[len(history.Revisions)-1].ObservedAt)
+		}
+	}
+	return versions, since
+}
+
+// FirstMatch answers questions like "when did the VPR go above 9?" with
+// the time the plugin first changed to a version matching filter, given
+// its current version. The time is zero if the oldest recorded version
+// already matched. It returns false if no version matched.
+func (history *PluginHistory) FirstMatch(filter *PluginFilter, current *PluginDetails) (time.Time, bool) {
+	versions, since := history.versions(current)
+	for i := range versions {
+		if filter.Match(&versions[i]) {
+			return since[i], true
+		}
+	}
+	return time.Time{}, false
+}
+
+// TrackHistory makes Merge keep each plugin version it replaces until
+// TakeRevisions is called. Repositories that keep history turn this on when
+// loading.
+func (pdl *PluginDetailsList) TrackHistory() {
+	pdl.trackHistory = true
+}
+
+// TakeRevisions returns the revisions recorded since the last call and
+// forgets them.
+func (pdl *PluginDetailsList) TakeRevisions() []PluginRevision {
+	revisions := pdl.history
+	pdl.history = nil
+	return revisions
+}
+
+// recordRevision keeps previous if it differs from current in any of the
+// DiffFields.
+func (pdl *PluginDetailsList) recordRevision(previous *PluginDetails, current *PluginDetails) {
+	if !pdl.trackHistory {
+		return
+	}
+	revision := newPluginRevision(previous, current, time.Now())
+	if len(revision.Changes) == 0 {
+		return
+	}
+	pdl.history = append(pdl.history, revision)
+}
+
+// HistoryFilename is where the history for a JSON plugin repository stored
+// in repositoryFilename is kept, one revision per line.
+func HistoryFilename(repositoryFilename string) string {
+	return repositoryFilename + ".history"
+}
+
+func appendRevisions(filename string, revisions []PluginRevision) error {
+	if len(revisions) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for i := range revisions {
+		if err := encoder.Encode(&revisions[i]); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func readRevisions(filename string, id int) (*PluginHistory, error) {
+	history := &PluginHistory{ID: id, Revisions: []PluginRevision{}}
+	file, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var revision PluginRevision
+		err := decoder.Decode(&revision)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if revision.ID == id {
+			history.Revisions = append(history.Revisions, revision)
+		}
+	}
+	history.sort()
+	return history, nil
+}
+
+func (jfpr *JsonFilePluginRepository) History(id int) (*PluginHistory, error) {
+	return readRevisions(HistoryFilename(jfpr.filename), id)
+}
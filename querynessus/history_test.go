@@ -0,0 +1,174 @@
+package querynessus
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+// vprUpdate is plugin 12345 before and after Tenable raised its VPR without
+// bumping the modification date.
+func vprUpdate() (PluginDetails, PluginDetails) {
+	before := PluginDetails{ID: 12345, Name: "OpenSSL < 3.0.7"}
+	before.Attributes.PluginModificationDate = "2024-01-01T00:00:00Z"
+	before.Attributes.VPR.Score = 6.7
+	after := before
+	after.Attributes.VPR.Score = 9.2
+	return before, after
+}
+
+func assertVPRRevision(t *testing.T, reader PluginHistoryReader, current *PluginDetails) {
+	t.Helper()
+	history, err := reader.History(12345)
+	if err != nil {
+		t.Fatalf("History: %s", err)
+	}
+	if len(history.Revisions) != 1 {
+		t.Fatalf("got %d revisions, want 1", len(history.Revisions))
+	}
+	changes := history.Revisions[0].Changes
+	if len(changes) != 1 || changes[0].Field != "vpr.score" {
+		t.Errorf("got changes %+v, want only vpr.score", changes)
+	}
+	filter, err := ParsePluginFilter("vpr.score > 9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	since, ok := history.FirstMatch(filter, current)
+	if !ok || !since.Equal(history.Revisions[0].ObservedAt) {
+		t.Errorf("FirstMatch = %s, %t, want %s", since, ok, history.Revisions[0].ObservedAt)
+	}
+}
+
+func TestJsonFileHistoryRecordsChangesWithoutNewModificationDate(t *testing.T) {
+	before, after := vprUpdate()
+	repo, err := NewJsonFilePluginRepository(filepath.Join(t.TempDir(), "plugins.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Save(&PluginListPage{Data: PluginDetailsList{PluginDetails: []PluginDetails{before}}}); err != nil {
+		t.Fatal(err)
+	}
+	page, err := repo.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCount, updatedCount, duplicateCount, err := page.Merge(&PluginListPage{Data: PluginDetailsList{PluginDetails: []PluginDetails{after}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newCount != 0 || updatedCount != 1 || duplicateCount != 0 {
+		t.Errorf("Merge = %d new, %d updated, %d duplicates, want 0, 1, 0", newCount, updatedCount, duplicateCount)
+	}
+	if err := repo.Save(page); err != nil {
+		t.Fatal(err)
+	}
+	assertVPRRevision(t, repo, &after)
+}
+
+func TestBoltHistoryRecordsChangesWithoutNewModificationDate(t *testing.T) {
+	before, after := vprUpdate()
+	repo, err := NewBoltPluginRepository(filepath.Join(t.TempDir(), "plugins.bolt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	if _, _, _, err := repo.Upsert(before); err != nil {
+		t.Fatal(err)
+	}
+	newCount, updatedCount, duplicateCount, err := repo.Upsert(after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newCount != 0 || updatedCount != 1 || duplicateCount != 0 {
+		t.Errorf("Upsert = %d new, %d updated, %d duplicates, want 0, 1, 0", newCount, updatedCount, duplicateCount)
+	}
+	if _, _, duplicateCount, _ := repo.Upsert(after); duplicateCount != 1 {
+		t.Errorf("upserting the same plugin again gave %d duplicates, want 1", duplicateCount)
+	}
+	assertVPRRevision(t, repo, &after)
+}
+
+// unchangedPage is a page as Tenable returns it, with an empty cpe list that
+// is omitted when the plugin is saved.
+const unchangedPage = `{"data": {"plugin_details": [{"id": 54321, "name": "Unchanged", "attributes": {"plugin_modification_date": "2024-01-01T00:00:00Z", "cpe": [], "cve": [], "vendor": {"name": "Acme"}}}]}}`
+
+func parsePage(t *testing.T, data string) *PluginListPage {
+	t.Helper()
+	var page PluginListPage
+	if err := json.Unmarshal([]byte(data), &page); err != nil {
+		t.Fatal(err)
+	}
+	return &page
+}
+
+func TestJsonFileHistoryIgnoresPluginsThatSurvivedASave(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "plugins.json")
+	repo, err := NewJsonFilePluginRepository(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Save(parsePage(t, unchangedPage)); err != nil {
+		t.Fatal(err)
+	}
+	page, err := repo.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCount, updatedCount, duplicateCount, err := page.Merge(parsePage(t, unchangedPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newCount != 0 || updatedCount != 0 || duplicateCount != 1 {
+		t.Errorf("Merge = %d new, %d updated, %d duplicates, want 0, 0, 1", newCount, updatedCount, duplicateCount)
+	}
+	if err := repo.Save(page); err != nil {
+		t.Fatal(err)
+	}
+	history, err := repo.History(54321)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Revisions) != 0 {
+		t.Errorf("recorded revisions %+v for an unchanged plugin", history.Revisions)
+	}
+}
+
+func TestBoltHistoryIgnoresPluginsThatSurvivedASave(t *testing.T) {
+	repo, err := NewBoltPluginRepository(filepath.Join(t.TempDir(), "plugins.bolt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	if _, _, _, err := repo.Upsert(parsePage(t, unchangedPage).Data.PluginDetails...); err != nil {
+		t.Fatal(err)
+	}
+	newCount, updatedCount, duplicateCount, err := repo.Upsert(parsePage(t, unchangedPage).Data.PluginDetails...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newCount != 0 || updatedCount != 0 || duplicateCount != 1 {
+		t.Errorf("Upsert = %d new, %d updated, %d duplicates, want 0, 0, 1", newCount, updatedCount, duplicateCount)
+	}
+	history, err := repo.History(54321)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Revisions) != 0 {
+		t.Errorf("recorded revisions %+v for an unchanged plugin", history.Revisions)
+	}
+}
+
+func TestHistorySkipsChangesOutsideDiffFields(t *testing.T) {
+	before, _ := vprUpdate()
+	after := before
+	after.Attributes.Description = "Reworded."
+	page := &PluginListPage{Data: PluginDetailsList{PluginDetails: []PluginDetails{before}}}
+	page.Data.TrackHistory()
+	if _, updatedCount, _, err := page.Merge(&PluginListPage{Data: PluginDetailsList{PluginDetails: []PluginDetails{after}}}); err != nil || updatedCount != 1 {
+		t.Fatalf("Merge updated %d plugins, %v, want 1", updatedCount, err)
+	}
+	if revisions := page.Data.TakeRevisions(); len(revisions) != 0 {
+		t.Errorf("recorded revisions %+v with no changed DiffFields", revisions)
+	}
+}
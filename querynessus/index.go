@@ -0,0 +1,240 @@
+package querynessus
+
+import (
+	"sort"
+	"strings"
+)
+
+// pluginIndex maps plugin IDs and attribute values to positions in a
+// PluginDetailsList. It is built on first lookup and kept up to date by
+// PluginListPage.Merge.
+type pluginIndex struct {
+	length   int
+	byID     map[int]int
+	byCVE    map[string]positionSet
+	byFamily map[string]positionSet
+	byCPE    map[string]positionSet
+	byXRef   map[string]positionSet
+}
+
+type positionSet map[int]struct{}
+
+func normaliseCVE(cve string) string {
+	return strings.ToUpper(strings.TrimSpace(cve))
+}
+
+func normaliseIndexKey(key string) string {
+	return strings.ToLower(strings.TrimSpace(key))
+}
+
+// normaliseXRef upper-cases a cross reference such as IAVA:2021-A-0001 and
+// drops any space around the colon.
+func normaliseXRef(xref string) string {
+	colon := strings.IndexByte(xref, ':')
+	if colon < 0 {
+		return strings.ToUpper(strings.TrimSpace(xref))
+	}
+	return strings.ToUpper(strings.TrimSpace(xref[:colon]) + ":" + strings.TrimSpace(xref[colon+1:]))
+}
+
+// pluginXRefs returns the plugin's cross references from both the xref and
+// xrefs attributes, normalised and without duplicates.
+func pluginXRefs(plugin *PluginDetails) []string {
+	seen := map[string]bool{}
+	var xrefs []string
+	add := func(xref string) {
+		xref = normaliseXRef(xref)
+		if xref == "" || seen[xref] {
+			return
+		}
+		seen[xref] = true
+		xrefs = append(xrefs, xref)
+	}
+	for _, xref := range plugin.Attributes.XRef {
+		add(xref)
+	}
+	for _, xref := range plugin.Attributes.XRefs {
+		add(xref.Type + ":" + xref.ID)
+	}
+	return xrefs
+}
+
+func newPluginIndex(plugins []PluginDetails) *pluginIndex {
+	index := &pluginIndex{
+		byID:     make(map[int]int, len(plugins)),
+		byCVE:    map[string]positionSet{},
+		byFamily: map[string]positionSet{},
+		byCPE:    map[string]positionSet{},
+		byXRef:   map[string]positionSet{},
+	}
+	for i := range plugins {
+		index.add(i, &plugins[i])
+	}
+	return index
+}
+
+func addPosition(positions map[string]positionSet, key string, position int) {
+	if key == "" {
+		return
+	}
+	set, exists := positions[key]
+	if !exists {
+		set = positionSet{}
+		positions[key] = set
+	}
+	set[position] = struct{}{}
+}
+
+func removePosition(positions map[string]positionSet, key string, position int) {
+	set, exists := positions[key]
+	if !exists {
+		return
+	}
+	delete(set, position)
+	if len(set) == 0 {
+		delete(positions, key)
+	}
+}
+
+func (index *pluginIndex) add(position int, plugin *PluginDetails) {
+	if _, exists := index.byID[plugin.ID]; !exists {
+		index.byID[plugin.ID] = position
+	}
+	for _, cve := range plugin.Attributes.CVE {
+		addPosition(index.byCVE, normaliseCVE(cve), position)
+	}
+	addPosition(index.byFamily, normaliseIndexKey(plugin.FamilyName), position)
+	for _, cpe := range plugin.Attributes.CPE {
+		addPosition(index.byCPE, normaliseIndexKey(cpe), position)
+	}
+	for _, xref := range pluginXRefs(plugin) {
+		addPosition(index.byXRef, xref, position)
+	}
+	if position >= index.length {
+		index.length = position + 1
+	}
+}
+
+func (index *pluginIndex) remove(position int, plugin *PluginDetails) {
+	for _, cve := range plugin.Attributes.CVE {
+		removePosition(index.byCVE, normaliseCVE(cve), position)
+	}
+	removePosition(index.byFamily, normaliseIndexKey(plugin.FamilyName), position)
+	for _, cpe := range plugin.Attributes.CPE {
+		removePosition(index.byCPE, normaliseIndexKey(cpe), position)
+	}
+	for _, xref := range pluginXRefs(plugin) {
+		removePosition(index.byXRef, xref, position)
+	}
+}
+
+// ensureIndex builds the index if it doesn't exist or the plugin slice has
+// changed length without going through Merge. Lookups also rebuild it when
+// they find a plugin that no longer matches, but only Reindex picks up
+// plugins changed in place to newly match.
+func (pdl *PluginDetailsList) ensureIndex() *pluginIndex {
+	if pdl.index == nil || pdl.index.length != len(pdl.PluginDetails) {
+		pdl.index = newPluginIndex(pdl.PluginDetails)
+	}
+	return pdl.index
+}
+
+// Reindex rebuilds the lookup index. Call it after changing PluginDetails
+// directly rather than through Merge.
+func (pdl *PluginDetailsList) Reindex() {
+	pdl.index = newPluginIndex(pdl.PluginDetails)
+}
+
+func (pdl *PluginDetailsList) setPlugin(position int, plugin PluginDetails) {
+	index := pdl.ensureIndex()
+	pdl.recordRevision(&pdl.PluginDetails[position], &plugin)
+	index.remove(position, &pdl.PluginDetails[position])
+	pdl.PluginDetails[position] = plugin
+	index.add(position, &pdl.PluginDetails[position])
+	if pdl.search != nil {
+		pdl.search.Add(&pdl.PluginDetails[position])
+	}
+}
+
+func (pdl *PluginDetailsList) appendPlugin(plugin PluginDetails) {
+	index := pdl.ensureIndex()
+	pdl.PluginDetails = append(pdl.PluginDetails, plugin)
+	position := len(pdl.PluginDetails) - 1
+	index.add(position, &pdl.PluginDetails[position])
+	if pdl.search != nil {
+		pdl.search.Add(&pdl.PluginDetails[position])
+	}
+}
+
+// lookup returns the plugins at the positions the index has for a value, in
+// file order. If any of them no longer matches, the slice has been changed
+// directly, so the index is rebuilt and the lookup repeated.
+func (pdl *PluginDetailsList) lookup(positions func(*pluginIndex) positionSet, matches func(*PluginDetails) bool) []PluginDetails {
+	plugins, stale := pdl.pluginsAt(positions(pdl.ensureIndex()), matches)
+	if stale {
+		pdl.Reindex()
+		plugins, _ = pdl.pluginsAt(positions(pdl.index), matches)
+	}
+	return plugins
+}
+
+// pluginsAt returns the plugins at positions in file order, and whether any
+// position is out of range or holds a plugin that doesn't match.
+func (pdl *PluginDetailsList) pluginsAt(positions positionSet, matches func(*PluginDetails) bool) ([]PluginDetails, bool) {
+	sorted := make([]int, 0, len(positions))
+	for position := range positions {
+		sorted = append(sorted, position)
+	}
+	sort.Ints(sorted)
+	plugins := make([]PluginDetails, 0, len(sorted))
+	for _, position := range sorted {
+		if position >= len(pdl.PluginDetails) || !matches(&pdl.PluginDetails[position]) {
+			return nil, true
+		}
+		plugins = append(plugins, pdl.PluginDetails[position])
+	}
+	return plugins, false
+}
+
+func (pdl *PluginDetailsList) PluginsByCVE(cve string) []PluginDetails {
+	cve = normaliseCVE(cve)
+	return pdl.lookup(func(index *pluginIndex) positionSet { return index.byCVE[cve] }, func(plugin *PluginDetails) bool {
+		for _, pluginCVE := range plugin.Attributes.CVE {
+			if normaliseCVE(pluginCVE) == cve {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (pdl *PluginDetailsList) PluginsByFamily(family string) []PluginDetails {
+	family = normaliseIndexKey(family)
+	return pdl.lookup(func(index *pluginIndex) positionSet { return index.byFamily[family] }, func(plugin *PluginDetails) bool {
+		return normaliseIndexKey(plugin.FamilyName) == family
+	})
+}
+
+func (pdl *PluginDetailsList) PluginsByCPE(cpe string) []PluginDetails {
+	cpe = normaliseIndexKey(cpe)
+	return pdl.lookup(func(index *pluginIndex) positionSet { return index.byCPE[cpe] }, func(plugin *PluginDetails) bool {
+		for _, pluginCPE := range plugin.Attributes.CPE {
+			if normaliseIndexKey(pluginCPE) == cpe {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (pdl *PluginDetailsList) PluginsByXRef(xref string) []PluginDetails {
+	xref = normaliseXRef(xref)
+	return pdl.lookup(func(index *pluginIndex) positionSet { return index.byXRef[xref] }, func(plugin *PluginDetails) bool {
+		for _, pluginXRef := range pluginXRefs(plugin) {
+			if pluginXRef == xref {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,71 @@
+package querynessus
+
+import "testing"
+
+func indexTestPlugins() *PluginDetailsList {
+	log4j := PluginDetails{ID: 1, Name: "Log4Shell", FamilyName: "Misc."}
+	log4j.Attributes.CVE = []string{"CVE-2021-44228"}
+	log4j.Attributes.XRef = []string{"IAVA:2021-A-0573"}
+	log4j.Attributes.CPE = []string{"cpe:/a:apache:log4j"}
+	openssl := PluginDetails{ID: 2, Name: "OpenSSL", FamilyName: "Web Servers"}
+	openssl.Attributes.CVE = []string{"cve-2022-3602"}
+	return &PluginDetailsList{PluginDetails: []PluginDetails{log4j, openssl}}
+}
+
+func pluginIDs(plugins []PluginDetails) []int {
+	ids := []int{}
+	for _, plugin := range plugins {
+		ids = append(ids, plugin.ID)
+	}
+	return ids
+}
+
+func TestPluginLookups(t *testing.T) {
+	list := indexTestPlugins()
+	for name, test := range map[string]struct {
+		got  []PluginDetails
+		want int
+	}{
+		"cve":    {list.PluginsByCVE(" CVE-2022-3602 "), 2},
+		"family": {list.PluginsByFamily("misc."), 1},
+		"cpe":    {list.PluginsByCPE("CPE:/A:APACHE:LOG4J"), 1},
+		"xref":   {list.PluginsByXRef("iava : 2021-A-0573"), 1},
+	} {
+		if ids := pluginIDs(test.got); len(ids) != 1 || ids[0] != test.want {
+			t.Errorf("%s lookup found %v, want [%d]", name, ids, test.want)
+		}
+	}
+}
+
+func TestPluginLookupsIgnoreStaleEntries(t *testing.T) {
+	list := indexTestPlugins()
+	list.PluginsByCVE("CVE-2021-44228")
+
+	// Replace plugin 1 without going through Merge.
+	replacement := PluginDetails{ID: 3, Name: "Replacement", FamilyName: "Windows"}
+	replacement.Attributes.CVE = []string{"CVE-2017-0144"}
+	list.PluginDetails[0] = replacement
+
+	if ids := pluginIDs(list.PluginsByCVE("CVE-2021-44228")); len(ids) != 0 {
+		t.Errorf("CVE lookup found %v after the plugin was replaced", ids)
+	}
+	if ids := pluginIDs(list.PluginsByCVE("CVE-2017-0144")); len(ids) != 1 || ids[0] != 3 {
+		t.Errorf("CVE lookup found %v, want [3]", ids)
+	}
+	if ids := pluginIDs(list.PluginsByFamily("Misc.")); len(ids) != 0 {
+		t.Errorf("family lookup found %v after the plugin was replaced", ids)
+	}
+	if _, _, exists := list.PluginFromId(1); exists {
+		t.Error("plugin 1 still found by ID after it was replaced")
+	}
+}
+
+func TestReindexPicksUpDirectChanges(t *testing.T) {
+	list := indexTestPlugins()
+	list.PluginsByCVE("CVE-2021-44228")
+	list.PluginDetails[1].Attributes.CVE = append(list.PluginDetails[1].Attributes.CVE, "CVE-2021-44228")
+	list.Reindex()
+	if ids := pluginIDs(list.PluginsByCVE("CVE-2021-44228")); len(ids) != 2 {
+		t.Errorf("CVE lookup found %v, want [1 2]", ids)
+	}
+}
@@ -0,0 +1,149 @@
+package querynessus
+
+import (
+	"context"
+	"log"
+)
+
+type pluginPageResult struct {
+	plugins []PluginDetails
+	err     error
+}
+
+// PluginIterator yields plugins page by page so callers never hold more
+// than the client's page workers worth of pages in memory.
+//
+//	it := tac.IteratePlugins(params)
+//	for it.Next(ctx) {
+//		plugin := it.Plugin()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type PluginIterator struct {
+	client TenableApiClient
+	params RequestParams
+	budget *failureBudget
+
+	started    bool
+	nextPage   int32
+	lastPage   int32
+	totalCount int
+	pending    []chan pluginPageResult
+
+	plugins []PluginDetails
+	index   int
+	current PluginDetails
+	err     error
+}
+
+func (tac TenableApiClient) IteratePlugins(params RequestParams) *PluginIterator {
+	if params.Page < 1 {
+		params.Page = 1
+	}
+	return &PluginIterator{
+		client:   tac,
+		params:   params,
+		budget:   newFailureBudget(tac.pageFailureBudget),
+		nextPage: params.Page,
+	}
+}
+
+func (it *PluginIterator) Next(ctx context.Context) bool {
+	for {
+		if it.index < len(it.plugins) {
+			it.current = it.plugins[it.index]
+			it.index += 1
+			return true
+		}
+		it.plugins = nil
+		it.index = 0
+		if it.err != nil {
+			return false
+		}
+
+		if !it.started {
+			if !it.fetchFirstPage(ctx) {
+				return false
+			}
+			continue
+		}
+
+		it.schedule(ctx)
+		if len(it.pending) == 0 {
+			return false
+		}
+		page := it.nextPage - int32(len(it.pending))
+		select {
+		case result := <-it.pending[0]:
+			it.pending = it.pending[1:]
+			if result.err != nil {
+				it.err = &PageFetchError{FailedPages: map[int32]error{page: result.err}}
+				return false
+			}
+			it.plugins = result.plugins
+		case <-ctx.Done():
+			it.err = ctx.Err()
+			return false
+		}
+	}
+}
+
+func (it *PluginIterator) fetchFirstPage(ctx context.Context) bool {
+	it.started = true
+	params := it.params
+	params.Page = it.nextPage
+	log.Printf("Requesting plugin page %d", params.Page)
+	pluginPage, err := it.client.fetchPluginPageWithRetries(ctx, params, it.budget)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	pageSize := params.Size
+	if pageSize <= 0 {
+		pageSize = int32(len(pluginPage.Data.PluginDetails))
+	}
+	it.totalCount = pluginPage.TotalCount
+	it.lastPage = pageCount(pluginPage.TotalCount, pageSize)
+	it.nextPage += 1
+	it.plugins = pluginPage.Data.PluginDetails
+	return true
+}
+
+// schedule keeps up to the client's page workers requests in flight ahead of
+// the page currently being consumed.
+func (it *PluginIterator) schedule(ctx context.Context) {
+	workers := it.client.pageWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	for len(it.pending) < workers && it.nextPage <= it.lastPage {
+		params := it.params
+		params.Page = it.nextPage
+		result := make(chan pluginPageResult, 1)
+		go func() {
+			log.Printf("Requesting plugin page %d of %d", params.Page, it.lastPage)
+			pluginPage, err := it.client.fetchPluginPageWithRetries(ctx, params, it.budget)
+			if err != nil {
+				result <- pluginPageResult{err: err}
+				return
+			}
+			result <- pluginPageResult{plugins: pluginPage.Data.PluginDetails}
+		}()
+		it.pending = append(it.pending, result)
+		it.nextPage += 1
+	}
+}
+
+func (it *PluginIterator) Plugin() PluginDetails {
+	return it.current
+}
+
+// TotalCount is the number of plugins Tenable reported for the query. It is
+// only known once Next has been called.
+func (it *PluginIterator) TotalCount() int {
+	return it.totalCount
+}
+
+func (it *PluginIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,111 @@
+package querynessus
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// pagedPlugins serves plugins 1 to totalCount in pages of pageSize,
+// whatever size the request asks for.
+func pagedPlugins(t *testing.T, counter *requestCounter, totalCount int, pageSize int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter.add(r)
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 || (page > 1 && (page-1)*pageSize >= totalCount) {
+			t.Errorf("unexpected request for %s", r.URL)
+			http.Error(w, `{"error": "Bad Request"}`, http.StatusBadRequest)
+			return
+		}
+		var ids []int
+		for id := (page-1)*pageSize + 1; id <= page*pageSize && id <= totalCount; id++ {
+			ids = append(ids, id)
+		}
+		writePluginPage(w, totalCount, ids...)
+	})
+}
+
+func iteratePluginIDs(t *testing.T, it *PluginIterator) []int {
+	t.Helper()
+	ids := []int{}
+	for it.Next(context.Background()) {
+		ids = append(ids, it.Plugin().ID)
+	}
+	return ids
+}
+
+func TestPluginIteratorPages(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		workers int
+		params  RequestParams
+		want    []int
+		pages   []string
+	}{
+		{"one worker", 1, RequestParams{Size: 2}, []int{1, 2, 3, 4, 5}, []string{"page=1&size=2", "page=2&size=2", "page=3&size=2"}},
+		{"several workers", 4, RequestParams{Size: 2}, []int{1, 2, 3, 4, 5}, []string{"page=1&size=2", "page=2&size=2", "page=3&size=2"}},
+		{"later first page", 2, RequestParams{Size: 2, Page: 2}, []int{3, 4, 5}, []string{"page=2&size=2", "page=3&size=2"}},
+		// Without a size the first page's length is the page size.
+		{"default size", 2, RequestParams{}, []int{1, 2, 3, 4, 5}, []string{"page=1", "page=2", "page=3"}},
+	} {
+		var counter requestCounter
+		client := newTestClient(t, pagedPlugins(t, &counter, 5, 2), WithPageWorkers(test.workers))
+		it := client.IteratePlugins(test.params)
+		if ids := iteratePluginIDs(t, it); !reflect.DeepEqual(ids, test.want) {
+			t.Errorf("%s: iterated %v, want %v", test.name, ids, test.want)
+		}
+		if it.Err() != nil || it.TotalCount() != 5 {
+			t.Errorf("%s: Err %v and TotalCount %d, want nil and 5", test.name, it.Err(), it.TotalCount())
+		}
+		if it.Next(context.Background()) {
+			t.Errorf("%s: Next returned true after the last plugin", test.name)
+		}
+		for _, page := range test.pages {
+			if got := counter.get(TenablePluginsServicePath + "?" + page); got != 1 {
+				t.Errorf("%s: made %d requests for %s, want 1", test.name, got, page)
+			}
+		}
+	}
+}
+
+func TestPluginIteratorEmptyCatalogue(t *testing.T) {
+	var counter requestCounter
+	client := newTestClient(t, pagedPlugins(t, &counter, 0, 2))
+	it := client.IteratePlugins(RequestParams{Size: 2})
+	if it.Next(context.Background()) {
+		t.Errorf("Next returned plugin %d from an empty catalogue", it.Plugin().ID)
+	}
+	if it.Err() != nil || it.TotalCount() != 0 {
+		t.Errorf("Err %v and TotalCount %d, want nil and 0", it.Err(), it.TotalCount())
+	}
+	if got := counter.get(TenablePluginsServicePath + "?page=1&size=2"); got != 1 {
+		t.Errorf("made %d requests for page 1, want 1", got)
+	}
+}
+
+func TestPluginIteratorStopsAtFailedPage(t *testing.T) {
+	var counter requestCounter
+	pages := pagedPlugins(t, &counter, 5, 2)
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			counter.add(r)
+			http.Error(w, `{"error": "Internal Server Error"}`, http.StatusInternalServerError)
+			return
+		}
+		pages.ServeHTTP(w, r)
+	}), WithPageWorkers(1))
+	it := client.IteratePlugins(RequestParams{Size: 2})
+	if ids := iteratePluginIDs(t, it); !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Errorf("iterated %v, want the plugins before page 2", ids)
+	}
+	var pageErr *PageFetchError
+	if !errors.As(it.Err(), &pageErr) || !reflect.DeepEqual(pageErr.Pages(), []int32{2}) {
+		t.Errorf("got %v, want a PageFetchError for page 2", it.Err())
+	}
+	if it.Next(context.Background()) {
+		t.Error("Next returned true after an error")
+	}
+}
@@ -0,0 +1,53 @@
+package querynessus
+
+// PluginLookup finds the plugins that detect given vulnerabilities. Results
+// are keyed by each CVE or xref exactly as it was passed in and every key is
+// present, with an empty slice when nothing matches. CVEs are matched case
+// insensitively and xrefs are given as TYPE:ID, e.g. IAVA:2021-A-0001 or
+// MSFT:MS17-010.
+type PluginLookup interface {
+	LookupByCVE(cves ...string) (map[string][]PluginDetails, error)
+	LookupByXRef(xrefs ...string) (map[string][]PluginDetails, error)
+}
+
+var (
+	_ PluginLookup = (*PluginListPage)(nil)
+	_ PluginLookup = (*JsonFilePluginRepository)(nil)
+	_ PluginLookup = (*BoltPluginRepository)(nil)
+)
+
+func lookupPlugins(values []string, find func(string) []PluginDetails) map[string][]PluginDetails {
+	results := make(map[string][]PluginDetails, len(values))
+	for _, value := range values {
+		results[value] = find(value)
+	}
+	return results
+}
+
+func (pluginsPage *PluginListPage) LookupByCVE(cves ...string) (map[string][]PluginDetails, error) {
+	return lookupPlugins(cves, pluginsPage.Data.PluginsByCVE), nil
+}
+
+func (pluginsPage *PluginListPage) LookupByXRef(xrefs ...string) (map[string][]PluginDetails, error) {
+	return lookupPlugins(xrefs, pluginsPage.Data.PluginsByXRef), nil
+}
+
+// LookupByCVE loads the whole file, so look up every CVE in one call rather
+// than one at a time.
+func (jfpr *JsonFilePluginRepository) LookupByCVE(cves ...string) (map[string][]PluginDetails, error) {
+	pluginPage, err := jfpr.Load()
+	if err != nil {
+		return nil, err
+	}
+	return pluginPage.LookupByCVE(cves...)
+}
+
+// LookupByXRef loads the whole file, so look up every xref in one call
+// rather than one at a time.
+func (jfpr *JsonFilePluginRepository) LookupByXRef(xrefs ...string) (map[string][]PluginDetails, error) {
+	pluginPage, err := jfpr.Load()
+	if err != nil {
+		return nil, err
+	}
+	return pluginPage.LookupByXRef(xrefs...)
+}
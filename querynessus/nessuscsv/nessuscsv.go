@@ -0,0 +1,408 @@
+// Package nessuscsv reads Tenable's CSV scan exports into the same
+// nessusxml types as .nessus exports, so both are handled the same way.
+// Columns are found by their header, so they may come in any order and all
+// but Plugin ID and Host are optional.
+package nessuscsv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/CarbonRook/go-querynessus/querynessus/nessusxml"
+)
+
+var ErrMissingColumn = errors.New("CSV export is missing a required column")
+
+type column int
+
+const (
+	pluginIDColumn column = iota
+	hostColumn
+	protocolColumn
+	portColumn
+	nameColumn
+	familyColumn
+	riskColumn
+	riskFactorColumn
+	cveColumn
+	bidColumn
+	xrefColumn
+	cvssBaseColumn
+	cvssTemporalColumn
+	cvss3BaseColumn
+	cvss3TemporalColumn
+	cvss4BaseColumn
+	vprColumn
+	epssColumn
+	synopsisColumn
+	descriptionColumn
+	solutionColumn
+	seeAlsoColumn
+	pluginOutputColumn
+	pluginPublicationDateColumn
+	pluginModificationDateColumn
+	ipColumn
+	fqdnColumn
+	netBIOSColumn
+	osColumn
+	macColumn
+	columnCount
+)
+
+// columnHeaders are the headers each column is known by in Tenable.io,
+// Tenable.sc and Nessus exports, lower cased.
+var columnHeaders = map[string]column{
+	"plugin id":                pluginIDColumn,
+	"plugin":                   pluginIDColumn,
+	"host":                     hostColumn,
+	"protocol":                 protocolColumn,
+	"port":                     portColumn,
+	"name":                     nameColumn,
+	"plugin name":              nameColumn,
+	"family":                   familyColumn,
+	"plugin family":            familyColumn,
+	"risk":                     riskColumn,
+	"severity":                 riskColumn,
+	"risk factor":              riskFactorColumn,
+	"cve":                      cveColumn,
+	"bid":                      bidColumn,
+	"xref":                     xrefColumn,
+	"cross references":         xrefColumn,
+	"cvss":                     cvssBaseColumn,
+	"cvss v2.0 base score":     cvssBaseColumn,
+	"cvss v2.0 temporal score": cvssTemporalColumn,
+	"cvss v3.0 base score":     cvss3BaseColumn,
+	"cvss v3.0 temporal score": cvss3TemporalColumn,
+	"cvss v4.0 base score":     cvss4BaseColumn,
+	"vpr score":                vprColumn,
+	"epss score":               epssColumn,
+	"synopsis":                 synopsisColumn,
+	"description":              descriptionColumn,
+	"solution":                 solutionColumn,
+	"see also":                 seeAlsoColumn,
+	"plugin output":            pluginOutputColumn,
+	"plugin text":              pluginOutputColumn,
+	"plugin publication date":  pluginPublicationDateColumn,
+	"plugin modification date": pluginModificationDateColumn,
+	"ip address":               ipColumn,
+	"fqdn":                     fqdnColumn,
+	"dns name":                 fqdnColumn,
+	"netbios":                  netBIOSColumn,
+	"netbios name":             netBIOSColumn,
+	"os":                       osColumn,
+	"mac address":              macColumn,
+}
+
+var severities = map[string]int{
+	"none":     nessusxml.SeverityInfo,
+	"info":     nessusxml.SeverityInfo,
+	"low":      nessusxml.SeverityLow,
+	"medium":   nessusxml.SeverityMedium,
+	"high":     nessusxml.SeverityHigh,
+	"critical": nessusxml.SeverityCritical,
+}
+
+// Reader streams the findings of a CSV export. Tenable writes a row per CVE
+// of a finding; consecutive rows for the same plugin, host, port and
+// protocol are read as one item with all of their CVEs.
+//
+//	reader := nessuscsv.NewReader(file)
+//	for reader.Next() {
+//		host, item := reader.Host(), reader.Item()
+//	}
+//	if err := reader.Err(); err != nil {
+//	}
+type Reader struct {
+	reader  *csv.Reader
+	columns [columnCount]int
+	started bool
+
+	// next is the row read ahead to check whether it continues the item.
+	next     []string
+	nextLine int
+
+	host nessusxml.ReportHost
+	item nessusxml.ReportItem
+	err  error
+}
+
+func NewReader(r io.Reader) *Reader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	return &Reader{reader: reader}
+}
+
+func (reader *Reader) readHeader() error {
+	header, err := reader.reader.Read()
+	if err == io.EOF {
+		return fmt.Errorf("%w: the file is empty", ErrMissingColumn)
+	}
+	if err != nil {
+		return err
+	}
+	for i := range reader.columns {
+		reader.columns[i] = -1
+	}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if c, ok := columnHeaders[name]; ok && reader.columns[c] < 0 {
+			reader.columns[c] = i
+		}
+	}
+	if reader.columns[pluginIDColumn] < 0 {
+		return fmt.Errorf("%w: Plugin ID", ErrMissingColumn)
+	}
+	if reader.columns[hostColumn] < 0 {
+		return fmt.Errorf("%w: Host", ErrMissingColumn)
+	}
+	return nil
+}
+
+func (reader *Reader) cell(record []string, c column) string {
+	i := reader.columns[c]
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// readRecord reads the next non-blank row into reader.next, leaving it nil
+// at the end of the file.
+func (reader *Reader) readRecord() error {
+	for {
+		record, err := reader.reader.Read()
+		if err == io.EOF {
+			reader.next = nil
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		reader.next = record
+		reader.nextLine, _ = reader.reader.FieldPos(0)
+		return nil
+	}
+}
+
+// sameItem reports whether two rows are the same finding.
+func (reader *Reader) sameItem(a []string, b []string) bool {
+	for _, c := range []column{pluginIDColumn, hostColumn, portColumn, protocolColumn, pluginOutputColumn} {
+		if reader.cell(a, c) != reader.cell(b, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Next advances to the next item, returning false at the end of the file or
+// on an error.
+func (reader *Reader) Next() bool {
+	if reader.err != nil {
+		return false
+	}
+	if !reader.started {
+		reader.started = true
+		if err := reader.readHeader(); err != nil {
+			reader.err = err
+			return false
+		}
+		if err := reader.readRecord(); err != nil {
+			reader.err = err
+			return false
+		}
+	}
+	if reader.next == nil {
+		return false
+	}
+
+	record, line := reader.next, reader.nextLine
+	item, err := reader.parseItem(record)
+	if err != nil {
+		reader.err = fmt.Errorf("line %d: %w", line, err)
+		return false
+	}
+	for {
+		if err := reader.readRecord(); err != nil {
+			// The item read so far is still returned; the error ends the
+			// next call.
+			reader.err = err
+			reader.next = nil
+			break
+		}
+		if reader.next == nil || !reader.sameItem(record, reader.next) {
+			break
+		}
+		item.CVE = appendUnique(item.CVE, splitList(reader.cell(reader.next, cveColumn))...)
+	}
+	reader.item = item
+	reader.host = reader.parseHost(record)
+	return true
+}
+
+func (reader *Reader) Host() *nessusxml.ReportHost {
+	return &reader.host
+}
+
+func (reader *Reader) Item() *nessusxml.ReportItem {
+	return &reader.item
+}
+
+func (reader *Reader) Err() error {
+	return reader.err
+}
+
+func (reader *Reader) parseHost(record []string) nessusxml.ReportHost {
+	host := nessusxml.ReportHost{Name: reader.cell(record, hostColumn)}
+	ip := reader.cell(record, ipColumn)
+	if ip == "" && net.ParseIP(host.Name) != nil {
+		ip = host.Name
+	}
+	for _, tag := range []struct {
+		name  string
+		value string
+	}{
+		{"host-ip", ip},
+		{"host-fqdn", reader.cell(record, fqdnColumn)},
+		{"netbios-name", reader.cell(record, netBIOSColumn)},
+		{"operating-system", reader.cell(record, osColumn)},
+		{"mac-address", reader.cell(record, macColumn)},
+	} {
+		if tag.value != "" {
+			host.Properties.Tags = append(host.Properties.Tags, nessusxml.HostTag{Name: tag.name, Value: tag.value})
+		}
+	}
+	return host
+}
+
+func (reader *Reader) parseItem(record []string) (nessusxml.ReportItem, error) {
+	item := nessusxml.ReportItem{
+		Protocol:               strings.ToLower(reader.cell(record, protocolColumn)),
+		PluginName:             reader.cell(record, nameColumn),
+		PluginFamily:           reader.cell(record, familyColumn),
+		RiskFactor:             reader.cell(record, riskFactorColumn),
+		CVE:                    appendUnique(nil, splitList(reader.cell(record, cveColumn))...),
+		XRef:                   splitList(reader.cell(record, xrefColumn)),
+		Synopsis:               reader.cell(record, synopsisColumn),
+		Description:            reader.cell(record, descriptionColumn),
+		Solution:               reader.cell(record, solutionColumn),
+		PluginOutput:           reader.cell(record, pluginOutputColumn),
+		PluginPublicationDate:  reader.cell(record, pluginPublicationDateColumn),
+		PluginModificationDate: reader.cell(record, pluginModificationDateColumn),
+	}
+	var err error
+	if item.PluginID, err = strconv.Atoi(reader.cell(record, pluginIDColumn)); err != nil {
+		return item, fmt.Errorf("Plugin ID: %w", err)
+	}
+	if port := reader.cell(record, portColumn); port != "" {
+		if item.Port, err = strconv.Atoi(port); err != nil {
+			return item, fmt.Errorf("Port: %w", err)
+		}
+	}
+	risk := reader.cell(record, riskColumn)
+	if severity, ok := severities[strings.ToLower(risk)]; ok {
+		item.Severity = severity
+	} else if risk != "" {
+		if item.Severity, err = strconv.Atoi(risk); err != nil {
+			return item, fmt.Errorf("Risk: unknown severity %q", risk)
+		}
+	}
+	if item.RiskFactor == "" && risk != "" {
+		item.RiskFactor = nessusxml.SeverityRiskFactor(item.Severity)
+	}
+	for _, bid := range splitList(reader.cell(record, bidColumn)) {
+		id, err := strconv.Atoi(bid)
+		if err != nil {
+			return item, fmt.Errorf("BID: %w", err)
+		}
+		item.BID = append(item.BID, id)
+	}
+	for _, score := range []struct {
+		c      column
+		name   string
+		target *float64
+	}{
+		{cvssBaseColumn, "CVSS v2.0 Base Score", &item.CVSSBaseScore},
+		{cvssTemporalColumn, "CVSS v2.0 Temporal Score", &item.CVSSTemporalScore},
+		{cvss3BaseColumn, "CVSS v3.0 Base Score", &item.CVSS3BaseScore},
+		{cvss3TemporalColumn, "CVSS v3.0 Temporal Score", &item.CVSS3TemporalScore},
+		{cvss4BaseColumn, "CVSS v4.0 Base Score", &item.CVSS4BaseScore},
+		{vprColumn, "VPR Score", &item.VPRScore},
+		{epssColumn, "EPSS Score", &item.EPSSScore},
+	} {
+		value := reader.cell(record, score.c)
+		if value == "" {
+			continue
+		}
+		if *score.target, err = strconv.ParseFloat(value, 64); err != nil {
+			return item, fmt.Errorf("%s: %w", score.name, err)
+		}
+	}
+	for _, link := range strings.Split(reader.cell(record, seeAlsoColumn), "\n") {
+		if link = strings.TrimSpace(link); link != "" {
+			item.SeeAlso = append(item.SeeAlso, link)
+		}
+	}
+	return item, nil
+}
+
+// splitList splits a cell holding several values separated by commas or
+// new lines.
+func splitList(cell string) []string {
+	var values []string
+	for _, value := range strings.FieldsFunc(cell, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	}) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func appendUnique(values []string, more ...string) []string {
+	for _, value := range more {
+		exists := false
+		for _, existing := range values {
+			if existing == value {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// ReadReport reads a whole CSV export into memory, grouping items by host in
+// the order the hosts first appear. CSV exports don't include the scan's
+// name, so the report has none.
+func ReadReport(r io.Reader) (*nessusxml.Report, error) {
+	reader := NewReader(r)
+	report := &nessusxml.Report{Hosts: []nessusxml.ReportHost{}}
+	hosts := map[string]int{}
+	for reader.Next() {
+		host := reader.Host()
+		i, ok := hosts[host.Name]
+		if !ok {
+			i = len(report.Hosts)
+			hosts[host.Name] = i
+			report.Hosts = append(report.Hosts, *host)
+		}
+		report.Hosts[i].Items = append(report.Hosts[i].Items, *reader.Item())
+	}
+	if err := reader.Err(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,144 @@
+package nessuscsv
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/CarbonRook/go-querynessus/querynessus/nessusxml"
+)
+
+func readItems(t *testing.T, reader *Reader) ([]nessusxml.ReportHost, []nessusxml.ReportItem) {
+	t.Helper()
+	var hosts []nessusxml.ReportHost
+	var items []nessusxml.ReportItem
+	for reader.Next() {
+		hosts = append(hosts, *reader.Host())
+		items = append(items, *reader.Item())
+	}
+	if err := reader.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return hosts, items
+}
+
+func TestReaderMergesRowsPerCVE(t *testing.T) {
+	file, err := os.Open("testdata/scan.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	hosts, items := readItems(t, NewReader(file))
+
+	var read []string
+	for i := range items {
+		read = append(read, fmt.Sprintf("%s %d/%s %d %v", hosts[i].Name, items[i].Port, items[i].Protocol, items[i].PluginID, items[i].CVE))
+	}
+	// The BOM before the header doesn't hide the Plugin ID column, the two
+	// rows for 10.0.0.1 differing only by CVE are one item, and the blank
+	// line is ignored.
+	want := []string{
+		"10.0.0.1 443/tcp 12345 [CVE-2022-3602 CVE-2022-3786]",
+		"10.0.0.2 443/tcp 12345 [CVE-2022-3602]",
+		"10.0.0.1 0/tcp 19506 []",
+		"web.example.com 22/tcp 70658 []",
+	}
+	if fmt.Sprint(read) != fmt.Sprint(want) {
+		t.Errorf("read items\n%q\nwant\n%q", read, want)
+	}
+
+	openssl := items[0]
+	if openssl.PluginName != "OpenSSL 3.0.x < 3.0.7" || openssl.Severity != nessusxml.SeverityHigh || openssl.RiskFactor != "High" {
+		t.Errorf("item %+v", openssl)
+	}
+	if openssl.CVSSBaseScore != 7.5 || openssl.CVSS3BaseScore != 7.5 || openssl.VPRScore != 6.7 {
+		t.Errorf("item scores %v %v %v", openssl.CVSSBaseScore, openssl.CVSS3BaseScore, openssl.VPRScore)
+	}
+	if openssl.Description != "A buffer overrun, in X.509 certificate verification." || openssl.PluginOutput != "Installed version : 3.0.5" {
+		t.Errorf("item text %+v", openssl)
+	}
+	wantSeeAlso := []string{"https://www.openssl.org/news/secadv/20221101.txt", "https://www.openssl.org/news/vulnerabilities.html"}
+	if fmt.Sprint(openssl.SeeAlso) != fmt.Sprint(wantSeeAlso) {
+		t.Errorf("see also split into %q, want %q", openssl.SeeAlso, wantSeeAlso)
+	}
+	if hosts[0].Properties.IP() != "10.0.0.1" || hosts[3].Properties.IP() != "" {
+		t.Errorf("host IPs %q and %q", hosts[0].Properties.IP(), hosts[3].Properties.IP())
+	}
+	if items[2].Severity != nessusxml.SeverityInfo || items[3].Severity != nessusxml.SeverityLow || items[3].RiskFactor != "Low" {
+		t.Errorf("severities %d and %d", items[2].Severity, items[3].Severity)
+	}
+}
+
+func TestReaderFindsReorderedAndMissingColumns(t *testing.T) {
+	contents := "Host,IP Address,DNS Name,OS,Severity,Plugin,Plugin Name,Family,Port,Protocol,Cross References,CVE,Unknown Column\n" +
+		"web,10.0.0.9,web.example.com,Linux,Critical,12345,OpenSSL,Web Servers,443,TCP,\"IAVA:2022-A-0452, CWE:120\",\"CVE-2022-3602,CVE-2022-3786\",ignored\n"
+	hosts, items := readItems(t, NewReader(strings.NewReader(contents)))
+	if len(items) != 1 {
+		t.Fatalf("read %d items, want 1", len(items))
+	}
+	item, host := items[0], hosts[0]
+	if item.PluginID != 12345 || item.PluginName != "OpenSSL" || item.PluginFamily != "Web Servers" || item.Port != 443 || item.Protocol != "tcp" {
+		t.Errorf("item %+v", item)
+	}
+	if item.Severity != nessusxml.SeverityCritical || item.RiskFactor != "Critical" {
+		t.Errorf("severity %d, risk factor %q", item.Severity, item.RiskFactor)
+	}
+	if fmt.Sprint(item.CVE) != "[CVE-2022-3602 CVE-2022-3786]" || fmt.Sprint(item.XRef) != "[IAVA:2022-A-0452 CWE:120]" {
+		t.Errorf("references %q %q", item.CVE, item.XRef)
+	}
+	if item.Synopsis != "" || item.CVSSBaseScore != 0 || item.SeeAlso != nil {
+		t.Errorf("missing columns read as %+v", item)
+	}
+	if host.Name != "web" || host.Properties.IP() != "10.0.0.9" || host.Properties.FQDN() != "web.example.com" || host.Properties.OperatingSystem() != "Linux" {
+		t.Errorf("host %+v", host)
+	}
+}
+
+func TestReaderRequiresPluginIDAndHost(t *testing.T) {
+	for name, contents := range map[string]string{
+		"empty":        "",
+		"no plugin id": "Host,Port\n10.0.0.1,443\n",
+		"no host":      "\ufeffPlugin ID,Port\n12345,443\n",
+		"nessus xml":   "<?xml version=\"1.0\" ?>\n<NessusClientData_v2>\n",
+	} {
+		reader := NewReader(strings.NewReader(contents))
+		if reader.Next() {
+			t.Errorf("%s: read an item", name)
+		}
+		if !errors.Is(reader.Err(), ErrMissingColumn) {
+			t.Errorf("%s: got %v, want ErrMissingColumn", name, reader.Err())
+		}
+	}
+}
+
+func TestReaderReportsTheLineOfBadRows(t *testing.T) {
+	contents := "Plugin ID,Host,Port\n12345,10.0.0.1,443\n12346,10.0.0.1,https\n"
+	reader := NewReader(strings.NewReader(contents))
+	if !reader.Next() {
+		t.Fatalf("first row not read: %v", reader.Err())
+	}
+	if reader.Next() || reader.Err() == nil || !strings.Contains(reader.Err().Error(), "line 3") {
+		t.Errorf("got %v, want an error for line 3", reader.Err())
+	}
+}
+
+func TestReadReportGroupsItemsByHost(t *testing.T) {
+	file, err := os.Open("testdata/scan.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	report, err := ReadReport(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hosts []string
+	for _, host := range report.Hosts {
+		hosts = append(hosts, fmt.Sprintf("%s:%d", host.Name, len(host.Items)))
+	}
+	if want := "[10.0.0.1:2 10.0.0.2:1 web.example.com:1]"; fmt.Sprint(hosts) != want {
+		t.Errorf("hosts %v, want %s", hosts, want)
+	}
+}
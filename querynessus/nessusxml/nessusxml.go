@@ -0,0 +1,167 @@
+// Package nessusxml reads the .nessus (NessusClientData_v2) files Tenable
+// exports scans as. Reader streams the findings of a report one at a time
+// so exports of any size are read in constant memory; ReadReport loads a
+// whole report for when that isn't a concern.
+package nessusxml
+
+import (
+	"strconv"
+	"time"
+)
+
+// Report is a scan's results, the hosts scanned and what was found on them.
+type Report struct {
+	Name  string       `xml:"name,attr" json:"name"`
+	Hosts []ReportHost `xml:"ReportHost" json:"hosts"`
+}
+
+// ReportHost is a scanned host. Its name is the target as given in the
+// scan, usually an IP address or host name.
+type ReportHost struct {
+	Name       string         `xml:"name,attr" json:"name"`
+	Properties HostProperties `xml:"HostProperties" json:"properties"`
+	Items      []ReportItem   `xml:"ReportItem" json:"items,omitempty"`
+}
+
+// HostTag is one of the name/value pairs Nessus records about a host.
+type HostTag struct {
+	Name  string `xml:"name,attr" json:"name"`
+	Value string `xml:",chardata" json:"value"`
+}
+
+// HostProperties are the tags Nessus records about a host, such as its IP
+// address, operating system and when it was scanned.
+type HostProperties struct {
+	Tags []HostTag `xml:"tag" json:"tags"`
+}
+
+// Get returns the value of the named tag, or "" if the host doesn't have
+// it.
+func (properties *HostProperties) Get(name string) string {
+	for _, tag := range properties.Tags {
+		if tag.Name == name {
+			return tag.Value
+		}
+	}
+	return ""
+}
+
+func (properties *HostProperties) IP() string {
+	return properties.Get("host-ip")
+}
+
+func (properties *HostProperties) FQDN() string {
+	return properties.Get("host-fqdn")
+}
+
+func (properties *HostProperties) NetBIOSName() string {
+	return properties.Get("netbios-name")
+}
+
+func (properties *HostProperties) OperatingSystem() string {
+	return properties.Get("operating-system")
+}
+
+func (properties *HostProperties) MACAddress() string {
+	return properties.Get("mac-address")
+}
+
+// StartTime is when the host's scan started, or the zero time if unknown.
+func (properties *HostProperties) StartTime() time.Time {
+	return properties.time("HOST_START_TIMESTAMP", "HOST_START")
+}
+
+// EndTime is when the host's scan finished, or the zero time if unknown.
+func (properties *HostProperties) EndTime() time.Time {
+	return properties.time("HOST_END_TIMESTAMP", "HOST_END")
+}
+
+// time reads a time from the Unix timestamp tag newer versions of Nessus
+// write, falling back to the text tag older versions write.
+func (properties *HostProperties) time(timestampTag string, textTag string) time.Time {
+	if seconds, err := strconv.ParseInt(properties.Get(timestampTag), 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC()
+	}
+	parsed, err := time.Parse(time.ANSIC, properties.Get(textTag))
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed
+}
+
+// Severity levels of a ReportItem.
+const (
+	SeverityInfo = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = []string{"Info", "Low", "Medium", "High", "Critical"}
+
+// SeverityRiskFactor is the risk factor Tenable gives findings of a
+// severity: None, Low, Medium, High or Critical.
+func SeverityRiskFactor(severity int) string {
+	if severity == SeverityInfo {
+		return "None"
+	}
+	if severity < 0 || severity >= len(severityNames) {
+		return ""
+	}
+	return severityNames[severity]
+}
+
+// ReportItem is a plugin's result for one port of a host.
+type ReportItem struct {
+	Port         int    `xml:"port,attr" json:"port"`
+	ServiceName  string `xml:"svc_name,attr" json:"svc_name"`
+	Protocol     string `xml:"protocol,attr" json:"protocol"`
+	Severity     int    `xml:"severity,attr" json:"severity"`
+	PluginID     int    `xml:"pluginID,attr" json:"plugin_id"`
+	PluginName   string `xml:"pluginName,attr" json:"plugin_name"`
+	PluginFamily string `xml:"pluginFamily,attr" json:"plugin_family"`
+
+	PluginOutput           string `xml:"plugin_output" json:"plugin_output,omitempty"`
+	Synopsis               string `xml:"synopsis" json:"synopsis,omitempty"`
+	Description            string `xml:"description" json:"description,omitempty"`
+	Solution               string `xml:"solution" json:"solution,omitempty"`
+	RiskFactor             string `xml:"risk_factor" json:"risk_factor,omitempty"`
+	PluginType             string `xml:"plugin_type" json:"plugin_type,omitempty"`
+	PluginPublicationDate  string `xml:"plugin_publication_date" json:"plugin_publication_date,omitempty"`
+	PluginModificationDate string `xml:"plugin_modification_date" json:"plugin_modification_date,omitempty"`
+	ScriptVersion          string `xml:"script_version" json:"script_version,omitempty"`
+	FileName               string `xml:"fname" json:"fname,omitempty"`
+
+	CVE     []string `xml:"cve" json:"cve,omitempty"`
+	BID     []int    `xml:"bid" json:"bid,omitempty"`
+	XRef    []string `xml:"xref" json:"xref,omitempty"`
+	CPE     []string `xml:"cpe" json:"cpe,omitempty"`
+	SeeAlso []string `xml:"see_also" json:"see_also,omitempty"`
+
+	CVSSBaseScore      float64 `xml:"cvss_base_score" json:"cvss_base_score,omitempty"`
+	CVSSTemporalScore  float64 `xml:"cvss_temporal_score" json:"cvss_temporal_score,omitempty"`
+	CVSSVector         string  `xml:"cvss_vector" json:"cvss_vector,omitempty"`
+	CVSS3BaseScore     float64 `xml:"cvss3_base_score" json:"cvss3_base_score,omitempty"`
+	CVSS3TemporalScore float64 `xml:"cvss3_temporal_score" json:"cvss3_temporal_score,omitempty"`
+	CVSS3Vector        string  `xml:"cvss3_vector" json:"cvss3_vector,omitempty"`
+	CVSS4BaseScore     float64 `xml:"cvss4_base_score" json:"cvss4_base_score,omitempty"`
+	CVSS4Vector        string  `xml:"cvss4_vector" json:"cvss4_vector,omitempty"`
+	VPRScore           float64 `xml:"vpr_score" json:"vpr_score,omitempty"`
+	EPSSScore          float64 `xml:"epss_score" json:"epss_score,omitempty"`
+
+	ExploitAvailable             bool   `xml:"exploit_available" json:"exploit_available,omitempty"`
+	ExploitabilityEase           string `xml:"exploitability_ease" json:"exploitability_ease,omitempty"`
+	ExploitedByMalware           bool   `xml:"exploited_by_malware" json:"exploited_by_malware,omitempty"`
+	PatchPublicationDate         string `xml:"patch_publication_date" json:"patch_publication_date,omitempty"`
+	VulnerabilityPublicationDate string `xml:"vuln_publication_date" json:"vuln_publication_date,omitempty"`
+}
+
+// SeverityName is the item's severity as Nessus shows it: Info, Low,
+// Medium, High or Critical.
+func (item *ReportItem) SeverityName() string {
+	if item.Severity < 0 || item.Severity >= len(severityNames) {
+		return strconv.Itoa(item.Severity)
+	}
+	return severityNames[item.Severity]
+}
@@ -0,0 +1,118 @@
+package nessusxml
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openFixture(t *testing.T) *os.File {
+	t.Helper()
+	file, err := os.Open("testdata/scan.nessus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return file
+}
+
+func TestReaderStreamsItems(t *testing.T) {
+	reader := NewReader(openFixture(t))
+	var items []string
+	var first ReportItem
+	var firstHost ReportHost
+	for reader.Next() {
+		host, item := reader.Host(), reader.Item()
+		if len(items) == 0 {
+			first, firstHost = *item, *host
+		}
+		items = append(items, fmt.Sprintf("%s %d/%s %d", host.Name, item.Port, item.Protocol, item.PluginID))
+	}
+	if err := reader.Err(); err != nil {
+		t.Fatal(err)
+	}
+	// The policy and 10.0.0.2, which has no items, are skipped.
+	want := []string{"10.0.0.1 443/tcp 12345", "10.0.0.1 0/tcp 19506", "10.0.0.3 22/tcp 70658"}
+	if fmt.Sprint(items) != fmt.Sprint(want) {
+		t.Errorf("read items %q, want %q", items, want)
+	}
+	if reader.ReportName() != "Weekly scan" {
+		t.Errorf("report name %q", reader.ReportName())
+	}
+
+	if firstHost.Properties.IP() != "10.0.0.1" || firstHost.Properties.FQDN() != "web.example.com" || firstHost.Properties.OperatingSystem() != "Linux Kernel 5.15" {
+		t.Errorf("host properties %+v", firstHost.Properties)
+	}
+	if !firstHost.Properties.StartTime().Equal(time.Unix(1700000000, 0)) || !firstHost.Properties.EndTime().Equal(time.Unix(1700000600, 0)) {
+		t.Errorf("host scanned from %s to %s", firstHost.Properties.StartTime(), firstHost.Properties.EndTime())
+	}
+	if len(firstHost.Items) != 0 {
+		t.Errorf("streamed host has %d items", len(firstHost.Items))
+	}
+
+	if first.PluginName != "OpenSSL 3.0.x < 3.0.7" || first.PluginFamily != "Web Servers" || first.Severity != SeverityHigh || first.SeverityName() != "High" {
+		t.Errorf("item %+v", first)
+	}
+	if fmt.Sprint(first.CVE) != "[CVE-2022-3602 CVE-2022-3786]" || fmt.Sprint(first.BID) != "[1234]" || fmt.Sprint(first.XRef) != "[IAVA:2022-A-0452]" {
+		t.Errorf("item references %v %v %v", first.CVE, first.BID, first.XRef)
+	}
+	wantSeeAlso := []string{"https://www.openssl.org/news/secadv/20221101.txt", "https://www.openssl.org/news/vulnerabilities.html"}
+	if fmt.Sprint(first.SeeAlso) != fmt.Sprint(wantSeeAlso) {
+		t.Errorf("see_also split into %q, want %q", first.SeeAlso, wantSeeAlso)
+	}
+	if first.CVSS3BaseScore != 7.5 || !first.ExploitAvailable || first.PluginOutput != "Installed version : 3.0.5" {
+		t.Errorf("item details %+v", first)
+	}
+}
+
+func TestReadReportKeepsHostsWithoutItems(t *testing.T) {
+	report, err := ReadReport(openFixture(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Name != "Weekly scan" || len(report.Hosts) != 3 {
+		t.Fatalf("read report %q with %d hosts, want Weekly scan with 3", report.Name, len(report.Hosts))
+	}
+	var itemCounts []int
+	for _, host := range report.Hosts {
+		itemCounts = append(itemCounts, len(host.Items))
+	}
+	if fmt.Sprint(itemCounts) != "[2 0 1]" {
+		t.Errorf("hosts have %v items, want [2 0 1]", itemCounts)
+	}
+	if seeAlso := report.Hosts[0].Items[0].SeeAlso; len(seeAlso) != 2 {
+		t.Errorf("see_also not split: %q", seeAlso)
+	}
+	wantStart := time.Date(2023, time.November, 14, 22, 13, 20, 0, time.UTC)
+	if start := report.Hosts[2].Properties.StartTime(); !start.Equal(wantStart) {
+		t.Errorf("HOST_START read as %s, want %s", start, wantStart)
+	}
+}
+
+func TestReaderRejectsOtherFiles(t *testing.T) {
+	for name, contents := range map[string]string{
+		"empty":      "",
+		"other root": `<?xml version="1.0" ?><NessusClientData><Report/></NessusClientData>`,
+		"stray item": `<NessusClientData_v2><Report><ReportItem pluginID="1"/></Report></NessusClientData_v2>`,
+		"not xml":    "Plugin ID,CVE\n",
+	} {
+		reader := NewReader(strings.NewReader(contents))
+		if reader.Next() {
+			t.Errorf("%s: read an item", name)
+		}
+		if !errors.Is(reader.Err(), ErrNotNessus) {
+			t.Errorf("%s: got %v, want ErrNotNessus", name, reader.Err())
+		}
+	}
+}
+
+func TestReaderReportsTruncatedFiles(t *testing.T) {
+	contents := `<NessusClientData_v2><Report name="r"><ReportHost name="h"><ReportItem pluginID="1" port="0"><cve>CVE-1`
+	reader := NewReader(strings.NewReader(contents))
+	if reader.Next() || reader.Err() == nil {
+		t.Errorf("truncated file read without an error")
+	}
+}
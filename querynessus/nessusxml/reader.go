@@ -0,0 +1,187 @@
+package nessusxml
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var ErrNotNessus = errors.New("not a NessusClientData_v2 file")
+
+// Reader streams the items of a .nessus file, holding only the current host
+// and item in memory.
+//
+//	reader := nessusxml.NewReader(file)
+//	for reader.Next() {
+//		host, item := reader.Host(), reader.Item()
+//	}
+//	if err := reader.Err(); err != nil {
+//	}
+//
+// Hosts without any items are skipped.
+type Reader struct {
+	decoder *xml.Decoder
+	started bool
+	report  string
+	host    *ReportHost
+	item    ReportItem
+	err     error
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{decoder: xml.NewDecoder(r)}
+}
+
+// nextStart returns the next start element below the root, skipping the
+// scan policy.
+func (reader *Reader) nextStart() (xml.StartElement, bool) {
+	for {
+		token, err := reader.decoder.Token()
+		if err == io.EOF {
+			if !reader.started {
+				reader.err = ErrNotNessus
+			}
+			return xml.StartElement{}, false
+		}
+		if err != nil {
+			reader.err = err
+			return xml.StartElement{}, false
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !reader.started {
+			if start.Name.Local != "NessusClientData_v2" {
+				reader.err = fmt.Errorf("%w: root element is %s", ErrNotNessus, start.Name.Local)
+				return xml.StartElement{}, false
+			}
+			reader.started = true
+			continue
+		}
+		switch start.Name.Local {
+		case "Policy":
+			// The scan policy is large and not needed to read the results.
+			if err := reader.decoder.Skip(); err != nil {
+				reader.err = err
+				return xml.StartElement{}, false
+			}
+		case "Report":
+			reader.report = attr(start, "name")
+		default:
+			return start, true
+		}
+	}
+}
+
+// Next advances to the next item, returning false at the end of the file or
+// on an error.
+func (reader *Reader) Next() bool {
+	if reader.err != nil {
+		return false
+	}
+	for {
+		start, ok := reader.nextStart()
+		if !ok {
+			return false
+		}
+		switch start.Name.Local {
+		case "ReportHost":
+			reader.host = &ReportHost{Name: attr(start, "name")}
+		case "HostProperties":
+			if reader.host == nil {
+				reader.err = fmt.Errorf("%w: HostProperties outside of a ReportHost", ErrNotNessus)
+				return false
+			}
+			if err := reader.decoder.DecodeElement(&reader.host.Properties, &start); err != nil {
+				reader.err = fmt.Errorf("host %s: %w", reader.host.Name, err)
+				return false
+			}
+		case "ReportItem":
+			if reader.host == nil {
+				reader.err = fmt.Errorf("%w: ReportItem outside of a ReportHost", ErrNotNessus)
+				return false
+			}
+			reader.item = ReportItem{}
+			if err := reader.decoder.DecodeElement(&reader.item, &start); err != nil {
+				reader.err = fmt.Errorf("host %s: %w", reader.host.Name, err)
+				return false
+			}
+			reader.item.normalise()
+			return true
+		}
+	}
+}
+
+// ReportName is the name of the report being read, which is the scan's
+// name.
+func (reader *Reader) ReportName() string {
+	return reader.report
+}
+
+// Host is the host of the current item. Its Items are always empty.
+func (reader *Reader) Host() *ReportHost {
+	return reader.host
+}
+
+func (reader *Reader) Item() *ReportItem {
+	return &reader.item
+}
+
+func (reader *Reader) Err() error {
+	return reader.err
+}
+
+func attr(start xml.StartElement, name string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// normalise splits the see_also links, which Nessus writes one per line in
+// a single element.
+func (item *ReportItem) normalise() {
+	var seeAlso []string
+	for _, links := range item.SeeAlso {
+		for _, link := range strings.Split(links, "\n") {
+			if link = strings.TrimSpace(link); link != "" {
+				seeAlso = append(seeAlso, link)
+			}
+		}
+	}
+	item.SeeAlso = seeAlso
+}
+
+// ReadReport reads a whole .nessus file into memory, including hosts
+// without any items. Use a Reader for large exports.
+func ReadReport(r io.Reader) (*Report, error) {
+	reader := NewReader(r)
+	report := &Report{Hosts: []ReportHost{}}
+	for {
+		start, ok := reader.nextStart()
+		if !ok {
+			break
+		}
+		if start.Name.Local != "ReportHost" {
+			continue
+		}
+		var host ReportHost
+		if err := reader.decoder.DecodeElement(&host, &start); err != nil {
+			return nil, fmt.Errorf("host %s: %w", attr(start, "name"), err)
+		}
+		for i := range host.Items {
+			host.Items[i].normalise()
+		}
+		report.Hosts = append(report.Hosts, host)
+	}
+	if err := reader.Err(); err != nil {
+		return nil, err
+	}
+	report.Name = reader.ReportName()
+	return report, nil
+}
@@ -0,0 +1,191 @@
+package querynessus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const DefaultUserAgent = "go-querynessus"
+
+type ClientOption func(*clientSettings) error
+
+type clientSettings struct {
+	baseURL    string
+	httpClient *http.Client
+	timeout    time.Duration
+	proxy      *url.URL
+	rootCAs    *x509.CertPool
+	userAgent  string
+
+	retryPolicy       RetryPolicy
+	pageFailureBudget int
+	rateLimiters      rateLimiters
+	pageWorkers       int
+}
+
+// WithBaseURL points the client at a Tenable.io region, an on-prem Nessus
+// Manager or a test server instead of DefaultTenableBaseURL.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(settings *clientSettings) error {
+		parsedURL, err := url.Parse(baseURL)
+		if err != nil {
+			return fmt.Errorf("invalid base url %s: %w", baseURL, err)
+		}
+		if parsedURL.Scheme == "" || parsedURL.Host == "" {
+			return fmt.Errorf("base url %s must be absolute", baseURL)
+		}
+		settings.baseURL = strings.TrimRight(baseURL, "/")
+		return nil
+	}
+}
+
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(settings *clientSettings) error {
+		if httpClient == nil {
+			return errors.New("http client cannot be nil")
+		}
+		settings.httpClient = httpClient
+		return nil
+	}
+}
+
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(settings *clientSettings) error {
+		if timeout < 0 {
+			return fmt.Errorf("invalid timeout %s", timeout)
+		}
+		settings.timeout = timeout
+		return nil
+	}
+}
+
+func WithProxy(proxyURL string) ClientOption {
+	return func(settings *clientSettings) error {
+		parsedURL, err := url.Parse(proxyURL)
+		if err != nil {
+			return fmt.Errorf("invalid proxy url %s: %w", proxyURL, err)
+		}
+		settings.proxy = parsedURL
+		return nil
+	}
+}
+
+// WithCABundle trusts the PEM encoded certificates in filename in addition
+// to the system roots.
+func WithCABundle(filename string) ClientOption {
+	return func(settings *clientSettings) error {
+		pemCerts, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle %s: %w", filename, err)
+		}
+		if settings.rootCAs == nil {
+			settings.rootCAs, err = x509.SystemCertPool()
+			if err != nil {
+				settings.rootCAs = x509.NewCertPool()
+			}
+		}
+		if !settings.rootCAs.AppendCertsFromPEM(pemCerts) {
+			return fmt.Errorf("no certificates found in CA bundle %s", filename)
+		}
+		return nil
+	}
+}
+
+func WithUserAgent(userAgent string) ClientOption {
+	return func(settings *clientSettings) error {
+		settings.userAgent = userAgent
+		return nil
+	}
+}
+
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(settings *clientSettings) error {
+		if policy.MaxAttempts < 1 {
+			return fmt.Errorf("retry policy must allow at least 1 attempt, got %d", policy.MaxAttempts)
+		}
+		if policy.Jitter < 0 || policy.Jitter > 1 {
+			return fmt.Errorf("retry jitter must be between 0 and 1, got %f", policy.Jitter)
+		}
+		settings.retryPolicy = policy
+		return nil
+	}
+}
+
+// WithPageFailureBudget limits how many failed page fetches a paginated
+// call tolerates in total before giving up.
+func WithPageFailureBudget(failures int) ClientOption {
+	return func(settings *clientSettings) error {
+		if failures < 0 {
+			return fmt.Errorf("invalid page failure budget %d", failures)
+		}
+		settings.pageFailureBudget = failures
+		return nil
+	}
+}
+
+// WithRateLimiter paces every request made by the client. Pass the same
+// limiter to several clients to share one quota between them.
+func WithRateLimiter(limiter RateLimiter) ClientOption {
+	return func(settings *clientSettings) error {
+		settings.rateLimiters.global = limiter
+		return nil
+	}
+}
+
+// WithEndpointRateLimiter paces requests to one class of endpoint in
+// addition to any limiter set with WithRateLimiter. A nil limiter removes
+// the limit for that class.
+func WithEndpointRateLimiter(class EndpointClass, limiter RateLimiter) ClientOption {
+	return func(settings *clientSettings) error {
+		if settings.rateLimiters.classes == nil {
+			settings.rateLimiters.classes = map[EndpointClass]RateLimiter{}
+		}
+		settings.rateLimiters.classes[class] = limiter
+		return nil
+	}
+}
+
+// WithPageWorkers sets how many plugin pages FetchAllPlugins requests at
+// once. Requests still go through the client's rate limiters, so raise the
+// plugins limit as well to see any speedup.
+func WithPageWorkers(workers int) ClientOption {
+	return func(settings *clientSettings) error {
+		if workers < 1 {
+			return fmt.Errorf("page workers must be at least 1, got %d", workers)
+		}
+		settings.pageWorkers = workers
+		return nil
+	}
+}
+
+func (settings clientSettings) buildHTTPClient() (*http.Client, error) {
+	if settings.httpClient != nil {
+		if settings.proxy != nil || settings.rootCAs != nil {
+			return nil, errors.New("proxy and CA bundle options cannot be combined with a custom http client")
+		}
+		httpClient := *settings.httpClient
+		if settings.timeout > 0 {
+			httpClient.Timeout = settings.timeout
+		}
+		return &httpClient, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if settings.proxy != nil {
+		transport.Proxy = http.ProxyURL(settings.proxy)
+	}
+	if settings.rootCAs != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: settings.rootCAs}
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   settings.timeout,
+	}, nil
+}
@@ -0,0 +1,239 @@
+package querynessus
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientSendsCredentialsAndUserAgent(t *testing.T) {
+	for _, test := range []struct {
+		opts      []ClientOption
+		userAgent string
+	}{
+		{nil, DefaultUserAgent},
+		{[]ClientOption{WithUserAgent("scanner-sync/1.2")}, "scanner-sync/1.2"},
+	} {
+		var apiKeys, userAgent string
+		client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKeys, userAgent = r.Header.Get("X-ApiKeys"), r.Header.Get("User-Agent")
+			fmt.Fprint(w, `{"folders": []}`)
+		}), test.opts...)
+		if _, err := client.ListFoldersContext(context.Background()); err != nil {
+			t.Fatalf("ListFolders: %s", err)
+		}
+		if apiKeys != "accessKey=access;secretKey=secret" {
+			t.Errorf("sent X-ApiKeys %q", apiKeys)
+		}
+		if userAgent != test.userAgent {
+			t.Errorf("sent User-Agent %q, want %q", userAgent, test.userAgent)
+		}
+	}
+}
+
+func TestWithBaseURLTrimsTrailingSlash(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		fmt.Fprint(w, `{"folders": []}`)
+	}))
+	defer server.Close()
+	client, err := NewTenableApiClient("access", "secret", WithBaseURL(server.URL+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.BaseURL() != server.URL {
+		t.Errorf("base URL %q, want %q", client.BaseURL(), server.URL)
+	}
+	if _, err := client.ListFoldersContext(context.Background()); err != nil {
+		t.Fatalf("ListFolders: %s", err)
+	}
+	if path != TenableFoldersPath {
+		t.Errorf("requested %q, want %q", path, TenableFoldersPath)
+	}
+}
+
+func TestNewTenableApiClientRejectsInvalidOptions(t *testing.T) {
+	noCerts := filepath.Join(t.TempDir(), "empty.pem")
+	if err := ioutil.WriteFile(noCerts, []byte("not a certificate\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, opts := range map[string][]ClientOption{
+		"relative base url":       {WithBaseURL("cloud.tenable.com")},
+		"unparseable base url":    {WithBaseURL("https://cloud.tenable.com/%zz")},
+		"nil http client":         {WithHTTPClient(nil)},
+		"negative timeout":        {WithTimeout(-time.Second)},
+		"unparseable proxy":       {WithProxy("http://proxy:%zz")},
+		"missing CA bundle":       {WithCABundle(filepath.Join(t.TempDir(), "missing.pem"))},
+		"CA bundle without certs": {WithCABundle(noCerts)},
+		"no attempts":             {WithRetryPolicy(RetryPolicy{})},
+		"jitter above 1":          {WithRetryPolicy(RetryPolicy{MaxAttempts: 1, Jitter: 2})},
+		"negative page budget":    {WithPageFailureBudget(-1)},
+		"no page workers":         {WithPageWorkers(0)},
+		"proxy with http client":  {WithHTTPClient(&http.Client{}), WithProxy("http://proxy:3128")},
+	} {
+		if _, err := NewTenableApiClient("access", "secret", opts...); err == nil {
+			t.Errorf("%s: NewTenableApiClient succeeded, want an error", name)
+		}
+	}
+}
+
+func TestWithTimeoutLimitsEachRequest(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}), WithTimeout(20*time.Millisecond), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	started := time.Now()
+	if _, err := client.ListFoldersContext(context.Background()); err == nil {
+		t.Fatal("ListFolders succeeded, want a timeout")
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("gave up after %s", elapsed)
+	}
+}
+
+func TestWithHTTPClientKeepsCallersClient(t *testing.T) {
+	var requests int32
+	httpClient := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&requests, 1)
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(`{"folders": []}`)), Request: r}, nil
+	})}
+	client, err := NewTenableApiClient("access", "secret", WithHTTPClient(httpClient), WithTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ListFoldersContext(context.Background()); err != nil {
+		t.Fatalf("ListFolders: %s", err)
+	}
+	if requests != 1 {
+		t.Errorf("custom transport saw %d requests, want 1", requests)
+	}
+	if httpClient.Timeout != 0 {
+		t.Errorf("WithTimeout changed the caller's client's timeout to %s", httpClient.Timeout)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestWithProxySendsRequestsThroughProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		fmt.Fprint(w, `{"folders": []}`)
+	}))
+	defer proxy.Close()
+	client, err := NewTenableApiClient("access", "secret", WithBaseURL("http://tenable.invalid"), WithProxy(proxy.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ListFoldersContext(context.Background()); err != nil {
+		t.Fatalf("ListFolders: %s", err)
+	}
+	if want := "http://tenable.invalid" + TenableFoldersPath; proxied != want {
+		t.Errorf("proxy received %q, want %q", proxied, want)
+	}
+}
+
+func TestWithCABundleTrustsServer(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"folders": []}`)
+	}))
+	defer server.Close()
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(bundle, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	untrusting, err := NewTenableApiClient("access", "secret", WithBaseURL(server.URL), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := untrusting.ListFoldersContext(context.Background()); err == nil {
+		t.Error("ListFolders trusted the test server without its certificate")
+	}
+	trusting, err := NewTenableApiClient("access", "secret", WithBaseURL(server.URL), WithCABundle(bundle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trusting.ListFoldersContext(context.Background()); err != nil {
+		t.Errorf("ListFolders: %s", err)
+	}
+}
+
+// countingLimiter counts the requests it paces without delaying them.
+type countingLimiter struct {
+	waits int32
+}
+
+func (limiter *countingLimiter) Wait(ctx context.Context) error {
+	atomic.AddInt32(&limiter.waits, 1)
+	return ctx.Err()
+}
+
+func TestRateLimitersPaceMatchingRequests(t *testing.T) {
+	global, plugins := &countingLimiter{}, &countingLimiter{}
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, TenablePluginsServicePath) {
+			writePluginPage(w, 1, 1)
+			return
+		}
+		fmt.Fprint(w, `{"folders": []}`)
+	}), WithRateLimiter(global), WithEndpointRateLimiter(PluginsEndpointClass, plugins))
+	if _, err := client.ListFoldersContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.FetchAllPluginsContext(context.Background(), &RequestParams{Size: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if global.waits != 2 || plugins.waits != 1 {
+		t.Errorf("global limiter waited %d times and plugins limiter %d times, want 2 and 1", global.waits, plugins.waits)
+	}
+}
+
+func TestWithPageWorkersFetchesPagesConcurrently(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight += 1
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight -= 1
+		mu.Unlock()
+		var page int
+		fmt.Sscan(r.URL.Query().Get("page"), &page)
+		writePluginPage(w, 6, page)
+	}), WithPageWorkers(3))
+	plugins, err := client.FetchAllPluginsContext(context.Background(), &RequestParams{Size: 1})
+	if err != nil {
+		t.Fatalf("FetchAllPlugins: %s", err)
+	}
+	if len(plugins) != 6 {
+		t.Errorf("got %d plugins, want 6", len(plugins))
+	}
+	if maxInFlight < 2 || maxInFlight > 3 {
+		t.Errorf("fetched up to %d pages at once, want 2 or 3", maxInFlight)
+	}
+}
@@ -0,0 +1,89 @@
+package querynessus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PageFetchError is returned alongside the plugins that were fetched when
+// one or more pages could not be retrieved.
+type PageFetchError struct {
+	FailedPages map[int32]error
+}
+
+func (e *PageFetchError) Pages() []int32 {
+	pages := make([]int32, 0, len(e.FailedPages))
+	for page := range e.FailedPages {
+		pages = append(pages, page)
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i] < pages[j] })
+	return pages
+}
+
+func (e *PageFetchError) Error() string {
+	pages := e.Pages()
+	pageNumbers := make([]string, len(pages))
+	for i, page := range pages {
+		pageNumbers[i] = fmt.Sprintf("%d", page)
+	}
+	return fmt.Sprintf("failed to fetch %d plugin pages (%s), first error: %s", len(pages), strings.Join(pageNumbers, ", "), e.FailedPages[pages[0]])
+}
+
+// failureBudget is shared by every page fetch in one paginated call so a
+// persistent failure cannot retry forever.
+type failureBudget struct {
+	mu        sync.Mutex
+	limit     int
+	remaining int
+}
+
+func newFailureBudget(limit int) *failureBudget {
+	return &failureBudget{
+		limit:     limit,
+		remaining: limit,
+	}
+}
+
+func (budget *failureBudget) spend() bool {
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+	if budget.remaining <= 0 {
+		return false
+	}
+	budget.remaining -= 1
+	return true
+}
+
+func (tac TenableApiClient) fetchPluginPageWithRetries(ctx context.Context, params RequestParams, budget *failureBudget) (*PluginListPage, error) {
+	for failures := 1; ; failures++ {
+		pluginPage, err := tac.fetchSinglePluginPage(ctx, &params)
+		if err == nil {
+			return pluginPage, nil
+		}
+		log.Printf("Failed to fetch plugin page %d: %s", params.Page, err)
+		// sendRequest has already retried the request itself, so only a
+		// page that arrived but couldn't be decoded is worth fetching again.
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			return nil, err
+		}
+		if !budget.spend() {
+			return nil, fmt.Errorf("giving up on plugin page %d, page failure budget of %d exhausted: %w", params.Page, budget.limit, err)
+		}
+		if err := sleepContext(ctx, tac.retryPolicy.Backoff(failures)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func pageCount(totalCount int, pageSize int32) int32 {
+	if pageSize <= 0 {
+		return 1
+	}
+	return int32((totalCount + int(pageSize) - 1) / int(pageSize))
+}
@@ -1,9 +1,14 @@
 package querynessus
 
 import (
+	"bytes"
 	"encoding/json"
-	"io/ioutil"
+	"fmt"
+	"io"
 	"log"
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -21,14 +26,14 @@ func (pluginsPage *PluginListPage) Merge(otherPluginsPage *PluginListPage) (newC
 	for _, otherPlugin := range otherPluginsPage.Data.PluginDetails {
 		plugin, idx, pluginExists := pluginsPage.Data.PluginFromId(otherPlugin.ID)
 		if pluginExists {
-			if plugin.Equal(&otherPlugin) {
+			if !pluginChanged(plugin, &otherPlugin) {
 				duplicateCount += 1
 				continue
 			}
-			pluginsPage.Data.PluginDetails[idx] = otherPlugin
+			pluginsPage.Data.setPlugin(idx, otherPlugin)
 			updatedCount += 1
 		} else {
-			pluginsPage.Data.PluginDetails = append(pluginsPage.Data.PluginDetails, otherPlugin)
+			pluginsPage.Data.appendPlugin(otherPlugin)
 			pluginsPage.TotalCount += 1
 			pluginsPage.Size += 1
 			newCount += 1
@@ -57,7 +62,10 @@ func (pluginsPage *PluginListPage) SaveToFile(filename string) error {
 		log.Println("Failed to marshal JSON structure")
 		return err
 	}
-	err = ioutil.WriteFile(filename, file, 0644)
+	err = writeCompressedFileAtomic(filename, 0644, func(w io.Writer) error {
+		_, err := w.Write(file)
+		return err
+	})
 	if err != nil {
 		log.Printf("Failed to write to file %s", filename)
 		return err
@@ -71,17 +79,28 @@ type PluginListPageParams struct {
 	LastUpdated string `json:"last_updated"`
 }
 
+// PluginDetailsList is a list of plugins indexed for lookups by ID, CVE,
+// family, CPE and xref. Call Reindex after changing PluginDetails directly
+// rather than through PluginListPage.Merge.
 type PluginDetailsList struct {
 	PluginDetails []PluginDetails `json:"plugin_details"`
+	index         *pluginIndex
+	search        *SearchIndex
+	trackHistory  bool
+	history       []PluginRevision
 }
 
-func (pdl PluginDetailsList) PluginFromId(id int) (*PluginDetails, int, bool) {
-	for i, pluginDetail := range pdl.PluginDetails {
-		if pluginDetail.ID == id {
-			return &pluginDetail, i, true
-		}
+func (pdl *PluginDetailsList) PluginFromId(id int) (*PluginDetails, int, bool) {
+	i, exists := pdl.ensureIndex().byID[id]
+	if exists && pdl.PluginDetails[i].ID != id {
+		pdl.Reindex()
+		i, exists = pdl.index.byID[id]
+	}
+	if !exists {
+		return &PluginDetails{}, -1, false
 	}
-	return &PluginDetails{}, -1, false
+	pluginDetail := pdl.PluginDetails[i]
+	return &pluginDetail, i, true
 }
 
 type PluginDetails struct {
@@ -89,18 +108,43 @@ type PluginDetails struct {
 	Name       string           `json:"name"`
 	Attributes PluginAttributes `json:"attributes"`
 	FamilyName string           `json:"family_name,omitempty"`
+	// Enrichment is only set by an Enricher, from feeds outside Tenable.
+	Enrichment *PluginEnrichment `json:"enrichment,omitempty"`
 }
 
 func (pd *PluginDetails) IsZero() bool {
 	return pd == &PluginDetails{}
 }
 
+// Equal reports whether two plugins are the same version by their
+// publication and modification dates. Tenable doesn't always bump the
+// modification date when it changes a plugin's VPR, CVSS or CVEs, so use
+// pluginChanged to decide whether a plugin needs updating.
 func (pluginDetails PluginDetails) Equal(otherPluginDetails *PluginDetails) bool {
 	return pluginDetails.ID == otherPluginDetails.ID &&
 		pluginDetails.Attributes.PluginPublicationDate == otherPluginDetails.Attributes.PluginPublicationDate &&
 		pluginDetails.Attributes.PluginModificationDate == otherPluginDetails.Attributes.PluginModificationDate
 }
 
+// pluginChanged reports whether any field of current differs from
+// previous, ignoring the enrichment which isn't part of Tenable's data.
+// Plugins are compared as JSON, the form they are stored in, so differences
+// that don't survive a save and load, such as an empty list omitted as nil,
+// aren't changes.
+func pluginChanged(previous *PluginDetails, current *PluginDetails) bool {
+	previousPlugin, currentPlugin := *previous, *current
+	previousPlugin.Enrichment, currentPlugin.Enrichment = nil, nil
+	previousJSON, err := json.Marshal(previousPlugin)
+	if err != nil {
+		return true
+	}
+	currentJSON, err := json.Marshal(currentPlugin)
+	if err != nil {
+		return true
+	}
+	return !bytes.Equal(previousJSON, currentJSON)
+}
+
 type PluginAttributes struct {
 	PluginModificationDate       string                      `json:"plugin_modification_date"`
 	IntelType                    string                      `json:"intel_type"`
@@ -162,6 +206,20 @@ type PluginAttributes struct {
 		RemediationLevel    string `json:"RemediationLevel"`
 		ReportConfidence    string `json:"ReportConfidence"`
 	} `json:"cvss3_temporal_vector,omitempty"`
+	// The individual CVSS v4 metrics aren't broken out as for v2 and v3;
+	// parse the raw vectors with cvss.ParseV4 instead.
+	CVSSv4BaseScore   float32 `json:"cvss4_base_score,omitempty"`
+	CVSSv4ThreatScore float32 `json:"cvss4_threat_score,omitempty"`
+	CVSSv4Vector      struct {
+		VectorString string `json:"raw"`
+	} `json:"cvss4_vector,omitempty"`
+	CVSSv4ThreatVector struct {
+		VectorString string `json:"raw"`
+	} `json:"cvss4_threat_vector,omitempty"`
+
+	// EPSSScore is the probability, from 0 to 1, of the vulnerability being
+	// exploited in the next 30 days.
+	EPSSScore float32 `json:"epss_score,omitempty"`
 
 	ExploitAvailable           bool   `json:"exploit_available"`
 	ExploitFrameworkCanvas     bool   `json:"exploit_framework_canvas,omitempty"`
@@ -184,6 +242,90 @@ type PluginAttributes struct {
 		Type string `json:"type"`
 		ID   string `json:"id"`
 	} `json:"xrefs"`
+
+	// Extra holds the attributes Tenable publishes that aren't modelled
+	// above, keyed by their JSON name, so they aren't lost when plugins are
+	// loaded, merged and saved again.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// pluginAttributesJSON has the fields of PluginAttributes without its
+// JSON methods.
+type pluginAttributesJSON PluginAttributes
+
+var pluginAttributeNames = buildPluginAttributeNames()
+
+func buildPluginAttributeNames() map[string]bool {
+	names := map[string]bool{}
+	attributesType := reflect.TypeOf(PluginAttributes{})
+	for i := 0; i < attributesType.NumField(); i++ {
+		if name := jsonFieldName(attributesType.Field(i)); name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+func (attributes *PluginAttributes) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, (*pluginAttributesJSON)(attributes)); err != nil {
+		return err
+	}
+	attributes.Extra = nil
+	for name, value := range raw {
+		if pluginAttributeNames[strings.ToLower(name)] {
+			continue
+		}
+		if attributes.Extra == nil {
+			attributes.Extra = map[string]json.RawMessage{}
+		}
+		// Compact the value as it will be when saved, so a reloaded plugin
+		// equals the same plugin fetched again.
+		var compacted bytes.Buffer
+		if err := json.Compact(&compacted, value); err != nil {
+			return err
+		}
+		attributes.Extra[name] = compacted.Bytes()
+	}
+	return nil
+}
+
+func (attributes PluginAttributes) MarshalJSON() ([]byte, error) {
+	if len(attributes.Extra) == 0 {
+		return json.Marshal(pluginAttributesJSON(attributes))
+	}
+	data, err := json.Marshal(pluginAttributesJSON(attributes))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(attributes.Extra))
+	for name := range attributes.Extra {
+		if !pluginAttributeNames[strings.ToLower(name)] {
+			names = append(names, name)
+		}
+	}
+	// Sorted so the same plugin always marshals the same way.
+	sort.Strings(names)
+	buffer := bytes.NewBuffer(data[:len(data)-1])
+	for i, name := range names {
+		if i > 0 || len(data) > 2 {
+			buffer.WriteByte(',')
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(key)
+		buffer.WriteByte(':')
+		if err := json.Compact(buffer, attributes.Extra[name]); err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", name, err)
+		}
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
 }
 
 type VulnerabilityPriorityRating struct {
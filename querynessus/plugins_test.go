@@ -1 +1,135 @@
 package querynessus
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const extraAttributesPage = `{"size": 2, "total_count": 2, "data": {"plugin_details": [
+	{"id": 1, "name": "Old", "attributes": {"plugin_modification_date": "2023-01-01T00:00:00Z", "cve": ["CVE-2023-0001"], "generated_plugin": "now", "risk_rating_source": "Tenable", "vendor": {"name": "Acme", "tags": ["a", "b"]}}},
+	{"id": 2, "name": "Untouched", "attributes": {"plugin_modification_date": "2023-01-01T00:00:00Z", "threat_actors": ["APT1"]}}
+]}}`
+
+const extraAttributesUpdate = `{"size": 1, "total_count": 1, "data": {"plugin_details": [
+	{"id": 1, "name": "New", "attributes": {"plugin_modification_date": "2024-01-01T00:00:00Z", "cve": ["CVE-2023-0001"], "generated_plugin": "later", "exploit_frameworks": [{"name": "Metasploit"}]}}
+]}}`
+
+func TestPluginAttributesKeepUnknownFields(t *testing.T) {
+	var page, update PluginListPage
+	if err := json.Unmarshal([]byte(extraAttributesPage), &page); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(extraAttributesUpdate), &update); err != nil {
+		t.Fatal(err)
+	}
+	if extra := page.Data.PluginDetails[0].Attributes.Extra; len(extra) != 3 || string(extra["risk_rating_source"]) != `"Tenable"` {
+		t.Errorf("unmarshalled Extra %q", extra)
+	}
+	if _, modelled := page.Data.PluginDetails[0].Attributes.Extra["cve"]; modelled {
+		t.Error("modelled attribute cve kept in Extra")
+	}
+	if _, _, _, err := page.Merge(&update); err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "plugins.json")
+	repository, err := NewJsonFilePluginRepository(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.Save(&page); err != nil {
+		t.Fatalf("Save: %s", err)
+	}
+	saved, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{`"generated_plugin":"later"`, `"exploit_frameworks":[{"name":"Metasploit"}]`, `"threat_actors":["APT1"]`} {
+		if !strings.Contains(string(saved), field) {
+			t.Errorf("saved plugins don't contain %s", field)
+		}
+	}
+	if strings.Contains(string(saved), "risk_rating_source") {
+		t.Error("saved plugins kept risk_rating_source from the replaced version of plugin 1")
+	}
+
+	loaded, err := repository.Load()
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	updated, _, _ := loaded.Data.PluginFromId(1)
+	if updated == nil || string(updated.Attributes.Extra["generated_plugin"]) != `"later"` || updated.Attributes.CVE[0] != "CVE-2023-0001" {
+		t.Errorf("loaded plugin 1 %+v", updated)
+	}
+	untouched, _, _ := loaded.Data.PluginFromId(2)
+	if untouched == nil || string(untouched.Attributes.Extra["threat_actors"]) != `["APT1"]` {
+		t.Errorf("loaded plugin 2 %+v", untouched)
+	}
+}
+
+func TestPluginAttributesExtraCannotOverrideModelledFields(t *testing.T) {
+	attributes := PluginAttributes{CVE: []string{"CVE-2023-0001"}, Extra: map[string]json.RawMessage{"cve": json.RawMessage(`["CVE-1999-0001"]`)}}
+	data, err := json.Marshal(attributes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "CVE-2023-0001") || strings.Contains(string(data), "CVE-1999-0001") {
+		t.Errorf("marshalled %s", data)
+	}
+}
+
+func TestPluginAttributesExtraIsCompacted(t *testing.T) {
+	var fetched PluginDetails
+	if err := json.Unmarshal([]byte(`{"id": 1, "attributes": {"vendor": {
+		"name": "Acme",
+		"tags": [ "a", "b" ]
+	}}}`), &fetched); err != nil {
+		t.Fatal(err)
+	}
+	if extra := string(fetched.Attributes.Extra["vendor"]); extra != `{"name":"Acme","tags":["a","b"]}` {
+		t.Errorf("Extra vendor = %s", extra)
+	}
+	saved, err := json.Marshal(fetched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded PluginDetails
+	if err := json.Unmarshal(saved, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, fetched) || pluginChanged(&loaded, &fetched) {
+		t.Errorf("plugin changed by a save and load:\n%+v\n%+v", fetched, loaded)
+	}
+}
+
+func TestPluginAttributesMarshalJSON(t *testing.T) {
+	attributes := PluginAttributes{CVE: []string{"CVE-2023-0001"}}
+	plain, err := json.Marshal(pluginAttributesJSON(attributes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := json.Marshal(attributes); err != nil || string(data) != string(plain) {
+		t.Errorf("marshalled attributes without Extra as %s, %v, want %s", data, err, plain)
+	}
+
+	attributes.Extra = map[string]json.RawMessage{"zulu": json.RawMessage(`1`), "alpha": json.RawMessage(`{"a": [1, 2]}`), `quote"d`: json.RawMessage(`true`)}
+	data, err := json.Marshal(attributes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.TrimSuffix(string(plain), "}") + `,"alpha":{"a":[1,2]},"quote\"d":true,"zulu":1}`
+	if string(data) != want {
+		t.Errorf("marshalled\n%s\nwant\n%s", data, want)
+	}
+	var roundTripped PluginAttributes
+	if err := json.Unmarshal(data, &roundTripped); err != nil {
+		t.Fatal(err)
+	}
+	if len(roundTripped.Extra) != 3 || string(roundTripped.Extra[`quote"d`]) != "true" {
+		t.Errorf("round tripped Extra %q", roundTripped.Extra)
+	}
+}
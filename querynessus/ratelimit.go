@@ -0,0 +1,128 @@
+package querynessus
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RateLimiter interface {
+	// Wait blocks until a request may be sent or ctx is done.
+	Wait(ctx context.Context) error
+}
+
+type EndpointClass string
+
+const (
+	PluginsEndpointClass EndpointClass = "plugins"
+	ScansEndpointClass   EndpointClass = "scans"
+	ExportsEndpointClass EndpointClass = "exports"
+	FoldersEndpointClass EndpointClass = "folders"
+	OtherEndpointClass   EndpointClass = "other"
+)
+
+func endpointClassFromPath(path string) EndpointClass {
+	switch {
+	case strings.HasPrefix(path, "/plugins"):
+		return PluginsEndpointClass
+	case strings.HasPrefix(path, TenableScanPath) && strings.Contains(path, "/export"):
+		return ExportsEndpointClass
+	case strings.HasPrefix(path, TenableScanPath):
+		return ScansEndpointClass
+	case strings.HasPrefix(path, TenableFoldersPath):
+		return FoldersEndpointClass
+	}
+	return OtherEndpointClass
+}
+
+// TokenBucketLimiter allows bursts of up to burst requests and refills at
+// a steady rate of requestsPerSecond. It is safe for concurrent use and may
+// be shared between clients to enforce a single quota.
+type TokenBucketLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucketLimiter allows requestsPerSecond on average with bursts of
+// up to burst requests. A requestsPerSecond of 0 or less, or infinite,
+// doesn't limit requests at all.
+func NewTokenBucketLimiter(requestsPerSecond float64, burst int) *TokenBucketLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	if math.IsInf(requestsPerSecond, 1) || math.IsNaN(requestsPerSecond) {
+		requestsPerSecond = 0
+	}
+	return &TokenBucketLimiter{
+		rate:   requestsPerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// NewIntervalLimiter allows one request every interval. An interval of 0 or
+// less doesn't limit requests at all.
+func NewIntervalLimiter(interval time.Duration) *TokenBucketLimiter {
+	if interval <= 0 {
+		return NewTokenBucketLimiter(0, 1)
+	}
+	return NewTokenBucketLimiter(float64(time.Second)/float64(interval), 1)
+}
+
+func (limiter *TokenBucketLimiter) reserve() time.Duration {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	now := time.Now()
+	limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.rate
+	if limiter.tokens > limiter.burst {
+		limiter.tokens = limiter.burst
+	}
+	limiter.last = now
+	limiter.tokens -= 1
+	if limiter.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-limiter.tokens / limiter.rate * float64(time.Second))
+}
+
+func (limiter *TokenBucketLimiter) cancel() {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	limiter.tokens += 1
+}
+
+func (limiter *TokenBucketLimiter) Wait(ctx context.Context) error {
+	if limiter.rate <= 0 {
+		return ctx.Err()
+	}
+	delay := limiter.reserve()
+	if err := sleepContext(ctx, delay); err != nil {
+		limiter.cancel()
+		return err
+	}
+	return nil
+}
+
+type rateLimiters struct {
+	global  RateLimiter
+	classes map[EndpointClass]RateLimiter
+}
+
+func (limiters rateLimiters) wait(ctx context.Context, class EndpointClass) error {
+	if limiters.global != nil {
+		if err := limiters.global.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if limiter, ok := limiters.classes[class]; ok && limiter != nil {
+		return limiter.Wait(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package querynessus
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestIntervalLimiterPacesRequests(t *testing.T) {
+	limiter := NewIntervalLimiter(20 * time.Millisecond)
+	started := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(started); elapsed < 40*time.Millisecond {
+		t.Errorf("3 requests took %s, want at least 40ms", elapsed)
+	}
+}
+
+func TestLimitersWithoutARateDoNotWait(t *testing.T) {
+	for name, limiter := range map[string]*TokenBucketLimiter{
+		"zero interval":     NewIntervalLimiter(0),
+		"negative interval": NewIntervalLimiter(-time.Second),
+		"zero rate":         NewTokenBucketLimiter(0, 1),
+		"negative rate":     NewTokenBucketLimiter(-1, 1),
+		"infinite rate":     NewTokenBucketLimiter(math.Inf(1), 1),
+	} {
+		started := time.Now()
+		for i := 0; i < 100; i++ {
+			if err := limiter.Wait(context.Background()); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+		}
+		if elapsed := time.Since(started); elapsed > 100*time.Millisecond {
+			t.Errorf("%s: 100 requests took %s", name, elapsed)
+		}
+	}
+}
+
+func TestTokenBucketLimiterWaitIsCancellable(t *testing.T) {
+	limiter := NewTokenBucketLimiter(0.001, 1)
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -1,10 +1,15 @@
 package querynessus
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -13,21 +18,47 @@ type PluginRepository interface {
 	Save(*PluginListPage) error
 }
 
+// IncrementalPluginRepository can change individual plugins without
+// rewriting the whole repository.
+type IncrementalPluginRepository interface {
+	PluginRepository
+	Upsert(plugins ...PluginDetails) (newCount int, updatedCount int, duplicateCount int, err error)
+	Get(id int) (PluginDetails, bool, error)
+	Delete(ids ...int) error
+}
+
 type JsonFilePluginRepository struct {
 	filename string
+	backups  int
+	lockFile *os.File
+}
+
+type JsonFileRepositoryOption func(*JsonFilePluginRepository)
+
+// WithBackups keeps the previous count versions of the file as
+// filename.1 (newest) to filename.N (oldest) whenever Save replaces it.
+func WithBackups(count int) JsonFileRepositoryOption {
+	return func(jfpr *JsonFilePluginRepository) {
+		jfpr.backups = count
+	}
 }
 
-func NewJsonFilePluginRepository(filename string) (*JsonFilePluginRepository, error) {
-	return &JsonFilePluginRepository{
+func NewJsonFilePluginRepository(filename string, opts ...JsonFileRepositoryOption) (*JsonFilePluginRepository, error) {
+	jfpr := &JsonFilePluginRepository{
 		filename: filename,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(jfpr)
+	}
+	return jfpr, nil
 }
 
-func (jfpr JsonFilePluginRepository) Load() (*PluginListPage, error) {
-	jsonFile, err := os.Open(jfpr.filename)
+func (jfpr *JsonFilePluginRepository) Load() (*PluginListPage, error) {
+	jsonFile, err := openDecompressed(jfpr.filename)
 	if err != nil {
 		return &PluginListPage{}, err
 	}
+	defer jsonFile.Close()
 	results, err := ioutil.ReadAll(jsonFile)
 	if err != nil {
 		return &PluginListPage{}, err
@@ -37,41 +68,242 @@ func (jfpr JsonFilePluginRepository) Load() (*PluginListPage, error) {
 	if err != nil {
 		return &PluginListPage{}, err
 	}
+	jfpr.loadSearchIndex(&pluginPage)
+	pluginPage.Data.TrackHistory()
 	return &pluginPage, nil
 }
 
-func (jfpr JsonFilePluginRepository) Save(plugins *PluginListPage) error {
+// loadSearchIndex attaches the search index saved alongside the repository,
+// if there is one. An unreadable index is ignored so it gets rebuilt.
+func (jfpr *JsonFilePluginRepository) loadSearchIndex(pluginPage *PluginListPage) {
+	filename := SearchIndexFilename(jfpr.filename)
+	if _, err := os.Stat(filename); err != nil {
+		return
+	}
+	index, err := LoadSearchIndex(filename)
+	if err != nil {
+		log.Printf("Ignoring search index: %s", err)
+		return
+	}
+	pluginPage.Data.AttachSearchIndex(index)
+}
+
+// Lock takes an exclusive lock on the repository that is held until Unlock,
+// blocking while another process holds it. Hold the lock across Load and
+// Save so concurrent updaters can't overwrite each other's changes.
+func (jfpr *JsonFilePluginRepository) Lock() error {
+	if jfpr.lockFile != nil {
+		return errors.New("repository is already locked")
+	}
+	file, err := os.OpenFile(jfpr.filename+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to lock %s: %w", jfpr.filename, err)
+	}
+	jfpr.lockFile = file
+	return nil
+}
+
+func (jfpr *JsonFilePluginRepository) Unlock() error {
+	if jfpr.lockFile == nil {
+		return nil
+	}
+	err := unlockFile(jfpr.lockFile)
+	closeErr := jfpr.lockFile.Close()
+	jfpr.lockFile = nil
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func (jfpr *JsonFilePluginRepository) Save(plugins *PluginListPage) error {
+	if jfpr.lockFile == nil {
+		if err := jfpr.Lock(); err != nil {
+			return err
+		}
+		defer jfpr.Unlock()
+	}
 	file, err := json.Marshal(plugins)
 	if err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(jfpr.filename, file, 0644)
+	err = rotateBackups(jfpr.filename, jfpr.backups)
+	if err != nil {
+		return fmt.Errorf("failed to back up %s: %w", jfpr.filename, err)
+	}
+	err = writeCompressedFileAtomic(jfpr.filename, 0644, func(w io.Writer) error {
+		_, err := w.Write(file)
+		return err
+	})
 	if err != nil {
 		return err
 	}
+	if err := appendRevisions(HistoryFilename(jfpr.filename), plugins.Data.TakeRevisions()); err != nil {
+		return fmt.Errorf("failed to record plugin history: %w", err)
+	}
+	if index := plugins.Data.SearchIndex(); index != nil && index.Modified() {
+		return index.SaveToFile(SearchIndexFilename(jfpr.filename))
+	}
 	return nil
 }
 
-var TenablePluginsServiceEndpoint = "https://cloud.tenable.com/plugins/plugin"
-var TenableScannerGroupsEndpoint = "https://cloud.tenable.com/scanner-groups"
-var TenableScanEndpoint = "https://cloud.tenable.com/scans"
-var TenableFoldersEndpoint = "https://cloud.tenable.com/folders"
+func (jfpr *JsonFilePluginRepository) ModTime() (time.Time, error) {
+	info, err := os.Stat(jfpr.filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+const DefaultTenableBaseURL = "https://cloud.tenable.com"
+
+const (
+	TenablePluginsServicePath = "/plugins/plugin"
+	TenableScannerGroupsPath  = "/scanner-groups"
+	TenableScanPath           = "/scans"
+	TenableFoldersPath        = "/folders"
+)
+
 var RequestInterval = 3 * time.Second
 
+var ErrReadOnlyRepository = errors.New("cannot save to Tenable API")
+
+// TenableRepository loads the full plugin catalogue live from the Tenable
+// API. It is read only.
 type TenableRepository struct {
-	requestInterval time.Duration
+	client TenableApiClient
+	params RequestParams
+}
+
+func NewTenableRepository(client TenableApiClient) (*TenableRepository, error) {
+	return &TenableRepository{
+		client: client,
+		params: RequestParams{
+			Size: 10000,
+			Page: 1,
+		},
+	}, nil
 }
 
 func (tr TenableRepository) Load() (*PluginListPage, error) {
-	return &PluginListPage{}, nil
+	return tr.LoadContext(context.Background())
+}
+
+func (tr TenableRepository) LoadContext(ctx context.Context) (*PluginListPage, error) {
+	params := tr.params
+	plugins, err := tr.client.FetchAllPluginsContext(ctx, &params)
+	if err != nil {
+		return &PluginListPage{}, err
+	}
+	return &PluginListPage{
+		Size:       len(plugins),
+		TotalCount: len(plugins),
+		Data: PluginDetailsList{
+			PluginDetails: plugins,
+		},
+	}, nil
 }
 
 func (tr TenableRepository) Save(plugins *PluginListPage) error {
-	return errors.New("cannot save to Tenable API")
+	return ErrReadOnlyRepository
 }
 
-func NewTenableRepository() (*TenableRepository, error) {
-	return &TenableRepository{
-		requestInterval: 3 * time.Second,
+// CachingPluginRepository serves plugins from cache while it is younger
+// than ttl and otherwise reloads them from source and saves them to cache.
+// The age of caches with a ModTime method (such as JsonFilePluginRepository
+// and BoltPluginRepository) survives restarts, other caches are refreshed on
+// the first Load.
+type CachingPluginRepository struct {
+	cache  PluginRepository
+	source PluginRepository
+	ttl    time.Duration
+
+	mu          sync.Mutex
+	refreshedAt time.Time
+}
+
+func NewCachingPluginRepository(cache PluginRepository, source PluginRepository, ttl time.Duration) (*CachingPluginRepository, error) {
+	if cache == nil || source == nil {
+		return nil, errors.New("caching repository needs both a cache and a source")
+	}
+	return &CachingPluginRepository{
+		cache:  cache,
+		source: source,
+		ttl:    ttl,
 	}, nil
 }
+
+func (cpr *CachingPluginRepository) cacheAge() (time.Duration, bool) {
+	if modTimer, ok := cpr.cache.(interface {
+		ModTime() (time.Time, error)
+	}); ok {
+		modTime, err := modTimer.ModTime()
+		if err != nil {
+			return 0, false
+		}
+		return time.Since(modTime), true
+	}
+	if cpr.refreshedAt.IsZero() {
+		return 0, false
+	}
+	return time.Since(cpr.refreshedAt), true
+}
+
+func (cpr *CachingPluginRepository) Load() (*PluginListPage, error) {
+	cpr.mu.Lock()
+	defer cpr.mu.Unlock()
+
+	if age, known := cpr.cacheAge(); known && age < cpr.ttl {
+		plugins, err := cpr.cache.Load()
+		if err == nil {
+			return plugins, nil
+		}
+		log.Printf("Failed to load plugins from cache, reloading from source: %s", err)
+	}
+	plugins, err := cpr.refresh()
+	if err != nil {
+		stalePlugins, cacheErr := cpr.cache.Load()
+		if cacheErr == nil && len(stalePlugins.Data.PluginDetails) > 0 {
+			log.Printf("Serving stale plugins from cache: %s", err)
+			return stalePlugins, nil
+		}
+	}
+	return plugins, err
+}
+
+// Refresh reloads plugins from source regardless of the age of the cache.
+func (cpr *CachingPluginRepository) Refresh() (*PluginListPage, error) {
+	cpr.mu.Lock()
+	defer cpr.mu.Unlock()
+	return cpr.refresh()
+}
+
+func (cpr *CachingPluginRepository) refresh() (*PluginListPage, error) {
+	plugins, err := cpr.source.Load()
+	if err != nil {
+		return &PluginListPage{}, fmt.Errorf("failed to load plugins from source: %w", err)
+	}
+	err = cpr.cache.Save(plugins)
+	if err != nil {
+		log.Printf("Failed to save plugins to cache: %s", err)
+		return plugins, nil
+	}
+	cpr.refreshedAt = time.Now()
+	return plugins, nil
+}
+
+// Save writes plugins to the cache only, the source is never written to.
+func (cpr *CachingPluginRepository) Save(plugins *PluginListPage) error {
+	cpr.mu.Lock()
+	defer cpr.mu.Unlock()
+	err := cpr.cache.Save(plugins)
+	if err != nil {
+		return err
+	}
+	cpr.refreshedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,278 @@
+package querynessus
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJsonFileRepositoryBackups(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "plugins.json")
+	repo, err := NewJsonFilePluginRepository(filename, WithBackups(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The size records which save wrote each version.
+	for version := 1; version <= 4; version++ {
+		if err := repo.Save(&PluginListPage{Size: version}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]int{filename: 4, filename + ".1": 3, filename + ".2": 2} {
+		backup, err := NewJsonFilePluginRepository(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := backup.Load()
+		if err != nil {
+			t.Errorf("%s: %v", filepath.Base(name), err)
+			continue
+		}
+		if page.Size != want {
+			t.Errorf("%s holds version %d, want %d", filepath.Base(name), page.Size, want)
+		}
+	}
+	if _, err := os.Stat(filename + ".3"); !os.IsNotExist(err) {
+		t.Errorf("backup beyond the second was kept: %v", err)
+	}
+}
+
+func TestJsonFileRepositoryWithoutBackups(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := NewJsonFilePluginRepository(filepath.Join(dir, "plugins.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := repo.Save(&PluginListPage{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if names := dirEntries(t, dir); len(names) != 2 || names[0] != "plugins.json" || names[1] != "plugins.json.lock" {
+		t.Errorf("directory contains %v, want plugins.json and its lock", names)
+	}
+}
+
+func TestJsonFileRepositoryLock(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "plugins.json")
+	first, err := NewJsonFilePluginRepository(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewJsonFilePluginRepository(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Lock(); err == nil {
+		t.Error("second Lock of the same repository succeeded while the first was held")
+	}
+
+	locked := make(chan error, 1)
+	go func() {
+		locked <- second.Lock()
+	}()
+	select {
+	case err := <-locked:
+		t.Fatalf("Lock of another repository on the same file returned %v while the first was held", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := first.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Lock still blocked after the first lock was released")
+	}
+	if err := second.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Unlock(); err != nil {
+		t.Errorf("Unlock of an unlocked repository returned %v", err)
+	}
+}
+
+// fakePluginRepository stands in for the source or cache of a
+// CachingPluginRepository.
+type fakePluginRepository struct {
+	page    *PluginListPage
+	err     error
+	saveErr error
+	loads   int
+	saves   int
+}
+
+func (repo *fakePluginRepository) Load() (*PluginListPage, error) {
+	repo.loads += 1
+	if repo.err != nil {
+		return &PluginListPage{}, repo.err
+	}
+	return repo.page, nil
+}
+
+func (repo *fakePluginRepository) Save(plugins *PluginListPage) error {
+	if repo.saveErr != nil {
+		return repo.saveErr
+	}
+	repo.saves += 1
+	repo.page = plugins
+	return nil
+}
+
+func cachingTestPage(ids ...int) *PluginListPage {
+	page := &PluginListPage{Size: len(ids), TotalCount: len(ids)}
+	for _, id := range ids {
+		page.Data.PluginDetails = append(page.Data.PluginDetails, PluginDetails{ID: id})
+	}
+	return page
+}
+
+// newCachedJsonFile saves plugins to a JSON file cache last written age ago.
+func newCachedJsonFile(t *testing.T, age time.Duration, ids ...int) *JsonFilePluginRepository {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "plugins.json")
+	cache, err := NewJsonFilePluginRepository(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Save(cachingTestPage(ids...)); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-age)
+	if err := os.Chtimes(filename, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func assertPluginPage(t *testing.T, page *PluginListPage, err error, want ...int) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if ids := pluginIDs(page.Data.PluginDetails); !reflect.DeepEqual(ids, append([]int{}, want...)) {
+		t.Errorf("Load returned plugins %v, want %v", ids, want)
+	}
+}
+
+func TestCachingRepositoryServesFreshCache(t *testing.T) {
+	source := &fakePluginRepository{page: cachingTestPage(2)}
+	repo, err := NewCachingPluginRepository(newCachedJsonFile(t, time.Minute, 1), source, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := repo.Load()
+	assertPluginPage(t, page, err, 1)
+	if source.loads != 0 {
+		t.Errorf("source loaded %d times while the cache was fresh", source.loads)
+	}
+}
+
+func TestCachingRepositoryRefreshesExpiredCache(t *testing.T) {
+	cache := newCachedJsonFile(t, 2*time.Hour, 1)
+	source := &fakePluginRepository{page: cachingTestPage(2)}
+	repo, err := NewCachingPluginRepository(cache, source, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := repo.Load()
+	assertPluginPage(t, page, err, 2)
+
+	// The refreshed cache is fresh again.
+	page, err = repo.Load()
+	assertPluginPage(t, page, err, 2)
+	if source.loads != 1 {
+		t.Errorf("source loaded %d times, want 1", source.loads)
+	}
+	page, err = cache.Load()
+	assertPluginPage(t, page, err, 2)
+}
+
+func TestCachingRepositoryLoadsMissingCacheFromSource(t *testing.T) {
+	cache, err := NewJsonFilePluginRepository(filepath.Join(t.TempDir(), "plugins.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &fakePluginRepository{page: cachingTestPage(2)}
+	repo, err := NewCachingPluginRepository(cache, source, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := repo.Load()
+	assertPluginPage(t, page, err, 2)
+	if _, err := cache.ModTime(); err != nil {
+		t.Errorf("cache wasn't written: %v", err)
+	}
+}
+
+func TestCachingRepositoryServesStaleCacheOnSourceError(t *testing.T) {
+	errSource := errors.New("tenable unavailable")
+	source := &fakePluginRepository{err: errSource}
+	repo, err := NewCachingPluginRepository(newCachedJsonFile(t, 2*time.Hour, 1), source, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := repo.Load()
+	assertPluginPage(t, page, err, 1)
+	if source.loads != 1 {
+		t.Errorf("source loaded %d times, want 1", source.loads)
+	}
+
+	// Without cached plugins to fall back on the source error is returned.
+	repo, err = NewCachingPluginRepository(newCachedJsonFile(t, 2*time.Hour), source, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Load(); !errors.Is(err, errSource) {
+		t.Errorf("Load of an empty cache returned %v, want the source error", err)
+	}
+}
+
+func TestCachingRepositoryIgnoresCacheSaveFailure(t *testing.T) {
+	cache := &fakePluginRepository{saveErr: errors.New("disk full")}
+	source := &fakePluginRepository{page: cachingTestPage(2)}
+	repo, err := NewCachingPluginRepository(cache, source, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := repo.Load()
+	assertPluginPage(t, page, err, 2)
+
+	// Nothing was cached, so the next Load goes back to the source.
+	page, err = repo.Load()
+	assertPluginPage(t, page, err, 2)
+	if source.loads != 2 || cache.loads != 0 {
+		t.Errorf("source loaded %d times and cache %d times, want 2 and 0", source.loads, cache.loads)
+	}
+}
+
+func TestCachingRepositorySaveOnlyWritesCache(t *testing.T) {
+	cache := &fakePluginRepository{}
+	source := &fakePluginRepository{page: cachingTestPage(2)}
+	repo, err := NewCachingPluginRepository(cache, source, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Save(cachingTestPage(1)); err != nil {
+		t.Fatal(err)
+	}
+	page, err := repo.Load()
+	assertPluginPage(t, page, err, 1)
+	if cache.saves != 1 || source.saves != 0 || source.loads != 0 {
+		t.Errorf("cache saved %d times, source saved %d and loaded %d times, want 1, 0 and 0",
+			cache.saves, source.saves, source.loads)
+	}
+}
@@ -126,6 +126,37 @@ type Vulnerability struct {
 	VulnerabilityIndex int    `json:"vuln_index"`
 }
 
+// ScanHostDetails is what a scan found on one host.
+type ScanHostDetails struct {
+	Info            HostInfo            `json:"info"`
+	Vulnerabilities []HostVulnerability `json:"vulnerabilities"`
+	Compliance      []HostVulnerability `json:"compliance"`
+}
+
+type HostInfo struct {
+	HostStart string `json:"host_start"`
+	HostEnd   string `json:"host_end"`
+	HostIP    string `json:"host-ip"`
+	HostFQDN  string `json:"host-fqdn"`
+	NetBIOS   string `json:"netbios-name"`
+	MAC       string `json:"mac-address"`
+	// OperatingSystem lists the operating systems the host may be running,
+	// most likely first.
+	OperatingSystem []string `json:"operating-system"`
+}
+
+type HostVulnerability struct {
+	Count              int    `json:"count"`
+	HostID             int    `json:"host_id"`
+	Hostname           string `json:"hostname"`
+	PluginID           int    `json:"plugin_id"`
+	PluginName         string `json:"plugin_name"`
+	PluginFamily       string `json:"plugin_family"`
+	Severity           int    `json:"severity"`
+	SeverityIndex      int    `json:"severity_index"`
+	VulnerabilityIndex int    `json:"vuln_index"`
+}
+
 type Compliance struct {
 	Count         int    `json:"count"`
 	HostID        int    `json:"host_id"`
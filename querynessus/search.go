@@ -0,0 +1,703 @@
+package querynessus
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+type SearchField int
+
+const (
+	SearchFieldName SearchField = iota
+	SearchFieldSynopsis
+	SearchFieldDescription
+	SearchFieldSolution
+	searchFieldCount
+)
+
+var searchFieldNames = [searchFieldCount]string{"name", "synopsis", "description", "solution"}
+
+func (field SearchField) String() string {
+	if field < 0 || field >= searchFieldCount {
+		return fmt.Sprintf("SearchField(%d)", int(field))
+	}
+	return searchFieldNames[field]
+}
+
+func searchFieldTexts(plugin *PluginDetails) [searchFieldCount]string {
+	return [searchFieldCount]string{
+		plugin.Name,
+		plugin.Attributes.Synopsis,
+		plugin.Attributes.Description,
+		plugin.Attributes.Solution,
+	}
+}
+
+// DefaultSearchBoosts weights a match in the plugin name above one buried in
+// the description.
+var DefaultSearchBoosts = map[SearchField]float64{
+	SearchFieldName:        3,
+	SearchFieldSynopsis:    2,
+	SearchFieldDescription: 1,
+	SearchFieldSolution:    0.5,
+}
+
+type SearchOptions struct {
+	// Limit is the maximum number of hits to return, 0 for all of them.
+	Limit int
+	// Boosts overrides DefaultSearchBoosts for the fields it contains. A
+	// field boosted by 0 is only searched when a query names it explicitly.
+	Boosts map[SearchField]float64
+}
+
+func (opts *SearchOptions) boost(field SearchField) float64 {
+	if opts != nil {
+		if boost, ok := opts.Boosts[field]; ok {
+			return boost
+		}
+	}
+	return DefaultSearchBoosts[field]
+}
+
+type SearchHit struct {
+	ID    int
+	Score float64
+}
+
+// BM25 parameters.
+const (
+	searchK1 = 1.2
+	searchB  = 0.75
+)
+
+// Documents are never removed from the postings in place. Replacing or
+// removing a plugin marks its document deleted and the postings are
+// rewritten once enough of them have built up.
+const searchCompactMinDeleted = 1024
+
+const searchIndexVersion = 1
+
+type searchPosting struct {
+	Doc    int32
+	Offset uint32
+	Count  uint16
+	Field  uint8
+}
+
+// searchTerm holds every occurrence of a term. Each posting refers to Count
+// positions starting at Offset in Positions.
+type searchTerm struct {
+	Postings  []searchPosting
+	Positions []int32
+}
+
+func (term *searchTerm) positions(posting searchPosting) []int32 {
+	return term.Positions[posting.Offset : posting.Offset+uint32(posting.Count)]
+}
+
+type searchDocument struct {
+	ID      int
+	Hash    uint64
+	Lengths [searchFieldCount]uint32
+	Deleted bool
+}
+
+// SearchIndex is an inverted index over plugin names, synopses,
+// descriptions and solutions supporting ranked keyword and phrase queries.
+// It is safe for concurrent use.
+type SearchIndex struct {
+	mu       sync.RWMutex
+	terms    map[string]*searchTerm
+	docs     []searchDocument
+	docByID  map[int]int32
+	totals   [searchFieldCount]uint64
+	deleted  int
+	modified bool
+}
+
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{
+		terms:   map[string]*searchTerm{},
+		docByID: map[int]int32{},
+	}
+}
+
+func BuildSearchIndex(plugins []PluginDetails) *SearchIndex {
+	index := NewSearchIndex()
+	for i := range plugins {
+		index.add(&plugins[i])
+	}
+	return index
+}
+
+// SearchIndexFilename is where the search index for a plugin repository
+// stored in repositoryFilename is kept.
+func SearchIndexFilename(repositoryFilename string) string {
+	return repositoryFilename + ".search"
+}
+
+func tokenize(text string, fn func(term string)) {
+	start := -1
+	for i, r := range text {
+		isWordRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWordRune && start < 0 {
+			start = i
+		} else if !isWordRune && start >= 0 {
+			fn(strings.ToLower(text[start:i]))
+			start = -1
+		}
+	}
+	if start >= 0 {
+		fn(strings.ToLower(text[start:]))
+	}
+}
+
+func searchHash(texts [searchFieldCount]string) uint64 {
+	hash := fnv.New64a()
+	for _, text := range texts {
+		io.WriteString(hash, text)
+		hash.Write([]byte{0})
+	}
+	return hash.Sum64()
+}
+
+// Add indexes plugin, replacing any earlier version of it. It reports
+// whether the index changed.
+func (index *SearchIndex) Add(plugin *PluginDetails) bool {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	changed := index.add(plugin)
+	index.maybeCompact()
+	return changed
+}
+
+func (index *SearchIndex) add(plugin *PluginDetails) bool {
+	texts := searchFieldTexts(plugin)
+	hash := searchHash(texts)
+	if docNum, exists := index.docByID[plugin.ID]; exists {
+		if index.docs[docNum].Hash == hash {
+			return false
+		}
+		index.removeDoc(docNum)
+	}
+
+	docNum := int32(len(index.docs))
+	doc := searchDocument{ID: plugin.ID, Hash: hash}
+	for field, text := range texts {
+		positions := map[string][]int32{}
+		length := int32(0)
+		tokenize(text, func(term string) {
+			positions[term] = append(positions[term], length)
+			length += 1
+		})
+		doc.Lengths[field] = uint32(length)
+		index.totals[field] += uint64(length)
+		for termText, termPositions := range positions {
+			if len(termPositions) > math.MaxUint16 {
+				termPositions = termPositions[:math.MaxUint16]
+			}
+			term, exists := index.terms[termText]
+			if !exists {
+				term = &searchTerm{}
+				index.terms[termText] = term
+			}
+			term.Postings = append(term.Postings, searchPosting{
+				Doc:    docNum,
+				Offset: uint32(len(term.Positions)),
+				Count:  uint16(len(termPositions)),
+				Field:  uint8(field),
+			})
+			term.Positions = append(term.Positions, termPositions...)
+		}
+	}
+	index.docs = append(index.docs, doc)
+	index.docByID[plugin.ID] = docNum
+	index.modified = true
+	return true
+}
+
+func (index *SearchIndex) Remove(ids ...int) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	for _, id := range ids {
+		if docNum, exists := index.docByID[id]; exists {
+			index.removeDoc(docNum)
+		}
+	}
+	index.maybeCompact()
+}
+
+func (index *SearchIndex) removeDoc(docNum int32) {
+	doc := &index.docs[docNum]
+	doc.Deleted = true
+	for field, length := range doc.Lengths {
+		index.totals[field] -= uint64(length)
+	}
+	delete(index.docByID, doc.ID)
+	index.deleted += 1
+	index.modified = true
+}
+
+// Sync brings the index in line with plugins, indexing new and changed
+// plugins and dropping any that are no longer present. It reports whether
+// the index changed.
+func (index *SearchIndex) Sync(plugins []PluginDetails) bool {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	changed := false
+	present := make(map[int]struct{}, len(plugins))
+	for i := range plugins {
+		present[plugins[i].ID] = struct{}{}
+		if index.add(&plugins[i]) {
+			changed = true
+		}
+	}
+	if index.retain(present) {
+		changed = true
+	}
+	index.maybeCompact()
+	return changed
+}
+
+// Retain drops every plugin whose ID isn't in ids and reports whether any
+// were dropped. Together with Add it syncs an index against a repository
+// that can't be loaded into memory at once.
+func (index *SearchIndex) Retain(ids map[int]struct{}) bool {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	changed := index.retain(ids)
+	index.maybeCompact()
+	return changed
+}
+
+func (index *SearchIndex) retain(ids map[int]struct{}) bool {
+	changed := false
+	for id, docNum := range index.docByID {
+		if _, keep := ids[id]; !keep {
+			index.removeDoc(docNum)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Len is the number of plugins in the index.
+func (index *SearchIndex) Len() int {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	return len(index.docByID)
+}
+
+// Modified reports whether the index has changed since it was built,
+// loaded or last saved.
+func (index *SearchIndex) Modified() bool {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	return index.modified
+}
+
+func (index *SearchIndex) maybeCompact() {
+	if index.deleted >= searchCompactMinDeleted && index.deleted*4 >= len(index.docs) {
+		index.compact()
+	}
+}
+
+// compact rewrites the postings without deleted documents.
+func (index *SearchIndex) compact() {
+	renumbered := make([]int32, len(index.docs))
+	docs := make([]searchDocument, 0, len(index.docs)-index.deleted)
+	for docNum, doc := range index.docs {
+		if doc.Deleted {
+			renumbered[docNum] = -1
+			continue
+		}
+		renumbered[docNum] = int32(len(docs))
+		index.docByID[doc.ID] = int32(len(docs))
+		docs = append(docs, doc)
+	}
+	for termText, term := range index.terms {
+		compacted := &searchTerm{}
+		for _, posting := range term.Postings {
+			docNum := renumbered[posting.Doc]
+			if docNum < 0 {
+				continue
+			}
+			positions := term.positions(posting)
+			posting.Doc = docNum
+			posting.Offset = uint32(len(compacted.Positions))
+			compacted.Postings = append(compacted.Postings, posting)
+			compacted.Positions = append(compacted.Positions, positions...)
+		}
+		if len(compacted.Postings) == 0 {
+			delete(index.terms, termText)
+			continue
+		}
+		index.terms[termText] = compacted
+	}
+	index.docs = docs
+	index.deleted = 0
+}
+
+type searchIndexFile struct {
+	Version int
+	Docs    []searchDocument
+	Terms   map[string]*searchTerm
+}
+
+// SaveToFile writes the index to filename atomically, compressed if the
+// name ends in .gz or .zst.
+func (index *SearchIndex) SaveToFile(filename string) error {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	if index.deleted > 0 {
+		index.compact()
+	}
+	err := writeCompressedFileAtomic(filename, 0644, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(searchIndexFile{
+			Version: searchIndexVersion,
+			Docs:    index.docs,
+			Terms:   index.terms,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	index.modified = false
+	return nil
+}
+
+var ErrSearchIndexVersion = errors.New("unsupported search index version")
+
+func LoadSearchIndex(filename string) (*SearchIndex, error) {
+	file, err := openDecompressed(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var data searchIndexFile
+	if err := gob.NewDecoder(file).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode search index %s: %w", filename, err)
+	}
+	if data.Version != searchIndexVersion {
+		return nil, fmt.Errorf("%w %d in %s", ErrSearchIndexVersion, data.Version, filename)
+	}
+	index := NewSearchIndex()
+	if data.Terms != nil {
+		index.terms = data.Terms
+	}
+	index.docs = data.Docs
+	for docNum, doc := range index.docs {
+		if doc.Deleted {
+			index.deleted += 1
+			continue
+		}
+		index.docByID[doc.ID] = int32(docNum)
+		for field, length := range doc.Lengths {
+			index.totals[field] += uint64(length)
+		}
+	}
+	return index, nil
+}
+
+// searchClause is a word or quoted phrase from a query, optionally limited
+// to one field with a field: prefix or excluded with a - prefix.
+type searchClause struct {
+	terms    []string
+	field    SearchField
+	anyField bool
+	exclude  bool
+}
+
+func lookupSearchField(name string) (SearchField, bool) {
+	for field, fieldName := range searchFieldNames {
+		if strings.EqualFold(name, fieldName) {
+			return SearchField(field), true
+		}
+	}
+	return 0, false
+}
+
+// parseSearchQuery splits a query like
+//
+//	openssl name:"remote code execution" -windows
+//
+// into clauses. A word that tokenizes into several terms, e.g. a CVE ID, is
+// treated as a phrase.
+func parseSearchQuery(query string) ([]searchClause, error) {
+	var clauses []searchClause
+	rest := strings.TrimSpace(query)
+	for rest != "" {
+		clause := searchClause{anyField: true}
+		if strings.HasPrefix(rest, "-") {
+			clause.exclude = true
+			rest = rest[1:]
+		}
+		if colon := strings.IndexByte(rest, ':'); colon > 0 && !strings.ContainsAny(rest[:colon], " \t\"") {
+			if field, ok := lookupSearchField(rest[:colon]); ok {
+				clause.field = field
+				clause.anyField = false
+				rest = rest[colon+1:]
+			}
+		}
+		var text string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated phrase in search query %q", query)
+			}
+			text = rest[1 : end+1]
+			rest = rest[end+2:]
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			text = rest[:end]
+			rest = rest[end:]
+		}
+		rest = strings.TrimSpace(rest)
+		tokenize(text, func(term string) {
+			clause.terms = append(clause.terms, term)
+		})
+		if len(clause.terms) > 0 {
+			clauses = append(clauses, clause)
+		}
+	}
+	for _, clause := range clauses {
+		if !clause.exclude {
+			return clauses, nil
+		}
+	}
+	return nil, fmt.Errorf("search query %q has no search terms", query)
+}
+
+type searchFrequencies [searchFieldCount]uint32
+
+func containsPosition(positions []int32, position int32) bool {
+	i := sort.Search(len(positions), func(i int) bool { return positions[i] >= position })
+	return i < len(positions) && positions[i] == position
+}
+
+type docField struct {
+	doc   int32
+	field uint8
+}
+
+// matchClause returns how often the clause's phrase occurs in each field of
+// every live document containing it.
+func (index *SearchIndex) matchClause(clause searchClause, fields [searchFieldCount]bool) map[int32]*searchFrequencies {
+	matches := map[int32]*searchFrequencies{}
+	terms := make([]*searchTerm, len(clause.terms))
+	for i, termText := range clause.terms {
+		term, exists := index.terms[termText]
+		if !exists {
+			return matches
+		}
+		terms[i] = term
+	}
+
+	// Positions of every term after the first, by document and field.
+	following := make([]map[docField][]int32, len(terms))
+	for i := 1; i < len(terms); i++ {
+		following[i] = map[docField][]int32{}
+		for _, posting := range terms[i].Postings {
+			following[i][docField{posting.Doc, posting.Field}] = terms[i].positions(posting)
+		}
+	}
+
+	for _, posting := range terms[0].Postings {
+		if index.docs[posting.Doc].Deleted || !fields[posting.Field] {
+			continue
+		}
+		count := uint32(0)
+		if len(terms) == 1 {
+			count = uint32(posting.Count)
+		} else {
+			key := docField{posting.Doc, posting.Field}
+			for _, position := range terms[0].positions(posting) {
+				found := true
+				for i := 1; i < len(terms) && found; i++ {
+					found = containsPosition(following[i][key], position+int32(i))
+				}
+				if found {
+					count += 1
+				}
+			}
+		}
+		if count == 0 {
+			continue
+		}
+		frequencies, exists := matches[posting.Doc]
+		if !exists {
+			frequencies = &searchFrequencies{}
+			matches[posting.Doc] = frequencies
+		}
+		frequencies[posting.Field] += count
+	}
+	return matches
+}
+
+// documentFrequency is the number of live documents containing term.
+func (index *SearchIndex) documentFrequency(term *searchTerm) int {
+	count := 0
+	last := int32(-1)
+	for _, posting := range term.Postings {
+		if posting.Doc != last && !index.docs[posting.Doc].Deleted {
+			count += 1
+		}
+		last = posting.Doc
+	}
+	return count
+}
+
+func (index *SearchIndex) inverseDocumentFrequency(clause searchClause) float64 {
+	documents := float64(len(index.docByID))
+	idf := 0.0
+	for _, termText := range clause.terms {
+		frequency := 0.0
+		if term, exists := index.terms[termText]; exists {
+			frequency = float64(index.documentFrequency(term))
+		}
+		idf += math.Log(1 + (documents-frequency+0.5)/(frequency+0.5))
+	}
+	return idf
+}
+
+// Search returns the plugins matching every search term and phrase in
+// query, best match first. Terms prefixed with a field name and a colon,
+// e.g. name:openssl, only match that field and terms prefixed with - must
+// not appear at all. Hits are ranked with BM25 over each field, weighted by
+// the field boosts in opts.
+func (index *SearchIndex) Search(query string, opts *SearchOptions) ([]SearchHit, error) {
+	clauses, err := parseSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	var boosts [searchFieldCount]float64
+	var averageLengths [searchFieldCount]float64
+	for field := range boosts {
+		boosts[field] = opts.boost(SearchField(field))
+		if len(index.docByID) > 0 {
+			averageLengths[field] = float64(index.totals[field]) / float64(len(index.docByID))
+		}
+	}
+
+	var scores map[int32]float64
+	excluded := map[int32]struct{}{}
+	for _, clause := range clauses {
+		var fields [searchFieldCount]bool
+		for field := range fields {
+			if clause.anyField {
+				fields[field] = clause.exclude || boosts[field] > 0
+			} else {
+				fields[field] = SearchField(field) == clause.field
+			}
+		}
+		matches := index.matchClause(clause, fields)
+		if clause.exclude {
+			for docNum := range matches {
+				excluded[docNum] = struct{}{}
+			}
+			continue
+		}
+
+		idf := index.inverseDocumentFrequency(clause)
+		clauseScores := make(map[int32]float64, len(matches))
+		for docNum, frequencies := range matches {
+			if scores != nil {
+				if _, matchedEarlier := scores[docNum]; !matchedEarlier {
+					continue
+				}
+			}
+			score := 0.0
+			for field, frequency := range frequencies {
+				if frequency == 0 {
+					continue
+				}
+				boost := boosts[field]
+				if boost <= 0 {
+					// Only reachable when the query named the field.
+					boost = 1
+				}
+				tf := float64(frequency)
+				norm := 1.0
+				if averageLengths[field] > 0 {
+					norm = 1 - searchB + searchB*float64(index.docs[docNum].Lengths[field])/averageLengths[field]
+				}
+				score += boost * idf * tf * (searchK1 + 1) / (tf + searchK1*norm)
+			}
+			clauseScores[docNum] = scores[docNum] + score
+		}
+		scores = clauseScores
+	}
+
+	hits := make([]SearchHit, 0, len(scores))
+	for docNum, score := range scores {
+		if _, isExcluded := excluded[docNum]; isExcluded {
+			continue
+		}
+		hits = append(hits, SearchHit{ID: index.docs[docNum].ID, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if opts != nil && opts.Limit > 0 && len(hits) > opts.Limit {
+		hits = hits[:opts.Limit]
+	}
+	return hits, nil
+}
+
+type SearchResult struct {
+	Plugin PluginDetails
+	Score  float64
+}
+
+// AttachSearchIndex makes Merge keep index up to date with the list. The
+// index is synced with the current plugins first.
+func (pdl *PluginDetailsList) AttachSearchIndex(index *SearchIndex) {
+	if index != nil {
+		index.Sync(pdl.PluginDetails)
+	}
+	pdl.search = index
+}
+
+// SearchIndex returns the attached search index, or nil if there isn't one.
+func (pdl *PluginDetailsList) SearchIndex() *SearchIndex {
+	return pdl.search
+}
+
+// Search runs query against the attached search index, building and
+// attaching one first if needed.
+func (pluginsPage *PluginListPage) Search(query string, opts *SearchOptions) ([]SearchResult, error) {
+	if pluginsPage.Data.search == nil {
+		pluginsPage.Data.search = BuildSearchIndex(pluginsPage.Data.PluginDetails)
+	}
+	hits, err := pluginsPage.Data.search.Search(query, opts)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		plugin, _, exists := pluginsPage.Data.PluginFromId(hit.ID)
+		if !exists {
+			continue
+		}
+		results = append(results, SearchResult{Plugin: *plugin, Score: hit.Score})
+	}
+	return results, nil
+}
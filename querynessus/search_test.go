@@ -0,0 +1,258 @@
+package querynessus
+
+import (
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func searchTestPlugin(id int, name, synopsis, description, solution string) PluginDetails {
+	plugin := PluginDetails{ID: id, Name: name}
+	plugin.Attributes.Synopsis = synopsis
+	plugin.Attributes.Description = description
+	plugin.Attributes.Solution = solution
+	return plugin
+}
+
+func searchTestPlugins() []PluginDetails {
+	return []PluginDetails{
+		searchTestPlugin(1, "OpenSSL Remote Code Execution",
+			"The remote OpenSSL library is affected by a code execution flaw.",
+			"A buffer overflow in OpenSSL on Windows.",
+			"Upgrade OpenSSL."),
+		searchTestPlugin(2, "Apache HTTP Server Outdated",
+			"The web server is outdated.",
+			"The bundled openssl library is out of date.",
+			"Upgrade Apache."),
+		searchTestPlugin(3, "Microsoft Windows SMB Vulnerability",
+			"Remote code execution in SMB.",
+			"Code in the execution path is remotely reachable.",
+			"Apply the patch."),
+	}
+}
+
+func searchHitIDs(hits []SearchHit) []int {
+	ids := []int{}
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	index := BuildSearchIndex(searchTestPlugins())
+	for _, test := range []struct {
+		query string
+		opts  *SearchOptions
+		want  []int
+	}{
+		// Matches in the name and synopsis outrank one in the description.
+		{"openssl", nil, []int{1, 2}},
+		{"OPENSSL", nil, []int{1, 2}},
+		{"windows", nil, []int{3, 1}},
+		{"openssl", &SearchOptions{Limit: 1}, []int{1}},
+		{"upgrade openssl", nil, []int{1, 2}},
+		{"openssl smb", nil, []int{}},
+		{"nonexistent", nil, []int{}},
+
+		{`"code execution"`, nil, []int{1, 3}},
+		{`"execution path"`, nil, []int{3}},
+		{`"path execution"`, nil, []int{}},
+		{`"remote code execution" openssl`, nil, []int{1}},
+		// A word splitting into several terms is a phrase.
+		{"http-server", nil, []int{2}},
+		{"server-http", nil, []int{}},
+
+		{"name:openssl", nil, []int{1}},
+		{"NAME:openssl", nil, []int{1}},
+		{"description:openssl", nil, []int{1, 2}},
+		{"solution:apache", nil, []int{2}},
+		{"synopsis:windows", nil, []int{}},
+		// The shorter synopsis ranks first.
+		{`synopsis:"code execution"`, nil, []int{3, 1}},
+		{`name:"code execution"`, nil, []int{1}},
+
+		{"openssl -windows", nil, []int{2}},
+		{"code -smb", nil, []int{1}},
+		{`code -"buffer overflow"`, nil, []int{3}},
+		{"openssl -name:openssl", nil, []int{2}},
+		{"openssl -synopsis:outdated", nil, []int{1}},
+
+		// A field boosted by 0 is only searched when named.
+		{"windows", &SearchOptions{Boosts: map[SearchField]float64{SearchFieldName: 0}}, []int{1}},
+		{"name:windows", &SearchOptions{Boosts: map[SearchField]float64{SearchFieldName: 0}}, []int{3}},
+		{"openssl -windows", &SearchOptions{Boosts: map[SearchField]float64{SearchFieldDescription: 0}}, []int{}},
+	} {
+		hits, err := index.Search(test.query, test.opts)
+		if err != nil {
+			t.Errorf("Search(%q) failed: %v", test.query, err)
+			continue
+		}
+		if ids := searchHitIDs(hits); !reflect.DeepEqual(ids, test.want) {
+			t.Errorf("Search(%q) = %v, want %v", test.query, ids, test.want)
+		}
+		for i := 1; i < len(hits); i++ {
+			if hits[i].Score > hits[i-1].Score {
+				t.Errorf("Search(%q) hits out of order: %v", test.query, hits)
+			}
+		}
+	}
+}
+
+func TestSearchQueryErrors(t *testing.T) {
+	index := BuildSearchIndex(searchTestPlugins())
+	for _, query := range []string{"", "   ", "-openssl", "-openssl -windows", `"unterminated`, "!!!"} {
+		if hits, err := index.Search(query, nil); err == nil {
+			t.Errorf("Search(%q) = %v, want an error", query, hits)
+		}
+	}
+}
+
+func TestSearchIndexAddAndRetain(t *testing.T) {
+	plugins := searchTestPlugins()
+	index := BuildSearchIndex(plugins)
+	if !index.Modified() || index.Len() != 3 {
+		t.Fatalf("built index has Modified %v and Len %d, want true and 3", index.Modified(), index.Len())
+	}
+
+	if index.Add(&plugins[0]) {
+		t.Error("Add of an unchanged plugin reported a change")
+	}
+	changed := plugins[1]
+	changed.Attributes.Description = "Apache is affected by a heap overflow."
+	if !index.Add(&changed) {
+		t.Error("Add of a changed plugin reported no change")
+	}
+	if hits, _ := index.Search("description:openssl", nil); !reflect.DeepEqual(searchHitIDs(hits), []int{1}) {
+		t.Errorf("old text of a replaced plugin still matches: %v", searchHitIDs(hits))
+	}
+	if hits, _ := index.Search("heap", nil); !reflect.DeepEqual(searchHitIDs(hits), []int{2}) {
+		t.Errorf("new text of a replaced plugin found %v, want [2]", searchHitIDs(hits))
+	}
+
+	if index.Retain(map[int]struct{}{1: {}, 2: {}, 3: {}}) {
+		t.Error("Retain of every plugin reported a change")
+	}
+	if !index.Retain(map[int]struct{}{1: {}}) {
+		t.Error("Retain dropping plugins reported no change")
+	}
+	if index.Len() != 1 {
+		t.Errorf("Len is %d after Retain, want 1", index.Len())
+	}
+	for query, want := range map[string][]int{"openssl": {1}, "windows": {1}, "apache": {}} {
+		if hits, _ := index.Search(query, nil); !reflect.DeepEqual(searchHitIDs(hits), want) {
+			t.Errorf("Search(%q) after Retain = %v, want %v", query, searchHitIDs(hits), want)
+		}
+	}
+}
+
+func TestSearchIndexCompaction(t *testing.T) {
+	plugins := make([]PluginDetails, 2*searchCompactMinDeleted)
+	keep := map[int]struct{}{}
+	for i := range plugins {
+		plugins[i] = searchTestPlugin(i+1, "Plugin", "", "", "")
+		if i%2 == 0 {
+			plugins[i].Name = "Kept Plugin"
+			keep[i+1] = struct{}{}
+		}
+	}
+	index := BuildSearchIndex(plugins)
+	index.Retain(keep)
+
+	if len(index.docs) != len(keep) || index.deleted != 0 {
+		t.Fatalf("index has %d documents with %d deleted after Retain, want %d with none deleted",
+			len(index.docs), index.deleted, len(keep))
+	}
+	if postings := len(index.terms["plugin"].Postings); postings != len(keep) {
+		t.Errorf("compacted term has %d postings, want %d", postings, len(keep))
+	}
+	hits, err := index.Search("kept", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != len(keep) {
+		t.Errorf("found %d kept plugins after compaction, want %d", len(hits), len(keep))
+	}
+	for _, hit := range hits {
+		if _, kept := keep[hit.ID]; !kept {
+			t.Errorf("found dropped plugin %d after compaction", hit.ID)
+		}
+	}
+}
+
+func TestSearchIndexSaveAndLoad(t *testing.T) {
+	for _, name := range []string{"plugins.json.search", "plugins.json.search.gz", "plugins.json.search.zst"} {
+		index := BuildSearchIndex(searchTestPlugins())
+		index.Remove(2)
+		filename := filepath.Join(t.TempDir(), name)
+		if err := index.SaveToFile(filename); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if index.Modified() {
+			t.Errorf("%s: index still modified after saving", name)
+		}
+
+		loaded, err := LoadSearchIndex(filename)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if loaded.Modified() || loaded.Len() != 2 {
+			t.Errorf("%s: loaded index has Modified %v and Len %d, want false and 2", name, loaded.Modified(), loaded.Len())
+		}
+		for _, query := range []string{"openssl", `"code execution"`, "name:windows", "upgrade -windows", "apache"} {
+			want, _ := index.Search(query, nil)
+			got, err := loaded.Search(query, nil)
+			if err != nil {
+				t.Errorf("%s: Search(%q) failed: %v", name, query, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: Search(%q) on the loaded index = %v, want %v", name, query, got, want)
+			}
+		}
+		if !loaded.Add(&searchTestPlugins()[1]) || !loaded.Modified() {
+			t.Errorf("%s: adding to a loaded index didn't modify it", name)
+		}
+	}
+}
+
+func TestLoadSearchIndexRejectsOtherVersions(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "plugins.json.search")
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = gob.NewEncoder(file).Encode(searchIndexFile{Version: searchIndexVersion + 1})
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSearchIndex(filename); !errors.Is(err, ErrSearchIndexVersion) {
+		t.Errorf("LoadSearchIndex returned %v, want ErrSearchIndexVersion", err)
+	}
+
+	if err := os.WriteFile(filename, []byte("not a search index"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSearchIndex(filename); err == nil || errors.Is(err, ErrSearchIndexVersion) {
+		t.Errorf("LoadSearchIndex of a corrupt file returned %v, want a decode error", err)
+	}
+}
+
+func TestPluginListPageSearch(t *testing.T) {
+	page := PluginListPage{}
+	page.Data.PluginDetails = searchTestPlugins()
+	results, err := page.Search("openssl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Plugin.Name != "OpenSSL Remote Code Execution" || results[1].Plugin.ID != 2 {
+		t.Errorf("Search returned %v", results)
+	}
+	if page.Data.SearchIndex() == nil {
+		t.Error("Search didn't attach the index it built")
+	}
+}
@@ -1,21 +1,30 @@
 package querynessus
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
-	"os"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/google/go-querystring/query"
 )
 
 type TenableApiClient struct {
 	Credentials TenableCredentials
+	baseURL     string
+	httpClient  *http.Client
+	userAgent   string
+
+	retryPolicy       RetryPolicy
+	pageFailureBudget int
+	rateLimiters      rateLimiters
+	pageWorkers       int
 }
 
 type TenableRequestParams interface{}
@@ -25,13 +34,45 @@ type TenableCredentials struct {
 	SecretKey string
 }
 
-func NewTenableApiClient(accessKey string, secretKey string) TenableApiClient {
+// NewTenableApiClient creates a client authenticating with an API key pair,
+// configured by opts. It returns an error if any option is invalid.
+func NewTenableApiClient(accessKey string, secretKey string, opts ...ClientOption) (TenableApiClient, error) {
+	settings := clientSettings{
+		baseURL:           DefaultTenableBaseURL,
+		userAgent:         DefaultUserAgent,
+		retryPolicy:       DefaultRetryPolicy,
+		pageFailureBudget: DefaultPageFailureBudget,
+		pageWorkers:       1,
+		rateLimiters: rateLimiters{
+			classes: map[EndpointClass]RateLimiter{
+				PluginsEndpointClass: NewIntervalLimiter(RequestInterval),
+			},
+		},
+	}
+	for _, opt := range opts {
+		err := opt(&settings)
+		if err != nil {
+			return TenableApiClient{}, err
+		}
+	}
+	httpClient, err := settings.buildHTTPClient()
+	if err != nil {
+		return TenableApiClient{}, err
+	}
 	return TenableApiClient{
 		Credentials: TenableCredentials{
 			AccessKey: accessKey,
 			SecretKey: secretKey,
 		},
-	}
+		baseURL:    settings.baseURL,
+		httpClient: httpClient,
+		userAgent:  settings.userAgent,
+
+		retryPolicy:       settings.retryPolicy,
+		pageFailureBudget: settings.pageFailureBudget,
+		rateLimiters:      settings.rateLimiters,
+		pageWorkers:       settings.pageWorkers,
+	}, nil
 }
 
 type RequestParams struct {
@@ -44,57 +85,110 @@ func (reqParams RequestParams) IsZero() bool {
 	return reqParams == RequestParams{}
 }
 
-func (tac TenableApiClient) sendPostRequest(tenableEndpoint string, params TenableRequestParams, payload string) (*http.Response, error) {
-	v, _ := query.Values(params)
-	tr := &http.Transport{}
-	client := &http.Client{Transport: tr}
-	req, err := http.NewRequest("POST", tenableEndpoint, strings.NewReader(payload))
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("X-ApiKeys", "accessKey="+tac.Credentials.AccessKey+";secretKey="+tac.Credentials.SecretKey)
-	req.URL.RawQuery = v.Encode()
-	log.Printf("Query: %s", req.URL)
-	log.Printf("Body: %s", payload)
-	if err != nil {
-		log.Fatalf("Failed to create request")
-		return nil, err
+func (tac TenableApiClient) BaseURL() string {
+	if tac.baseURL == "" {
+		return DefaultTenableBaseURL
 	}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatalf("Failed to submit request")
-		return nil, err
+	return tac.baseURL
+}
+
+// endpoint builds an absolute URL by formatting path (with args, if any)
+// onto the client's base URL.
+func (tac TenableApiClient) endpoint(path string, args ...interface{}) string {
+	if len(args) > 0 {
+		path = fmt.Sprintf(path, args...)
 	}
-	if resp.StatusCode != 200 {
-		log.Printf("Received %s response from %s", resp.Status, tenableEndpoint)
-		return nil, fmt.Errorf("received %s response from %s", resp.Status, tenableEndpoint)
+	return tac.BaseURL() + path
+}
+
+func (tac TenableApiClient) client() *http.Client {
+	if tac.httpClient == nil {
+		return http.DefaultClient
 	}
+	return tac.httpClient
+}
 
-	return resp, nil
+func (tac TenableApiClient) sendRequest(ctx context.Context, method string, tenableEndpoint string, params TenableRequestParams, payload []byte) (*http.Response, error) {
+	return tac.sendRequestWithHeader(ctx, method, tenableEndpoint, params, payload, nil)
 }
 
-func (tac TenableApiClient) sendGetRequest(tenableEndpoint string, params TenableRequestParams) (*http.Response, error) {
-	v, _ := query.Values(params)
-	tr := &http.Transport{}
-	client := &http.Client{Transport: tr}
-	req, err := http.NewRequest("GET", tenableEndpoint, nil)
-	req.URL.RawQuery = v.Encode()
-	log.Printf("Query: %s", req.URL)
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("X-ApiKeys", "accessKey="+tac.Credentials.AccessKey+";secretKey="+tac.Credentials.SecretKey)
+// sendRequestWithHeader is sendRequest with extra request headers. A request
+// with a Range header also succeeds with a 206 Partial Content response.
+func (tac TenableApiClient) sendRequestWithHeader(ctx context.Context, method string, tenableEndpoint string, params TenableRequestParams, payload []byte, header http.Header) (*http.Response, error) {
+	v, err := query.Values(params)
 	if err != nil {
-		log.Fatalf("Failed to create request")
-		return nil, err
+		return nil, fmt.Errorf("failed to encode query parameters: %w", err)
 	}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatalf("Failed to submit request")
-		return nil, err
+	maxAttempts := 1
+	if isIdempotent(method) {
+		maxAttempts = tac.retryPolicy.attempts()
 	}
-	if resp.StatusCode != 200 {
+	class := endpointClassFromPath(strings.TrimPrefix(tenableEndpoint, tac.BaseURL()))
+	for attempt := 1; ; attempt++ {
+		if err := tac.rateLimiters.wait(ctx, class); err != nil {
+			return nil, err
+		}
+		var body io.Reader
+		if payload != nil {
+			body = bytes.NewReader(payload)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, tenableEndpoint, body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.URL.RawQuery = v.Encode()
+		req.Header.Add("Accept", "application/json")
+		req.Header.Add("X-ApiKeys", "accessKey="+tac.Credentials.AccessKey+";secretKey="+tac.Credentials.SecretKey)
+		if payload != nil {
+			req.Header.Add("Content-Type", "application/json")
+		}
+		if tac.userAgent != "" {
+			req.Header.Set("User-Agent", tac.userAgent)
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		log.Printf("Query: %s", req.URL)
+		resp, err := tac.client().Do(req)
+		if err != nil {
+			if attempt >= maxAttempts || !isTransientNetworkError(err) {
+				return nil, fmt.Errorf("failed to submit request: %w", err)
+			}
+			delay := tac.retryPolicy.Backoff(attempt)
+			log.Printf("Request to %s failed (%s), retrying in %s", tenableEndpoint, err, delay)
+			if err := sleepContext(ctx, delay); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode == 200 || (resp.StatusCode == http.StatusPartialContent && header.Get("Range") != "") {
+			return resp, nil
+		}
+
 		log.Printf("Received %s response from %s", resp.Status, tenableEndpoint)
-		return nil, fmt.Errorf("received %s response from %s", resp.Status, tenableEndpoint)
+		apiErr := newAPIError(resp)
+		resp.Body.Close()
+		if attempt >= maxAttempts || !isRetryableStatus(resp.StatusCode) {
+			return nil, apiErr
+		}
+		delay := tac.retryPolicy.Backoff(attempt)
+		if serverDelay, ok := retryAfter(resp.Header); ok && serverDelay > delay {
+			delay = serverDelay
+		}
+		log.Printf("Retrying request to %s in %s (attempt %d of %d)", tenableEndpoint, delay, attempt+1, maxAttempts)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
 	}
+}
 
-	return resp, nil
+func (tac TenableApiClient) sendPostRequest(ctx context.Context, tenableEndpoint string, params TenableRequestParams, payload string) (*http.Response, error) {
+	log.Printf("Body: %s", payload)
+	return tac.sendRequest(ctx, "POST", tenableEndpoint, params, []byte(payload))
+}
+
+func (tac TenableApiClient) sendGetRequest(ctx context.Context, tenableEndpoint string, params TenableRequestParams) (*http.Response, error) {
+	return tac.sendRequest(ctx, "GET", tenableEndpoint, params, nil)
 }
 
 type ExportScanParams struct {
@@ -102,21 +196,39 @@ type ExportScanParams struct {
 	HistoryUUID string `url:"history_uuid,omitempty"`
 }
 
+// ExportScanPayload is the body of an export request. Filters and Chapters
+// are flattened into the filter.N.* and chapters fields Tenable expects by
+// MarshalJSON.
 type ExportScanPayload struct {
 	Format   string `json:"format"`
 	Password string `json:"password,omitempty"`
 	AssetID  int    `json:"asset_id,omitempty"`
+	// Filters limits the export to matching findings.
+	Filters *ExportFilters `json:"-"`
+	// Chapters are the sections of html and pdf reports, which need at
+	// least one.
+	Chapters []ExportChapter `json:"-"`
 }
 
 func (tac TenableApiClient) ExportScanResults(params *ExportScanParams, scanId int, payload *ExportScanPayload) (fileId string, tempToken string, err error) {
-	endpoint := fmt.Sprintf("%s/%d/export", TenableScanEndpoint, scanId)
+	return tac.ExportScanResultsContext(context.Background(), params, scanId, payload)
+}
+
+func (tac TenableApiClient) ExportScanResultsContext(ctx context.Context, params *ExportScanParams, scanId int, payload *ExportScanPayload) (fileId string, tempToken string, err error) {
+	if err := payload.validate(); err != nil {
+		return "", "", err
+	}
+	endpoint := tac.endpoint("%s/%d/export", TenableScanPath, scanId)
 	jsonPayload, err := json.Marshal(payload)
-	resp, err := tac.sendPostRequest(endpoint, params, string(jsonPayload))
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := tac.sendPostRequest(ctx, endpoint, params, string(jsonPayload))
 	if err != nil {
 		return "", "", err
 	}
 	if resp == nil {
-		return "", "", fmt.Errorf("empty response received")
+		return "", "", ErrEmptyResponse
 	}
 	defer resp.Body.Close()
 
@@ -133,26 +245,39 @@ func (tac TenableApiClient) ExportScanResults(params *ExportScanParams, scanId i
 	var respBody ExportResponseBody
 	err = decoder.Decode(&respBody)
 	if err != nil {
-		return "", "", err
+		return "", "", newDecodeError(resp, err)
 	}
 
 	return respBody.FileId, respBody.TempToken, nil
 }
 
 func (tac TenableApiClient) ScanResultExportStatus(scanId int, fileId string) (result bool, err error) {
-	endpoint := fmt.Sprintf("%s/%d/export/%s/status", TenableScanEndpoint, scanId, fileId)
-	resp, err := tac.sendGetRequest(endpoint, &RequestParams{})
+	return tac.ScanResultExportStatusContext(context.Background(), scanId, fileId)
+}
+
+func (tac TenableApiClient) ScanResultExportStatusContext(ctx context.Context, scanId int, fileId string) (result bool, err error) {
+	status, err := tac.scanResultExportStatus(ctx, scanId, fileId)
 	if err != nil {
 		return false, err
 	}
-	if resp == nil {
-		return false, fmt.Errorf("empty response received")
+	if status == ExportStatusError {
+		return false, fmt.Errorf("%w: scan %d file %s", ErrExportFailed, scanId, fileId)
 	}
-	defer resp.Body.Close()
+	return status == ExportStatusReady, nil
+}
 
-	if resp.StatusCode != 200 {
-		return false, fmt.Errorf("received non 200 response %d", resp.StatusCode)
+// scanResultExportStatus returns the export's status lower cased, e.g.
+// "loading", "ready" or "error".
+func (tac TenableApiClient) scanResultExportStatus(ctx context.Context, scanId int, fileId string) (string, error) {
+	endpoint := tac.endpoint("%s/%d/export/%s/status", TenableScanPath, scanId, fileId)
+	resp, err := tac.sendGetRequest(ctx, endpoint, &RequestParams{})
+	if err != nil {
+		return "", err
+	}
+	if resp == nil {
+		return "", ErrEmptyResponse
 	}
+	defer resp.Body.Close()
 
 	type StatusResponseBody struct {
 		Status string `json:"status"`
@@ -162,58 +287,47 @@ func (tac TenableApiClient) ScanResultExportStatus(scanId int, fileId string) (r
 	var respBody StatusResponseBody
 	err = decoder.Decode(&respBody)
 	if err != nil {
-		return false, err
+		return "", newDecodeError(resp, err)
 	}
-	return strings.ToLower(respBody.Status) == "ready", nil
+	return strings.ToLower(respBody.Status), nil
 }
 
 func (tac TenableApiClient) DownloadExportedScan(scanId int, fileId string, outFile string) error {
-	out, err := os.Create(outFile)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	endpoint := fmt.Sprintf("%s/%d/export/%s/download", TenableScanEndpoint, scanId, fileId)
-	resp, err := tac.sendGetRequest(endpoint, &RequestParams{})
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("received non 200 response %d", resp.StatusCode)
-	}
-
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return err
-	}
+	return tac.DownloadExportedScanContext(context.Background(), scanId, fileId, outFile)
+}
 
-	return nil
+// DownloadExportedScanContext downloads to outFile.part, resuming a partial
+// download left by an earlier attempt, and only renames it to outFile once
+// all of the file has been received.
+func (tac TenableApiClient) DownloadExportedScanContext(ctx context.Context, scanId int, fileId string, outFile string) error {
+	_, err := tac.downloadExport(ctx, scanId, fileId, outFile, nil)
+	return err
 }
 
-func (tac TenableApiClient) fetchSinglePluginPage(params *RequestParams) (*PluginListPage, error) {
-	resp, err := tac.sendGetRequest(TenablePluginsServiceEndpoint, params)
+func (tac TenableApiClient) fetchSinglePluginPage(ctx context.Context, params *RequestParams) (*PluginListPage, error) {
+	resp, err := tac.sendGetRequest(ctx, tac.endpoint(TenablePluginsServicePath), params)
 	if err != nil {
 		return nil, err
 	}
 	if resp == nil {
-		return nil, fmt.Errorf("empty response received")
+		return nil, ErrEmptyResponse
 	}
 	defer resp.Body.Close()
 	decoder := json.NewDecoder(resp.Body)
 	var pluginPage PluginListPage
 	err = decoder.Decode(&pluginPage)
 	if err != nil {
-		log.Fatalf("Failed to decode results")
-		return nil, err
+		return nil, newDecodeError(resp, err)
 	}
 	return &pluginPage, nil
 }
 
 func (tac TenableApiClient) FetchPlugins(params *RequestParams) ([]PluginDetails, error) {
-	pluginPage, err := tac.fetchSinglePluginPage(params)
+	return tac.FetchPluginsContext(context.Background(), params)
+}
+
+func (tac TenableApiClient) FetchPluginsContext(ctx context.Context, params *RequestParams) ([]PluginDetails, error) {
+	pluginPage, err := tac.fetchSinglePluginPage(ctx, params)
 	if err != nil {
 		log.Println("Failed to fetch plugin page")
 		return nil, err
@@ -222,60 +336,131 @@ func (tac TenableApiClient) FetchPlugins(params *RequestParams) ([]PluginDetails
 }
 
 func (tac TenableApiClient) FetchAllPlugins(params *RequestParams) ([]PluginDetails, error) {
-	var pluginDetails []PluginDetails
-	for {
-		log.Printf("Requesting plugin page %d", params.Page)
-		endIndex := params.Page * params.Size
-		pluginPage, err := tac.fetchSinglePluginPage(params)
-		if err != nil {
-			log.Printf("Failed to fetch plugin page %d", params.Page)
-			continue
+	return tac.FetchAllPluginsContext(context.Background(), params)
+}
+
+// FetchAllPluginsContext fetches the first page to learn the total count and
+// then fetches the remaining pages with the client's page workers. Any pages
+// that still fail after retries are reported in a *PageFetchError returned
+// with the plugins from the pages that succeeded.
+func (tac TenableApiClient) FetchAllPluginsContext(ctx context.Context, params *RequestParams) ([]PluginDetails, error) {
+	budget := newFailureBudget(tac.pageFailureBudget)
+	firstParams := *params
+	if firstParams.Page < 1 {
+		firstParams.Page = 1
+	}
+	log.Printf("Requesting plugin page %d", firstParams.Page)
+	firstPage, err := tac.fetchPluginPageWithRetries(ctx, firstParams, budget)
+	if err != nil {
+		return nil, err
+	}
+	pageSize := firstParams.Size
+	if pageSize <= 0 {
+		pageSize = int32(len(firstPage.Data.PluginDetails))
+	}
+	lastPage := pageCount(firstPage.TotalCount, pageSize)
+	if lastPage < firstParams.Page {
+		lastPage = firstParams.Page
+	}
+
+	pages := make([][]PluginDetails, lastPage-firstParams.Page+1)
+	pages[0] = firstPage.Data.PluginDetails
+	failedPages := map[int32]error{}
+	if lastPage > firstParams.Page {
+		workers := tac.pageWorkers
+		if workers < 1 {
+			workers = 1
+		}
+		if int32(workers) > lastPage-firstParams.Page {
+			workers = int(lastPage - firstParams.Page)
+		}
+		jobs := make(chan int32)
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for page := range jobs {
+					pageParams := firstParams
+					pageParams.Page = page
+					log.Printf("Requesting plugin page %d of %d", page, lastPage)
+					pluginPage, err := tac.fetchPluginPageWithRetries(ctx, pageParams, budget)
+					mu.Lock()
+					if err != nil {
+						failedPages[page] = err
+					} else {
+						pages[page-firstParams.Page] = pluginPage.Data.PluginDetails
+					}
+					mu.Unlock()
+				}
+			}()
 		}
-		pluginDetails = append(pluginDetails, pluginPage.Data.PluginDetails...)
-		if endIndex > int32(pluginPage.TotalCount) {
-			break
-		} else {
-			params.Page = params.Page + 1
+	dispatch:
+		for page := firstParams.Page + 1; page <= lastPage; page++ {
+			select {
+			case jobs <- page:
+			case <-ctx.Done():
+				break dispatch
+			}
 		}
-		time.Sleep(RequestInterval)
+		close(jobs)
+		wg.Wait()
+	}
+
+	var pluginDetails []PluginDetails
+	for _, pagePlugins := range pages {
+		pluginDetails = append(pluginDetails, pagePlugins...)
+	}
+	if err := ctx.Err(); err != nil {
+		return pluginDetails, err
+	}
+	if len(failedPages) > 0 {
+		return pluginDetails, &PageFetchError{FailedPages: failedPages}
 	}
 	return pluginDetails, nil
 }
 
 func (tac TenableApiClient) FetchSinglePluginDetails(pluginId int) (PluginDetails, error) {
-	resp, err := tac.sendGetRequest(fmt.Sprintf("%s/%d", TenablePluginsServiceEndpoint, pluginId), &RequestParams{})
+	return tac.FetchSinglePluginDetailsContext(context.Background(), pluginId)
+}
+
+func (tac TenableApiClient) FetchSinglePluginDetailsContext(ctx context.Context, pluginId int) (PluginDetails, error) {
+	resp, err := tac.sendGetRequest(ctx, tac.endpoint("%s/%d", TenablePluginsServicePath, pluginId), &RequestParams{})
 	if err != nil {
 		return PluginDetails{}, err
 	}
 	if resp == nil {
-		return PluginDetails{}, fmt.Errorf("empty response received")
+		return PluginDetails{}, ErrEmptyResponse
 	}
 	defer resp.Body.Close()
 	decoder := json.NewDecoder(resp.Body)
 	var pluginDetails PluginDetails
 	err = decoder.Decode(&pluginDetails)
 	if err != nil {
-		log.Fatalf("Failed to decode results for plugin %d: %s\n", pluginId, err)
-		return PluginDetails{}, err
+		return PluginDetails{}, newDecodeError(resp, err)
 	}
 	return pluginDetails, nil
 }
 
 func (tac TenableApiClient) ListFolders() (*FolderCollection, error) {
-	resp, err := tac.sendGetRequest(TenableFoldersEndpoint, &RequestParams{})
+	return tac.ListFoldersContext(context.Background())
+}
+
+func (tac TenableApiClient) ListFoldersContext(ctx context.Context) (*FolderCollection, error) {
+	resp, err := tac.sendGetRequest(ctx, tac.endpoint(TenableFoldersPath), &RequestParams{})
 	if err != nil {
 		return nil, err
 	}
 	if resp == nil {
-		return nil, fmt.Errorf("empty response received")
+		return nil, ErrEmptyResponse
 	}
 	defer resp.Body.Close()
 	decoder := json.NewDecoder(resp.Body)
 	var folderCollection FolderCollection
 	err = decoder.Decode(&folderCollection)
 	if err != nil {
-		log.Fatalf("Failed to decode results")
-		return nil, fmt.Errorf("failed to decode folders collection: %s", err)
+		return nil, newDecodeError(resp, err)
 	}
 	return &folderCollection, nil
 }
@@ -286,53 +471,82 @@ type ScanParams struct {
 }
 
 func (tac TenableApiClient) ListScans(params *ScanParams) (*ScansPage, error) {
-	resp, err := tac.sendGetRequest(TenableScanEndpoint, &params)
+	return tac.ListScansContext(context.Background(), params)
+}
+
+func (tac TenableApiClient) ListScansContext(ctx context.Context, params *ScanParams) (*ScansPage, error) {
+	resp, err := tac.sendGetRequest(ctx, tac.endpoint(TenableScanPath), params)
 	if err != nil {
 		return nil, err
 	}
 	if resp == nil {
-		return nil, fmt.Errorf("empty response received")
+		return nil, ErrEmptyResponse
 	}
 	defer resp.Body.Close()
 	decoder := json.NewDecoder(resp.Body)
 	var allScans ScansPage
 	err = decoder.Decode(&allScans)
 	if err != nil {
-		log.Fatalf("Failed to decode results")
-		return nil, fmt.Errorf("failed to decode scan page: %s", err)
+		return nil, newDecodeError(resp, err)
 	}
 	return &allScans, nil
 }
 
 func (tac TenableApiClient) FetchScanDetails(scanId int) (*ScanDetails, error) {
-	resp, err := tac.sendGetRequest(fmt.Sprintf("%s/%d", TenableScanEndpoint, scanId), &RequestParams{})
+	return tac.FetchScanDetailsContext(context.Background(), scanId)
+}
+
+func (tac TenableApiClient) FetchScanDetailsContext(ctx context.Context, scanId int) (*ScanDetails, error) {
+	resp, err := tac.sendGetRequest(ctx, tac.endpoint("%s/%d", TenableScanPath, scanId), &RequestParams{})
 	if err != nil {
 		return nil, err
 	}
 	if resp == nil {
-		return nil, fmt.Errorf("empty response received")
+		return nil, ErrEmptyResponse
 	}
 	defer resp.Body.Close()
 	decoder := json.NewDecoder(resp.Body)
 	var scanDetails ScanDetails
 	err = decoder.Decode(&scanDetails)
 	if err != nil {
-		log.Fatalf("Failed to decode results for plugin %d: %s\n", scanId, err)
-		return nil, err
+		return nil, newDecodeError(resp, err)
 	}
 	return &scanDetails, nil
 }
 
+func (tac TenableApiClient) FetchScanHostDetails(scanId int, hostId int) (*ScanHostDetails, error) {
+	return tac.FetchScanHostDetailsContext(context.Background(), scanId, hostId)
+}
+
+func (tac TenableApiClient) FetchScanHostDetailsContext(ctx context.Context, scanId int, hostId int) (*ScanHostDetails, error) {
+	resp, err := tac.sendGetRequest(ctx, tac.endpoint("%s/%d/hosts/%d", TenableScanPath, scanId, hostId), &RequestParams{})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, ErrEmptyResponse
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	var hostDetails ScanHostDetails
+	err = decoder.Decode(&hostDetails)
+	if err != nil {
+		return nil, newDecodeError(resp, err)
+	}
+	return &hostDetails, nil
+}
+
 func LoadPluginsFromFile(filename string) (PluginListPage, error) {
-	jsonFile, err := os.Open(filename)
+	jsonFile, err := openDecompressed(filename)
 	if err != nil {
 		log.Println("Failed to open json file")
-		return PluginListPage{}, nil
+		return PluginListPage{}, err
 	}
+	defer jsonFile.Close()
 	results, err := ioutil.ReadAll(jsonFile)
 	if err != nil {
 		log.Println("Failed to read json file")
-		return PluginListPage{}, nil
+		return PluginListPage{}, err
 	}
 	var pluginPage PluginListPage
 	err = json.Unmarshal(results, &pluginPage)
@@ -350,7 +564,10 @@ func SaveJsonToFile(filename string, results interface{}) error {
 		log.Println("Failed to marshal JSON structure")
 		return err
 	}
-	err = ioutil.WriteFile(filename, file, 0644)
+	err = writeCompressedFileAtomic(filename, 0644, func(w io.Writer) error {
+		_, err := w.Write(file)
+		return err
+	})
 	if err != nil {
 		log.Printf("Failed to write to file %s", filename)
 		return err
@@ -1 +1,207 @@
 package querynessus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client for a stand-in Tenable API served by
+// handler, retrying quickly and without the default plugins rate limit.
+func newTestClient(t *testing.T, handler http.Handler, opts ...ClientOption) TenableApiClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	opts = append([]ClientOption{
+		WithBaseURL(server.URL),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}),
+		WithEndpointRateLimiter(PluginsEndpointClass, nil),
+	}, opts...)
+	client, err := NewTenableApiClient("access", "secret", opts...)
+	if err != nil {
+		t.Fatalf("NewTenableApiClient: %s", err)
+	}
+	return client
+}
+
+// requestCounter counts the requests to each path.
+type requestCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (counter *requestCounter) add(r *http.Request) int {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	if counter.counts == nil {
+		counter.counts = map[string]int{}
+	}
+	key := r.URL.Path + "?" + r.URL.RawQuery
+	counter.counts[key] += 1
+	return counter.counts[key]
+}
+
+func (counter *requestCounter) get(key string) int {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	return counter.counts[key]
+}
+
+func writePluginPage(w http.ResponseWriter, totalCount int, ids ...int) {
+	fmt.Fprintf(w, `{"size": %d, "total_count": %d, "data": {"plugin_details": [`, len(ids), totalCount)
+	for i, id := range ids {
+		if i > 0 {
+			fmt.Fprint(w, ",")
+		}
+		fmt.Fprintf(w, `{"id": %d, "name": "Plugin %d", "attributes": {"plugin_modification_date": "2024-01-01T00:00:00Z"}}`, id, id)
+	}
+	fmt.Fprint(w, "]}}")
+}
+
+func TestSendRequestRetriesTransientStatuses(t *testing.T) {
+	var counter requestCounter
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if counter.add(r) < 3 {
+			http.Error(w, `{"error": "Service Unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"folders": [{"id": 3, "name": "My Scans"}]}`)
+	}))
+	folders, err := client.ListFoldersContext(context.Background())
+	if err != nil {
+		t.Fatalf("ListFolders: %s", err)
+	}
+	if len(folders.Folders) != 1 || folders.Folders[0].Name != "My Scans" {
+		t.Errorf("got folders %+v", folders.Folders)
+	}
+	if got := counter.get(TenableFoldersPath + "?"); got != 3 {
+		t.Errorf("made %d requests, want 3", got)
+	}
+}
+
+func TestSendRequestHonoursRetryAfter(t *testing.T) {
+	var counter requestCounter
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if counter.add(r) == 1 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, `{"error": "Too Many Requests"}`, http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"folders": []}`)
+	}))
+	started := time.Now()
+	if _, err := client.ListFoldersContext(context.Background()); err != nil {
+		t.Fatalf("ListFolders: %s", err)
+	}
+	if elapsed := time.Since(started); elapsed < time.Second {
+		t.Errorf("retried after %s, want at least the 1s Retry-After", elapsed)
+	}
+}
+
+func TestSendRequestDoesNotRetryClientErrors(t *testing.T) {
+	var counter requestCounter
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter.add(r)
+		w.Header().Set("X-Request-Uuid", "abc123")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"statusCode": 404, "error": "Not Found", "message": "Scan not found"}`)
+	}))
+	_, err := client.FetchScanDetailsContext(context.Background(), 7)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "Scan not found" || apiErr.RequestID != "abc123" {
+		t.Errorf("got %#v", err)
+	}
+	if got := counter.get(TenableScanPath + "/7?"); got != 1 {
+		t.Errorf("made %d requests, want 1", got)
+	}
+}
+
+func TestSendRequestDoesNotRetryPosts(t *testing.T) {
+	var counter requestCounter
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter.add(r)
+		http.Error(w, `{"error": "Service Unavailable"}`, http.StatusServiceUnavailable)
+	}))
+	if _, _, err := client.ExportScanResultsContext(context.Background(), &ExportScanParams{}, 7, &ExportScanPayload{Format: "nessus"}); err == nil {
+		t.Fatal("export succeeded, want an error")
+	}
+	if got := counter.get(TenableScanPath + "/7/export?"); got != 1 {
+		t.Errorf("made %d requests, want 1", got)
+	}
+}
+
+func TestFetchAllPluginsDoesNotStackRetries(t *testing.T) {
+	var counter requestCounter
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter.add(r)
+		if r.URL.Query().Get("page") == "2" {
+			http.Error(w, `{"error": "Internal Server Error"}`, http.StatusInternalServerError)
+			return
+		}
+		writePluginPage(w, 2, 1)
+	}))
+	plugins, err := client.FetchAllPluginsContext(context.Background(), &RequestParams{Size: 1})
+	var pageErr *PageFetchError
+	if !errors.As(err, &pageErr) || len(pageErr.Pages()) != 1 || pageErr.Pages()[0] != 2 {
+		t.Fatalf("got %v, want a PageFetchError for page 2", err)
+	}
+	if len(plugins) != 1 {
+		t.Errorf("got %d plugins, want the 1 from page 1", len(plugins))
+	}
+	if got := counter.get(TenablePluginsServicePath + "?page=2&size=1"); got != 3 {
+		t.Errorf("made %d requests for page 2, want the retry policy's 3", got)
+	}
+}
+
+func TestFetchAllPluginsRetriesTruncatedPages(t *testing.T) {
+	var counter requestCounter
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if counter.add(r) == 1 && r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `{"size": 1, "total_count": 2, "data": {"plugin_det`)
+			return
+		}
+		if r.URL.Query().Get("page") == "2" {
+			writePluginPage(w, 2, 2)
+			return
+		}
+		writePluginPage(w, 2, 1)
+	}))
+	plugins, err := client.FetchAllPluginsContext(context.Background(), &RequestParams{Size: 1})
+	if err != nil {
+		t.Fatalf("FetchAllPlugins: %s", err)
+	}
+	if len(plugins) != 2 || plugins[1].ID != 2 {
+		t.Errorf("got plugins %+v, want 1 and 2", plugins)
+	}
+	if got := counter.get(TenablePluginsServicePath + "?page=2&size=1"); got != 2 {
+		t.Errorf("made %d requests for page 2, want 2", got)
+	}
+}
+
+func TestFetchAllPluginsGivesUpWhenBudgetIsSpent(t *testing.T) {
+	var counter requestCounter
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter.add(r)
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `{"data": `)
+			return
+		}
+		writePluginPage(w, 2, 1)
+	}), WithPageFailureBudget(2))
+	_, err := client.FetchAllPluginsContext(context.Background(), &RequestParams{Size: 1})
+	var pageErr *PageFetchError
+	if !errors.As(err, &pageErr) {
+		t.Fatalf("got %v, want a PageFetchError", err)
+	}
+	if got := counter.get(TenablePluginsServicePath + "?page=2&size=1"); got != 3 {
+		t.Errorf("made %d requests for page 2, want 1 plus a budget of 2", got)
+	}
+}
@@ -0,0 +1,101 @@
+package querynessus
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// PluginStreamWriter writes plugins one at a time in the same JSON layout as
+// PluginListPage, so the result can be read back with LoadPluginsFromFile or
+// a JsonFilePluginRepository. Size and total_count are written by Close once
+// the number of plugins is known.
+type PluginStreamWriter struct {
+	Params PluginListPageParams
+
+	writer  *bufio.Writer
+	count   int
+	started bool
+	closed  bool
+}
+
+func NewPluginStreamWriter(w io.Writer) *PluginStreamWriter {
+	return &PluginStreamWriter{
+		writer: bufio.NewWriter(w),
+	}
+}
+
+func (psw *PluginStreamWriter) writeHeader() error {
+	params, err := json.Marshal(psw.Params)
+	if err != nil {
+		return err
+	}
+	psw.started = true
+	if _, err := psw.writer.WriteString(`{"params":`); err != nil {
+		return err
+	}
+	if _, err := psw.writer.Write(params); err != nil {
+		return err
+	}
+	_, err = psw.writer.WriteString(`,"data":{"plugin_details":[`)
+	return err
+}
+
+func (psw *PluginStreamWriter) Write(plugin *PluginDetails) error {
+	if psw.closed {
+		return errors.New("write to closed plugin stream")
+	}
+	if !psw.started {
+		if err := psw.writeHeader(); err != nil {
+			return err
+		}
+	}
+	pluginJson, err := json.Marshal(plugin)
+	if err != nil {
+		return err
+	}
+	if psw.count > 0 {
+		if err := psw.writer.WriteByte(','); err != nil {
+			return err
+		}
+	}
+	if _, err := psw.writer.Write(pluginJson); err != nil {
+		return err
+	}
+	psw.count += 1
+	return nil
+}
+
+func (psw *PluginStreamWriter) Count() int {
+	return psw.count
+}
+
+// Close finishes the JSON document and flushes it. It does not close the
+// underlying writer.
+func (psw *PluginStreamWriter) Close() error {
+	if psw.closed {
+		return nil
+	}
+	if !psw.started {
+		if err := psw.writeHeader(); err != nil {
+			return err
+		}
+	}
+	psw.closed = true
+	counts, err := json.Marshal(struct {
+		Size       int `json:"size"`
+		TotalCount int `json:"total_count"`
+	}{psw.count, psw.count})
+	if err != nil {
+		return err
+	}
+	if _, err := psw.writer.WriteString("]},"); err != nil {
+		return err
+	}
+	// Splice the counts object's fields onto the end of the document.
+	if _, err := psw.writer.Write(counts[1:]); err != nil {
+		return err
+	}
+	return psw.writer.Flush()
+}
@@ -0,0 +1,88 @@
+package querynessus
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPluginStreamWriterWithoutPlugins(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := NewPluginStreamWriter(&buffer)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"params":{"page":0,"size":0,"last_updated":""},"data":{"plugin_details":[]},"size":0,"total_count":0}`
+	if buffer.String() != want {
+		t.Errorf("wrote %s, want %s", buffer.String(), want)
+	}
+	var page PluginListPage
+	if err := json.Unmarshal(buffer.Bytes(), &page); err != nil {
+		t.Errorf("output isn't valid JSON: %v", err)
+	}
+}
+
+func TestPluginStreamWriterRoundTrip(t *testing.T) {
+	for _, name := range []string{"plugins.json", "plugins.json.gz", "plugins.json.zst"} {
+		filename := filepath.Join(t.TempDir(), name)
+		file, err := os.Create(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compressed, err := NewCompressingWriter(file, CompressionFromFilename(filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer := NewPluginStreamWriter(compressed)
+		writer.Params = PluginListPageParams{Page: 1, Size: 10000, LastUpdated: "2024-01-01"}
+		for _, plugin := range indexTestPlugins().PluginDetails {
+			if err := writer.Write(&plugin); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := compressed.Close(); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+
+		page, err := LoadPluginsFromFile(filename)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if ids := pluginIDs(page.Data.PluginDetails); len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+			t.Errorf("%s: read back plugins %v, want [1 2]", name, ids)
+		}
+		if page.Size != 2 || page.TotalCount != 2 || writer.Count() != 2 {
+			t.Errorf("%s: size %d, total count %d and Count %d, want 2", name, page.Size, page.TotalCount, writer.Count())
+		}
+		if page.Params != writer.Params {
+			t.Errorf("%s: read back params %+v, want %+v", name, page.Params, writer.Params)
+		}
+	}
+}
+
+func TestPluginStreamWriterClose(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := NewPluginStreamWriter(&buffer)
+	if err := writer.Write(&PluginDetails{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	written := buffer.String()
+	if err := writer.Close(); err != nil {
+		t.Errorf("second Close returned %v", err)
+	}
+	if err := writer.Write(&PluginDetails{ID: 2}); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+	if buffer.String() != written {
+		t.Errorf("output changed after Close: %s", buffer.String())
+	}
+}